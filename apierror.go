@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// A non-200 answer of the API
+type apiError struct {
+	status int
+	// The status line, e.g. "402 Payment Required"
+	statusText string
+	body       string
+}
+
+// The error body of DeepSeek and the APIs compatible with OpenAI's
+type apiErrorBody struct {
+	Error struct {
+		Message string      `json:"message"`
+		Type    string      `json:"type"`
+		Code    interface{} `json:"code"`
+	} `json:"error"`
+}
+
+func (e *apiError) Error() string {
+	msg := fmt.Sprintf("%s: %s", e.statusText, e.message())
+	if hint := e.hint(); hint != "" {
+		msg += " (" + hint + ")"
+	}
+	return msg
+}
+
+// The message of the error body, or else the body itself
+func (e *apiError) message() string {
+	var body apiErrorBody
+	if json.Unmarshal([]byte(e.body), &body) == nil && body.Error.Message != "" {
+		return body.Error.Message
+	}
+	if text := strings.TrimSpace(e.body); text != "" {
+		return summarize(text, 200)
+	}
+	return "no details given"
+}
+
+// DeepSeek's refusal of a prompt it deems risky
+func (e *apiError) contentFilter() bool {
+	return strings.Contains(e.body, "Content Exists Risk")
+}
+
+// What to do about the error, after DeepSeek's documented error codes
+func (e *apiError) hint() string {
+	if e.contentFilter() {
+		return "the content filter refused the prompt, rephrase it"
+	}
+	command := "deepseek"
+	if currentProvider.name != DEFAULT_PROVIDER {
+		command += " -provider " + currentProvider.name
+	}
+	switch e.status {
+	case http.StatusBadRequest:
+		return "the request was malformed, run with -debug to see it"
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Sprintf("the API key was refused, check %s or run `%s auth login`", currentProvider.keyEnv, command)
+	case http.StatusPaymentRequired:
+		if currentProvider.name == DEFAULT_PROVIDER {
+			return "see `deepseek balance` and top up at https://platform.deepseek.com/top_up"
+		}
+		return "the account needs topping up"
+	case http.StatusNotFound:
+		return fmt.Sprintf("check -model against `%s -models` and -base-url", command)
+	case http.StatusUnprocessableEntity:
+		return "invalid parameters, check -model and -temperature"
+	case http.StatusTooManyRequests:
+		return "rate limited, try again later or pace requests with -rpm and -tpm"
+	case http.StatusInternalServerError, http.StatusBadGateway:
+		return "server error, try again later"
+	case http.StatusServiceUnavailable:
+		return "the server is overloaded, try again later or set -fallback"
+	}
+	return ""
+}
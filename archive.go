@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+)
+
+func init() {
+	registerCommand(command{
+		name:  "archive",
+		usage: "<chat-id>...  hide chats from -ls and keep them from being pruned",
+		run:   func(args []string) error { return setArchived(args, true) },
+	})
+	registerCommand(command{
+		name:  "unarchive",
+		usage: "<chat-id>...  bring archived chats back",
+		run:   func(args []string) error { return setArchived(args, false) },
+	})
+	registerCommand(command{
+		name:  "pin",
+		usage: "<chat-id>...  list chats first and keep them from being removed by age",
+		run:   func(args []string) error { return setPinned(args, true) },
+	})
+	registerCommand(command{
+		name:  "unpin",
+		usage: "<chat-id>...  unpin chats",
+		run:   func(args []string) error { return setPinned(args, false) },
+	})
+}
+
+// The most recently updated chat that isn't archived, or ""
+func latestActiveChat() string {
+	latest := ""
+	for id, meta := range chatIndex {
+		if !meta.Archived && (latest == "" || meta.UpdatedAt.After(chatIndex[latest].UpdatedAt)) {
+			latest = id
+		}
+	}
+	return latest
+}
+
+func setArchived(args []string, archived bool) error {
+	if len(args) == 0 {
+		if archived {
+			return errors.New("usage: deepseek archive <chat-id>...")
+		}
+		return errors.New("usage: deepseek unarchive <chat-id>...")
+	}
+	return updateChats(args, func(chatID string, chat *Chat) {
+		chat.Archived = archived
+		if archived {
+			infof("Chat %s archived.\n", chatID)
+		} else {
+			infof("Chat %s unarchived.\n", chatID)
+		}
+	})
+}
+
+func setPinned(args []string, pinned bool) error {
+	if len(args) == 0 {
+		if pinned {
+			return errors.New("usage: deepseek pin <chat-id>...")
+		}
+		return errors.New("usage: deepseek unpin <chat-id>...")
+	}
+	return updateChats(args, func(chatID string, chat *Chat) {
+		chat.Pinned = pinned
+		if pinned {
+			infof("Chat %s pinned.\n", chatID)
+		} else {
+			infof("Chat %s unpinned.\n", chatID)
+		}
+	})
+}
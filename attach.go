@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	registerCommand(command{
+		name:  "attach",
+		usage: "<job-id|chat-id>  follow an answer being generated by a job, or by the daemon in the chat, from what it has so far",
+		run:   runAttach,
+	})
+}
+
+// The answers a server is generating, by chat, for clients attaching to them
+type generations struct {
+	mu     sync.Mutex
+	byChat map[string]*generation
+}
+
+// An answer being generated: its text so far and, once over, the event it
+// ended with. changed is closed, and replaced, on every event.
+type generation struct {
+	mu      sync.Mutex
+	content strings.Builder
+	last    *streamEvent
+	changed chan struct{}
+}
+
+func (g *generations) start(chatID string) *generation {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.byChat == nil {
+		g.byChat = map[string]*generation{}
+	}
+	gen := &generation{changed: make(chan struct{})}
+	g.byChat[chatID] = gen
+	return gen
+}
+
+func (g *generations) end(chatID string, gen *generation) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.byChat[chatID] == gen {
+		delete(g.byChat, chatID)
+	}
+}
+
+func (g *generations) get(chatID string) *generation {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.byChat[chatID]
+}
+
+// Take an event of the answer: deltas add to it, done and error end it
+func (gen *generation) publish(event streamEvent) {
+	gen.mu.Lock()
+	defer gen.mu.Unlock()
+	switch event.Type {
+	case "delta":
+		gen.content.WriteString(event.Content)
+	case "done", "error":
+		gen.last = &event
+	default:
+		return
+	}
+	close(gen.changed)
+	gen.changed = make(chan struct{})
+}
+
+// The text of the answer from offset on, the event it ended with if it
+// did, and a channel closed on the next event
+func (gen *generation) since(offset int) (string, *streamEvent, <-chan struct{}) {
+	gen.mu.Lock()
+	defer gen.mu.Unlock()
+	return gen.content.String()[offset:], gen.last, gen.changed
+}
+
+// GET /api/chats/<id>/stream: the answer being generated in the chat, as
+// the server-sent events of POST /api/chats/<id>/messages, starting with
+// a delta of the text so far
+func (s *apiServer) streamGeneration(w http.ResponseWriter, r *http.Request, chatID string) {
+	gen := s.generations.get(chatID)
+	if gen == nil {
+		writeError(w, &httpError{http.StatusNotFound, fmt.Errorf("no answer is being generated in chat %s", chatID)})
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	offset := 0
+	for {
+		text, last, changed := gen.since(offset)
+		offset += len(text)
+		if text != "" {
+			writeEvent(w, flusher, streamEvent{Type: "delta", Content: text})
+		}
+		if last != nil {
+			writeEvent(w, flusher, *last)
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// Write an event to an SSE response, flushing it to the client
+func writeEvent(w io.Writer, flusher http.Flusher, event streamEvent) {
+	data, _ := json.Marshal(event)
+	fmt.Fprintf(w, "data: %s\n\n", data)
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
+
+func runAttach(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: deepseek attach <job-id|chat-id>")
+	}
+	if j, err := loadJob(args[0]); err == nil {
+		return followJob(j)
+	}
+	path, err := daemonSocket()
+	if err != nil {
+		return err
+	}
+	// Ctrl-C detaches, the answer going on
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	resp, err := daemonRequest(ctx, daemonClient(path, 0), http.MethodGet, "/api/chats/"+url.PathEscape(args[0])+"/stream", nil)
+	if err != nil {
+		return fmt.Errorf("no job %s, and no daemon is running", args[0])
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("no job %s, and %w", args[0], daemonError(resp))
+	}
+	last := printAnswerStream(resp.Body, true)
+	if ctx.Err() != nil {
+		infof("Detached, the daemon goes on answering\n")
+		return nil
+	}
+	reportAnswer(last)
+	return nil
+}
+
+// Print the answer of job j so far, and then as it comes until the job
+// is over
+func followJob(j job) error {
+	path, err := jobPath(j.ID, ".out")
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	buf := make([]byte, 32*1024)
+	endsLine := true
+	for {
+		// What the job wrote before it was seen to end is read after
+		over := j.Status != JOB_RUNNING && j.Status != JOB_STARTING
+		for {
+			n, err := f.Read(buf)
+			if n > 0 {
+				os.Stdout.Write(buf[:n])
+				endsLine = buf[n-1] == '\n'
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if over {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+		if j, err = loadJob(j.ID); err != nil {
+			return err
+		}
+	}
+	if !endsLine {
+		fmt.Println()
+	}
+	return jobResult(j)
+}
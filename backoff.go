@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// The delays between attempts double from RETRY_BASE up to RETRY_MAX
+	RETRY_BASE = time.Second
+	RETRY_MAX  = 30 * time.Second
+	// A Retry-After longer than this fails the request instead of waiting
+	RETRY_AFTER_MAX = 2 * time.Minute
+)
+
+// -retries: how many times a request is retried after a rate limit, a
+// server error or a failed connection
+var maxRetries = 3
+
+// Whether a response with this status may succeed when sent again later
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// How long to wait before retry attempt (counting from 1): the server's
+// Retry-After when it gave one, else an exponential backoff with
+// jitter. ok is false when the server asks to wait unreasonably long.
+func retryDelay(attempt int, header http.Header) (delay time.Duration, ok bool) {
+	if after := header.Get("Retry-After"); after != "" {
+		if seconds, err := strconv.Atoi(after); err == nil {
+			delay = time.Duration(seconds) * time.Second
+		} else if date, err := http.ParseTime(after); err == nil {
+			delay = time.Until(date)
+		}
+		if delay > RETRY_AFTER_MAX {
+			return delay, false
+		}
+		if delay > 0 {
+			return delay, true
+		}
+	}
+	ceiling := RETRY_BASE << min(attempt-1, 5)
+	ceiling = min(ceiling, RETRY_MAX)
+	return ceiling/2 + time.Duration(rand.Int63n(int64(ceiling/2)+1)), true
+}
+
+// Wait before retrying a request that failed with reason, when attempts
+// are left; false when the request should fail or ctx ends the wait
+func backoff(ctx context.Context, attempt int, reason string, header http.Header) bool {
+	if attempt > maxRetries {
+		return false
+	}
+	delay, ok := retryDelay(attempt, header)
+	if !ok {
+		infof("%s, and the server asks to retry in %s; giving up\n", reason, delay.Round(time.Second))
+		return false
+	}
+	infof("%s, retrying in %.1fs (%d/%d)\n", reason, delay.Seconds(), attempt, maxRetries)
+	select {
+	case <-time.After(delay):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
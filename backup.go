@@ -0,0 +1,324 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	BACKUPS_DIR   = "backups"
+	MANIFEST_FILE = "MANIFEST.json"
+	CONFIG_PREFIX = "config/"
+	AUTO_BACKUPS  = 5
+)
+
+func init() {
+	registerCommand(command{
+		name:  "backup",
+		usage: "[path]  snapshot history, roles and snippets to a .tar.gz",
+		run:   runBackup,
+	})
+	registerCommand(command{
+		name:  "restore",
+		usage: "<path>  restore a snapshot created by backup",
+		run:   runRestore,
+	})
+}
+
+// Describes the content of a backup archive
+type manifest struct {
+	CreatedAt     time.Time         `json:"created_at"`
+	SchemaVersion int               `json:"schema_version"`
+	Files         map[string]string `json:"files"`
+}
+
+// Files that belong in a backup: the index and the chats, relative to the
+// data directory, and the config files under config/
+func backupFiles() ([]string, error) {
+	var files []string
+	if info, err := os.Stat(historyFile); err == nil && info.Mode().IsRegular() {
+		files = append(files, filepath.Base(historyFile))
+	}
+	entries, err := os.ReadDir(filepath.Join(historyDir, CHATS_DIR))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := CHATS_DIR + "/" + entry.Name()
+		if entry.Type().IsRegular() && isBackupFile(name) {
+			files = append(files, name)
+		}
+	}
+	dir, err := configDir()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range configFiles {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			files = append(files, CONFIG_PREFIX+name)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Whether name, as in an archive, is one backups hold. The rest of the
+// data directory is the state and caches of this machine, that restore
+// leaves alone.
+func isBackupFile(name string) bool {
+	if rest, ok := strings.CutPrefix(name, CONFIG_PREFIX); ok {
+		return isConfigFile(rest)
+	}
+	if rest, ok := strings.CutPrefix(name, CHATS_DIR+"/"); ok {
+		return strings.HasSuffix(rest, ".json") && !strings.Contains(rest, "/") && !strings.HasPrefix(rest, ".")
+	}
+	return name == filepath.Base(historyFile) || isConfigFile(name)
+}
+
+// Whether name is one of the files kept in the config directory
+func isConfigFile(name string) bool {
+	for _, f := range configFiles {
+		if name == f {
+			return true
+		}
+	}
+	return false
+}
+
+// Where a file of a backup lives: config/ names in the config directory,
+// the others in the data directory. Backups of older versions keep roles
+// and snippets at the top, next to the history.
+func backupPath(name string) (string, error) {
+	rest, ok := strings.CutPrefix(name, CONFIG_PREFIX)
+	if !ok && !isConfigFile(name) {
+		return safeJoin(historyDir, filepath.FromSlash(name))
+	}
+	if !ok {
+		rest = name
+	}
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return safeJoin(dir, filepath.FromSlash(rest))
+}
+
+// Write a gzipped tar of the data directory with a manifest of SHA-256
+// checksums. The caller holds the history lock.
+func createBackup(path string) error {
+	files, err := backupFiles()
+	if err != nil {
+		return fmt.Errorf("listing files: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	m := manifest{CreatedAt: time.Now(), SchemaVersion: schemaVersion, Files: make(map[string]string)}
+	for _, name := range files {
+		path, err := backupPath(name)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		m.Files[name] = hex.EncodeToString(sum[:])
+		if err := writeTarFile(tw, name, data); err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, MANIFEST_FILE, data); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	header := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: time.Now()}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// Read a backup archive and verify every file against the manifest
+func readBackup(path string) (manifest, map[string][]byte, error) {
+	var m manifest
+	f, err := os.Open(path)
+	if err != nil {
+		return m, nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return m, nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	files := make(map[string][]byte)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return m, nil, fmt.Errorf("reading archive: %w", err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return m, nil, fmt.Errorf("reading archive: %w", err)
+		}
+		files[header.Name] = data
+	}
+
+	data, ok := files[MANIFEST_FILE]
+	if !ok {
+		return m, nil, errors.New("archive has no manifest")
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, nil, fmt.Errorf("parsing manifest: %w", err)
+	}
+	delete(files, MANIFEST_FILE)
+	for name, want := range m.Files {
+		data, ok := files[name]
+		if !ok {
+			return m, nil, fmt.Errorf("archive is missing %s", name)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != want {
+			return m, nil, fmt.Errorf("checksum mismatch for %s", name)
+		}
+	}
+	for name := range files {
+		if _, ok := m.Files[name]; !ok {
+			return m, nil, fmt.Errorf("%s is not listed in the manifest", name)
+		}
+	}
+	return m, files, nil
+}
+
+// Take a rotating automatic backup before a destructive operation, keeping
+// the newest AUTO_BACKUPS. The caller holds the history lock.
+func autoBackup(reason string) {
+	dir := filepath.Join(historyDir, BACKUPS_DIR)
+	path := filepath.Join(dir, fmt.Sprintf("auto-%s-%s.tar.gz", time.Now().Format("20060102-150405.000"), reason))
+	if err := createBackup(path); err != nil {
+		errorf("Warning: automatic backup failed: %v\n", err)
+		return
+	}
+	old, _ := filepath.Glob(filepath.Join(dir, "auto-*.tar.gz"))
+	sort.Strings(old)
+	for len(old) > AUTO_BACKUPS {
+		os.Remove(old[0])
+		old = old[1:]
+	}
+}
+
+func runBackup(args []string) error {
+	path := ""
+	if len(args) > 0 {
+		path = args[0]
+	}
+	return withHistoryLock(func() error {
+		if path == "" {
+			path = filepath.Join(historyDir, BACKUPS_DIR, "backup-"+time.Now().Format("20060102-150405")+".tar.gz")
+		}
+		if err := createBackup(path); err != nil {
+			return fmt.Errorf("creating backup: %w", err)
+		}
+		fmt.Println(path)
+		return nil
+	})
+}
+
+func runRestore(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: deepseek restore <path>")
+	}
+	m, files, err := readBackup(args[0])
+	if err != nil {
+		return err
+	}
+	if m.SchemaVersion > SCHEMA_VERSION {
+		return fmt.Errorf("backup schema version %d is newer than supported (%d)", m.SchemaVersion, SCHEMA_VERSION)
+	}
+	if !*assumeYes && !confirm(fmt.Sprintf("Replace the current history with the backup from %s (%d files)?", m.CreatedAt.Format(time.DateTime), len(files))) {
+		return nil
+	}
+
+	return withHistoryLock(func() error {
+		autoBackup("restore")
+
+		current, err := backupFiles()
+		if err != nil {
+			return err
+		}
+		for _, name := range current {
+			if _, ok := files[name]; !ok {
+				if path, err := backupPath(name); err == nil {
+					os.Remove(path)
+				}
+			}
+		}
+		restored := 0
+		for name, data := range files {
+			// Backups of older versions hold state of the machine they were taken on
+			if !isBackupFile(name) {
+				infof("Skipping %s, not part of a backup\n", name)
+				continue
+			}
+			path, err := backupPath(name)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+				return err
+			}
+			if err := writeFileAtomic(path, data, 0600); err != nil {
+				return err
+			}
+			restored++
+		}
+		// Pick up the restored index so withHistoryLock writes it back unchanged
+		if err := readIndex(); err != nil {
+			return err
+		}
+		if err := migrateHistory(); err != nil {
+			return err
+		}
+		infof("Restored %d files from %s\n", restored, args[0])
+		return nil
+	})
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Where the balance last fetched is kept, for -warn-below to check
+	// before each prompt without asking every time
+	BALANCE_CACHE_FILE = "balance.json"
+	BALANCE_CACHE_AGE  = 10 * time.Minute
+)
+
+// -warn-below: warn when the balance of a currency falls below this, 0 to
+// never warn
+var warnBelow float64
+
+// The answer of /user/balance
+type balanceResponse struct {
+	IsAvailable  bool          `json:"is_available"`
+	BalanceInfos []balanceInfo `json:"balance_infos"`
+}
+
+type balanceInfo struct {
+	Currency        string `json:"currency"`
+	TotalBalance    string `json:"total_balance"`
+	GrantedBalance  string `json:"granted_balance"`
+	ToppedUpBalance string `json:"topped_up_balance"`
+}
+
+// The balance fetched with a key, masked
+type balanceCache struct {
+	Key     string          `json:"key"`
+	Time    time.Time       `json:"time"`
+	Balance balanceResponse `json:"balance"`
+}
+
+func init() {
+	registerCommand(command{
+		name:  "balance",
+		usage: "[-json] [-warn-below amount]  available, granted and topped-up balance per currency",
+		run:   runBalance,
+	})
+}
+
+func runBalance(args []string) error {
+	fs := flag.NewFlagSet("balance", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Print the balance as JSON")
+	fs.Float64Var(&warnBelow, "warn-below", warnBelow, "Fail when the balance of a currency is below this")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 || warnBelow < 0 {
+		return errors.New("usage: deepseek balance [-json] [-warn-below amount]")
+	}
+	apiKey, err := loadAPIKey()
+	if err != nil {
+		return err
+	}
+	balance, err := fetchBalance(apiKey)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(balance); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("%-8s  %10s  %10s  %10s\n", "Currency", "Total", "Granted", "Topped up")
+		for _, info := range balance.BalanceInfos {
+			fmt.Printf("%-8s  %10s  %10s  %10s\n", info.Currency, info.TotalBalance, info.GrantedBalance, info.ToppedUpBalance)
+		}
+		if !balance.IsAvailable {
+			infof("The balance is insufficient for API calls\n")
+		}
+	}
+	if low := lowBalance(balance); low != "" {
+		return withExitCode(errors.New(low), EXIT_BALANCE)
+	}
+	return nil
+}
+
+// The balance endpoint is next to /v1, like the beta one
+func balanceURL() string {
+	return strings.TrimSuffix(strings.TrimSuffix(apiBaseURL, "/"), "/v1") + "/user/balance"
+}
+
+// Ask the API for the balance of apiKey, and cache it
+func fetchBalance(apiKey string) (balanceResponse, error) {
+	var balance balanceResponse
+	req, err := http.NewRequest("GET", balanceURL(), nil)
+	if err != nil {
+		return balance, err
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Accept", "application/json")
+	prepareRequest(req)
+	resp, err := sendRequest(req, API_TIMEOUT, 0)
+	if err != nil {
+		return balance, fmt.Errorf("fetching the balance: %w", timeoutError(err))
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return balance, fmt.Errorf("fetching the balance: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return balance, fmt.Errorf("fetching the balance: %w", &apiError{resp.StatusCode, resp.Status, string(body)})
+	}
+	if err := json.Unmarshal(body, &balance); err != nil {
+		return balance, fmt.Errorf("parsing the balance: %w", err)
+	}
+	if path, err := dataPath(BALANCE_CACHE_FILE); err == nil {
+		data, _ := json.Marshal(balanceCache{Key: maskSecret(apiKey), Time: time.Now(), Balance: balance})
+		writeFileAtomic(path, data, 0600)
+	}
+	return balance, nil
+}
+
+// A warning when a currency of balance is below -warn-below, or the
+// balance is not enough for API calls; "" otherwise
+func lowBalance(balance balanceResponse) string {
+	if warnBelow <= 0 {
+		return ""
+	}
+	if !balance.IsAvailable {
+		return "the balance is insufficient for API calls, top up at https://platform.deepseek.com/top_up"
+	}
+	var low []string
+	for _, info := range balance.BalanceInfos {
+		total, err := strconv.ParseFloat(info.TotalBalance, 64)
+		if err == nil && total < warnBelow {
+			low = append(low, info.TotalBalance+" "+info.Currency)
+		}
+	}
+	if len(low) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("the balance of %s is below -warn-below %g", strings.Join(low, " and "), warnBelow)
+}
+
+// Warn before a prompt when the balance is low, going by the balance
+// cached within BALANCE_CACHE_AGE when there is one. Only DeepSeek has the
+// endpoint.
+func checkBalance(apiKey string) {
+	if warnBelow <= 0 || currentProvider.name != DEFAULT_PROVIDER {
+		return
+	}
+	var cache balanceCache
+	if path, err := dataPath(BALANCE_CACHE_FILE); err == nil {
+		if data, err := os.ReadFile(path); err == nil {
+			json.Unmarshal(data, &cache)
+		}
+	}
+	balance := cache.Balance
+	if cache.Key != maskSecret(apiKey) || time.Since(cache.Time) > BALANCE_CACHE_AGE {
+		var err error
+		if balance, err = fetchBalance(apiKey); err != nil {
+			if *debug {
+				errorf("Checking the balance: %v\n", err)
+			}
+			return
+		}
+	}
+	if low := lowBalance(balance); low != "" {
+		errorf("Warning: %s\n", low)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	// Where the estimated cost of the answers is summed per month, incognito
+	// ones and those of removed chats included
+	SPEND_FILE = "spend.json"
+	// Share of -budget after which every request warns
+	BUDGET_WARN = 0.8
+)
+
+var (
+	// -budget: USD a month not to exceed, 0 for no limit
+	monthlyBudget float64
+	// -force: send even when the budget is spent
+	forceBudget bool
+)
+
+// Estimated USD spent per month, by "2006-01"
+type spendState map[string]float64
+
+func spendMonth() string {
+	return time.Now().Format("2006-01")
+}
+
+// Update the spending under its lock
+func updateSpend(fn func(state spendState)) (spendState, error) {
+	path, err := dataPath(SPEND_FILE)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := lockPath(path+".lock", "spending")
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	state := spendState{}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &state)
+	}
+	if fn == nil {
+		return state, nil
+	}
+	fn(state)
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	return state, writeFileAtomic(path, data, 0600)
+}
+
+// Add the estimated cost of an answer to the month, for models with a
+// known price
+func recordSpend(model string, usage *Usage) {
+	cost := estimateCost(model, usage)
+	if cost == 0 {
+		return
+	}
+	_, err := updateSpend(func(state spendState) {
+		state[spendMonth()] += cost
+	})
+	if err != nil && debug != nil && *debug {
+		errorf("Recording the cost: %v\n", err)
+	}
+}
+
+// Refuse a request once the -budget of the month is spent, unless -force,
+// and warn when it is nearly spent
+func checkBudget() error {
+	if monthlyBudget <= 0 {
+		return nil
+	}
+	state, err := updateSpend(nil)
+	if err != nil {
+		return fmt.Errorf("reading the spending: %w", err)
+	}
+	spent := state[spendMonth()]
+	switch {
+	case spent >= monthlyBudget && forceBudget:
+		errorf("Warning: $%.2f spent this month, over the -budget of $%.2f, sending anyway (-force)\n", spent, monthlyBudget)
+	case spent >= monthlyBudget:
+		return withExitCode(fmt.Errorf("$%.2f spent this month, the -budget of $%.2f is used up; -force sends anyway", spent, monthlyBudget), EXIT_BALANCE)
+	case spent >= monthlyBudget*BUDGET_WARN:
+		errorf("Warning: $%.2f of the -budget of $%.2f spent this month\n", spent, monthlyBudget)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	// -record: cassette file to save the API interactions to
+	recordPath string
+	// -replay: cassette file to answer API requests from, without network
+	replayPath string
+)
+
+// A cassette: API interactions in the order they happened
+type cassette struct {
+	Interactions []interaction `json:"interactions"`
+}
+
+type interaction struct {
+	Request  recordedRequest  `json:"request"`
+	Response recordedResponse `json:"response"`
+}
+
+type recordedRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+type recordedResponse struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body"`
+}
+
+// Check -record and -replay
+func checkCassette() error {
+	if recordPath != "" && replayPath != "" {
+		return errors.New("-record and -replay don't go together")
+	}
+	if replayPath != "" {
+		_, err := loadCassette(replayPath)
+		return err
+	}
+	return nil
+}
+
+func loadCassette(path string) (cassette, error) {
+	var c cassette
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c, fmt.Errorf("reading cassette: %w", err)
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("parsing cassette %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Read the body of req, leaving it readable again
+func peekBody(req *http.Request) (string, error) {
+	if req.Body == nil {
+		return "", nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return string(body), nil
+}
+
+// A transport adding every interaction of next to the -record cassette,
+// once its response body is read, with the secrets left out
+type recordTransport struct {
+	next http.RoundTripper
+}
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := peekBody(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	secrets := requestSecrets(req)
+	header := resp.Header.Clone()
+	for _, name := range secretHeaders {
+		header.Del(name)
+	}
+	rec := interaction{
+		Request:  recordedRequest{Method: req.Method, URL: redact(req.URL.String(), secrets), Body: redact(body, secrets)},
+		Response: recordedResponse{Status: resp.StatusCode, Headers: header},
+	}
+	resp.Body = &dumpBody{ReadCloser: resp.Body, done: func(body []byte) {
+		rec.Response.Body = redact(string(body), secrets)
+		if err := appendInteraction(rec); err != nil {
+			errorf("Error recording to %s: %v\n", recordPath, err)
+		}
+	}}
+	return resp, nil
+}
+
+// Add an interaction to the cassette under its lock, for invocations
+// recording to the same file
+func appendInteraction(rec interaction) error {
+	unlock, err := lockPath(recordPath+".lock", "cassette")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	var c cassette
+	if data, err := os.ReadFile(recordPath); err == nil {
+		if err := json.Unmarshal(data, &c); err != nil {
+			return fmt.Errorf("parsing cassette: %w", err)
+		}
+	}
+	c.Interactions = append(c.Interactions, rec)
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(recordPath, data, 0600)
+}
+
+func redact(text string, secrets []string) string {
+	for _, secret := range secrets {
+		text = strings.ReplaceAll(text, secret, REDACTED)
+	}
+	return text
+}
+
+// A transport answering from the -replay cassette. Each interaction is
+// replayed once: the first unused one of the same request, or else of the
+// same method and URL, since the history sent along may differ.
+type replayTransport struct {
+	once     sync.Once
+	mu       sync.Mutex
+	cassette cassette
+	err      error
+	used     map[int]bool
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.once.Do(func() {
+		t.cassette, t.err = loadCassette(replayPath)
+		t.used = map[int]bool{}
+	})
+	if t.err != nil {
+		return nil, t.err
+	}
+	body, err := peekBody(req)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	url := req.URL.String()
+	found := -1
+	for i, rec := range t.cassette.Interactions {
+		if !t.used[i] && rec.Request.Method == req.Method && rec.Request.URL == url && rec.Request.Body == body {
+			found = i
+			break
+		}
+	}
+	if found < 0 {
+		for i, rec := range t.cassette.Interactions {
+			if !t.used[i] && rec.Request.Method == req.Method && rec.Request.URL == url {
+				infof("No recorded request matches exactly, replaying the next one to %s\n", url)
+				found = i
+				break
+			}
+		}
+	}
+	if found < 0 {
+		return nil, fmt.Errorf("no recorded response left for %s %s in %s", req.Method, url, replayPath)
+	}
+	t.used[found] = true
+	rec := t.cassette.Interactions[found].Response
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", rec.Status, http.StatusText(rec.Status)),
+		StatusCode: rec.Status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     rec.Headers.Clone(),
+		Body:       io.NopCloser(strings.NewReader(rec.Body)),
+		Request:    req,
+	}, nil
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Everything needed to send one chat completion request
+type chatRequest struct {
+	// ctx cancels the request, e.g. on Ctrl-C; nil for none
+	ctx context.Context
+	// provider and baseURL are where the request goes: the current
+	// provider and -base-url when provider is unset
+	provider provider
+	baseURL  string
+	apiKey   string
+	model    string
+	messages []Message
+	// temperature overrides the model's default sampling temperature
+	temperature *float64
+	// out receives the answer content as it streams, may be nil
+	out io.Writer
+	// onEvent, when set, receives every event parsed from the stream
+	onEvent func(streamEvent)
+	// onRaw, when set, receives every line of the response body unmodified
+	onRaw func(line string)
+	debug bool
+	// keysTried counts the keys that failed before apiKey
+	keysTried int
+	// retries counts the attempts that failed transiently, see backoff
+	retries int
+	// prefix continues the last message, a partial answer, see resume
+	prefix bool
+}
+
+// The outcome of a streamed chat completion
+type chatResponse struct {
+	content      string
+	reasoning    string
+	usage        *Usage
+	finishReason string
+	firstToken   time.Duration
+	latency      time.Duration
+	// apiKey is the key that served the request
+	apiKey string
+	// model is the one the API reports answering, which differs from the
+	// requested one when a router such as OpenRouter picks it
+	model string
+	// interrupted is set when ctx was canceled or the connection dropped
+	// while the answer streamed
+	interrupted bool
+}
+
+// The provider and base URL the request is sent to
+func (r chatRequest) target() (provider, string) {
+	if r.provider.name == "" {
+		return currentProvider, apiBaseURL
+	}
+	return r.provider, r.baseURL
+}
+
+func (r chatRequest) context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// Timing stats of the response, for recording in history
+func (r chatResponse) stats() *Stats {
+	stats := &Stats{
+		FirstTokenMs: r.firstToken.Milliseconds(),
+		LatencyMs:    r.latency.Milliseconds(),
+	}
+	if len(apiKeys()) > 1 {
+		stats.Key = maskSecret(r.apiKey)
+	}
+	if generation := (r.latency - r.firstToken).Seconds(); r.usage != nil && generation > 0 {
+		stats.TokensPerSecond = float64(r.usage.CompletionTokens) / generation
+	}
+	return stats
+}
+
+// The assistant message to store for the response
+func (r chatResponse) message(model string) Message {
+	if r.model != "" {
+		model = r.model
+	}
+	return Message{
+		Role:        "assistant",
+		Content:     r.content,
+		Reasoning:   r.reasoning,
+		Model:       model,
+		Usage:       r.usage,
+		Stats:       r.stats(),
+		Time:        now(),
+		Interrupted: r.interrupted,
+	}
+}
+
+// Print the performance footer of -stats to stderr
+func printStats(r chatResponse) {
+	stats := r.stats()
+	line := fmt.Sprintf("first token %.2fs · total %.2fs", r.firstToken.Seconds(), r.latency.Seconds())
+	if r.usage != nil {
+		line += fmt.Sprintf(" · %d prompt + %d completion tokens", r.usage.PromptTokens, r.usage.CompletionTokens)
+	}
+	if stats.TokensPerSecond > 0 {
+		line += fmt.Sprintf(" · %.1f tok/s", stats.TokensPerSecond)
+	}
+	fmt.Fprintln(os.Stderr, line)
+}
+
+// Strip the local bookkeeping fields of messages before sending them
+func toAPIMessages(messages []Message) []apiMessage {
+	out := make([]apiMessage, len(messages))
+	for i, msg := range messages {
+		out[i] = apiMessage{Role: msg.Role, Content: msg.Content}
+	}
+	return out
+}
+
+// A single event of a streamed answer, as emitted by -output=jsonl
+type streamEvent struct {
+	Type     string          `json:"type"`
+	Content  string          `json:"content,omitempty"`
+	ToolCall json.RawMessage `json:"tool_call,omitempty"`
+	Usage    *Usage          `json:"usage,omitempty"`
+	ChatID   string          `json:"chat_id,omitempty"`
+	Model    string          `json:"model,omitempty"`
+	Finish   string          `json:"finish_reason,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	// The exit status of the CLI for the error
+	Code int `json:"code,omitempty"`
+}
+
+// Send the messages to the chat completions endpoint, writing the streamed
+// answer to r.out as it arrives, and return the full assistant message
+func streamChat(r chatRequest) (chatResponse, error) {
+	p, baseURL := r.target()
+	if p.api == API_OLLAMA {
+		return streamOllama(r)
+	}
+	var result chatResponse
+	start := time.Now()
+	emit := func(event streamEvent) {
+		if r.onEvent != nil {
+			r.onEvent(event)
+		}
+	}
+	debug := r.debug
+
+	// Build request body
+	stream := noStream == nil || !*noStream
+	messages, endpoint := toAPIMessages(r.messages), endpointURL(baseURL, "chat/completions")
+	if r.prefix {
+		messages = continueMessages(p, messages)
+		if p.name == DEFAULT_PROVIDER {
+			endpoint = prefixCompletionURL(baseURL)
+		}
+	}
+	requestBody := RequestBody{
+		Model:       r.model,
+		Messages:    messages,
+		Stream:      stream,
+		Temperature: r.temperature,
+	}
+	if stream {
+		requestBody.StreamOptions = &StreamOptions{IncludeUsage: true}
+	}
+
+	// Convert body to JSON
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return result, fmt.Errorf("marshaling request body: %w", err)
+	}
+
+	if debug {
+		log.Printf("Request body: %s\n", string(jsonData))
+	}
+
+	// Create HTTP request
+	req, err := http.NewRequestWithContext(r.context(), "POST", endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return result, fmt.Errorf("creating request: %w", err)
+	}
+
+	rateID, err := waitRateLimit(r.context(), estimateTokens(messages))
+	if err != nil {
+		return result, err
+	}
+
+	// Set headers
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+r.apiKey)
+	prepareRequestFor(req, p)
+	logAPIKey(r.apiKey)
+
+	// Send request
+	resp, err := sendChatRequest(req, stream)
+	if err != nil {
+		if r.context().Err() == nil && backoff(r.context(), r.retries+1, "Request failed: "+err.Error(), nil) {
+			r.retries++
+			return streamChat(r)
+		}
+		return result, fmt.Errorf("making request: %w", timeoutError(err))
+	}
+	defer resp.Body.Close()
+
+	if debug {
+		log.Printf("=== Response status: %s\n", resp.Status)
+		log.Println("=== Response headers:")
+		for key, values := range resp.Header {
+			log.Printf("  %s: %v\n", key, values)
+		}
+	}
+
+	// Check if the response status is not 200
+	if resp.StatusCode != http.StatusOK {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return result, fmt.Errorf("reading error response: %w", err)
+		}
+		if r.onRaw != nil {
+			r.onRaw(string(body))
+		}
+		if debug {
+			log.Printf("== Error response body: %s\n", body)
+		}
+		if next := nextAPIKey(p, r.apiKey, r.keysTried+1); keyFailed(resp.StatusCode) && next != "" {
+			infof("API key %s got %s, retrying with %s\n", maskSecret(r.apiKey), resp.Status, maskSecret(next))
+			r.apiKey = next
+			r.keysTried++
+			return streamChat(r)
+		}
+		if retryableStatus(resp.StatusCode) && backoff(r.context(), r.retries+1, "API error "+resp.Status, resp.Header) {
+			r.retries++
+			return streamChat(r)
+		}
+		return result, &apiError{resp.StatusCode, resp.Status, string(body)}
+	}
+
+	result.apiKey = r.apiKey
+	if !stream {
+		result, err := readCompletion(r, resp.Body, start)
+		recordUsage(rateID, result.usage)
+		recordSpend(r.model, result.usage)
+		return result, err
+	}
+
+	// Process streaming response
+	body := watchStall(resp.Body)
+	defer body.Close()
+	events := newSSEReader(body, func(line string) {
+		if r.onRaw != nil {
+			r.onRaw(line)
+		}
+		if debug {
+			log.Printf("== Raw line received: %s\n", line)
+		}
+	})
+	var fullResponse strings.Builder
+	var streamErr error
+
+	if debug {
+		log.Println("=== Starting to process stream response...")
+	}
+
+	for {
+		line, err := events.next()
+		if err != nil {
+			if err != io.EOF {
+				streamErr = err
+			}
+			break
+		}
+		if line == "[DONE]" {
+			if debug {
+				log.Println("Received [DONE] message, ending stream")
+			}
+			break
+		}
+
+		var streamResp StreamResponse
+		if err := json.Unmarshal([]byte(line), &streamResp); err != nil {
+			if debug {
+				log.Printf("Error unmarshaling JSON: %v\nProblematic line: %s\n", err, line)
+			}
+			continue
+		}
+
+		if streamResp.Model != "" {
+			result.model = streamResp.Model
+		}
+		if streamResp.Usage != nil {
+			result.usage = streamResp.Usage
+			emit(streamEvent{Type: "usage", Usage: streamResp.Usage})
+		}
+
+		if len(streamResp.Choices) > 0 {
+			choice := streamResp.Choices[0]
+			content := choice.Delta.Content
+			if debug {
+				log.Printf("Received content chunk: %s\n", content)
+			}
+			if result.firstToken == 0 && (content != "" || choice.Delta.ReasoningContent != "") {
+				result.firstToken = time.Since(start)
+			}
+			if choice.Delta.ReasoningContent != "" {
+				result.reasoning += choice.Delta.ReasoningContent
+				emit(streamEvent{Type: "reasoning", Content: choice.Delta.ReasoningContent})
+			}
+			for _, call := range choice.Delta.ToolCalls {
+				emit(streamEvent{Type: "tool_call", ToolCall: call})
+			}
+			if content != "" {
+				if r.out != nil {
+					fmt.Fprint(r.out, content)
+				}
+				fullResponse.WriteString(content)
+				emit(streamEvent{Type: "delta", Content: content})
+			}
+			if choice.FinishReason != "" {
+				result.finishReason = choice.FinishReason
+			}
+		} else if debug && streamResp.Usage == nil {
+			log.Println("No choices in response")
+		}
+	}
+
+	result.content = fullResponse.String()
+	result.latency = time.Since(start)
+	result.interrupted = r.context().Err() != nil || streamErr != nil
+	recordUsage(rateID, result.usage)
+	recordSpend(r.model, result.usage)
+	if err := streamErr; err != nil {
+		// Nothing is lost sending it again when nothing arrived
+		if errors.Is(err, errStalled) && result.content == "" && result.reasoning == "" && backoff(r.context(), r.retries+1, err.Error(), nil) {
+			r.retries++
+			return streamChat(r)
+		}
+		return result, fmt.Errorf("reading stream: %w", timeoutError(err))
+	}
+	return result, nil
+}
+
+// Read a whole, non-streamed completion, reporting it to r as a stream of
+// a single chunk
+func readCompletion(r chatRequest, body io.Reader, start time.Time) (chatResponse, error) {
+	result := chatResponse{apiKey: r.apiKey}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return result, fmt.Errorf("reading response: %w", timeoutError(err))
+	}
+	if r.onRaw != nil {
+		r.onRaw(string(data))
+	}
+	if r.debug {
+		log.Printf("== Response body: %s\n", data)
+	}
+	var completion CompletionResponse
+	if err := json.Unmarshal(data, &completion); err != nil {
+		return result, fmt.Errorf("parsing response: %w", err)
+	}
+	result.firstToken = time.Since(start)
+	result.latency = result.firstToken
+	result.model = completion.Model
+	if len(completion.Choices) > 0 {
+		choice := completion.Choices[0]
+		result.content = choice.Message.Content
+		result.reasoning = choice.Message.ReasoningContent
+		result.finishReason = choice.FinishReason
+	}
+	if r.onEvent != nil {
+		if result.reasoning != "" {
+			r.onEvent(streamEvent{Type: "reasoning", Content: result.reasoning})
+		}
+		if result.content != "" {
+			r.onEvent(streamEvent{Type: "delta", Content: result.content})
+		}
+	}
+	if completion.Usage != nil {
+		result.usage = completion.Usage
+		if r.onEvent != nil {
+			r.onEvent(streamEvent{Type: "usage", Usage: completion.Usage})
+		}
+	}
+	if r.out != nil {
+		fmt.Fprint(r.out, result.content)
+	}
+	return result, nil
+}
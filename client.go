@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// -timeout: how long a whole request may take, 0 for no limit
+	requestTimeout = 10 * time.Minute
+	// -connect-timeout: how long connecting, and when streaming getting the
+	// response headers, may take
+	connectTimeout = 30 * time.Second
+)
+
+// -proxy: the proxy of API requests, instead of HTTPS_PROXY
+var proxyURL string
+
+// Check -proxy is a URL of a proxy kind the transport speaks
+func checkProxy() error {
+	if proxyURL == "" {
+		return nil
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("-proxy %q is not a URL such as socks5://localhost:1080", proxyURL)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return nil
+	}
+	return fmt.Errorf("-proxy: unsupported scheme %q, use http, https or socks5", u.Scheme)
+}
+
+var (
+	// -cacert: PEM bundle of authorities to trust besides the system's,
+	// e.g. of a TLS-intercepting proxy
+	caCertFile string
+	// -cert and -key: client certificate for gateways wanting mutual TLS
+	certFile, keyFile string
+	// Built from them by loadTLS
+	tlsConfig *tls.Config
+)
+
+// Load -cacert, -cert and -key
+func loadTLS() error {
+	if caCertFile == "" && certFile == "" && keyFile == "" {
+		return nil
+	}
+	config := &tls.Config{}
+	if caCertFile != "" {
+		pem, err := os.ReadFile(caCertFile)
+		if err != nil {
+			return fmt.Errorf("-cacert: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("-cacert: no PEM certificate in %s", caCertFile)
+		}
+		config.RootCAs = pool
+	}
+	if (certFile == "") != (keyFile == "") {
+		return errors.New("-cert and -key go together")
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("loading the client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	tlsConfig = config
+	return nil
+}
+
+// The transport of API requests: with the TLS settings of loadTLS, and
+// through -proxy, except to the hosts of NO_PROXY, or else the proxy of
+// the environment
+func apiTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig.Clone()
+	}
+	if proxyURL == "" {
+		return transport
+	}
+	proxy, err := url.Parse(proxyURL)
+	if err != nil {
+		return transport
+	}
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		if bypassProxy(req.URL) {
+			return nil, nil
+		}
+		return proxy, nil
+	}
+	return transport
+}
+
+// Whether NO_PROXY exempts u from the proxy. Its entries are host names,
+// matching their subdomains too, IP addresses or CIDR ranges, each
+// optionally with a port, or "*" for every host.
+func bypassProxy(u *url.URL) bool {
+	list := os.Getenv("NO_PROXY")
+	if list == "" {
+		list = os.Getenv("no_proxy")
+	}
+	host, port := u.Hostname(), u.Port()
+	ip := net.ParseIP(host)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			if p != port {
+				continue
+			}
+			entry = h
+		}
+		entry = strings.TrimPrefix(entry, "*")
+		name := strings.TrimPrefix(entry, ".")
+		if host == name || strings.HasSuffix(host, "."+name) {
+			return true
+		}
+	}
+	return false
+}
+
+// How long requests other than chats, such as listing the models, may take
+const API_TIMEOUT = 10 * time.Second
+
+var (
+	sharedClient     *http.Client
+	sharedClientOnce sync.Once
+)
+
+// The HTTP client of every API request, so that they share a pool of
+// connections, HTTP/2 when the server offers it and the -connect-timeout
+// of dialing and TLS handshakes. -record, -replay and -debug-dump apply to
+// them all. The time limits of requests are set by sendRequest.
+func apiClient() *http.Client {
+	sharedClientOnce.Do(func() {
+		transport := apiTransport()
+		transport.DialContext = (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext
+		transport.TLSHandshakeTimeout = connectTimeout
+		transport.ForceAttemptHTTP2 = true
+		transport.MaxIdleConnsPerHost = 8
+		var next http.RoundTripper = transport
+		if recordPath != "" {
+			next = &recordTransport{next: next}
+		}
+		if replayPath != "" {
+			next = &replayTransport{}
+		}
+		if debugDumpPath != "" {
+			next = &dumpTransport{next: next}
+		}
+		sharedClient = &http.Client{Transport: next}
+	})
+	return sharedClient
+}
+
+// Send req with apiClient, failing when the whole exchange, body
+// included, takes longer than timeout, or the response headers longer
+// than headerTimeout; 0 for no limit. The body must be closed.
+func sendRequest(req *http.Request, timeout, headerTimeout time.Duration) (*http.Response, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(req.Context(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(req.Context())
+	}
+	var headerTimer *time.Timer
+	if headerTimeout > 0 {
+		headerTimer = time.AfterFunc(headerTimeout, cancel)
+	}
+	resp, err := apiClient().Do(req.WithContext(ctx))
+	if headerTimer != nil && !headerTimer.Stop() {
+		if err == nil {
+			resp.Body.Close()
+		}
+		cancel()
+		return nil, withExitCode(fmt.Errorf("no response within %s (-connect-timeout, 0 for no limit)", headerTimeout), EXIT_NETWORK)
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = cancelOnClose{resp.Body, cancel}
+	return resp, nil
+}
+
+// A response body releasing its request's context once closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// Send a chat request. Without streaming, the headers come only with the
+// whole answer, so just -timeout bounds the wait for them.
+func sendChatRequest(req *http.Request, stream bool) (*http.Response, error) {
+	headerTimeout := time.Duration(0)
+	if stream {
+		headerTimeout = connectTimeout
+	}
+	return sendRequest(req, requestTimeout, headerTimeout)
+}
+
+// Name the timeouts in err when it is one
+func timeoutError(err error) error {
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		return err
+	}
+	return fmt.Errorf("%w (-timeout is %s and -connect-timeout %s, 0 for no limit)", err, requestTimeout, connectTimeout)
+}
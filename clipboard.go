@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Clipboard programs tried in order for each platform
+func clipboardCommands() [][]string {
+	switch runtime.GOOS {
+	case "darwin":
+		return [][]string{{"pbcopy"}}
+	case "windows":
+		return [][]string{{"clip.exe"}, {"powershell.exe", "-NoProfile", "-Command", "$input | Set-Clipboard"}}
+	default:
+		cmds := [][]string{
+			{"xclip", "-selection", "clipboard"},
+			{"xsel", "--clipboard", "--input"},
+		}
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			cmds = append([][]string{{"wl-copy"}}, cmds...)
+		}
+		return cmds
+	}
+}
+
+// Put text on the system clipboard
+func copyToClipboard(text string) error {
+	for _, args := range clipboardCommands() {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		return cmd.Run()
+	}
+	return errors.New("no clipboard utility found (install xclip, xsel or wl-copy)")
+}
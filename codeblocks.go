@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// A fenced code block found in a model response
+type codeBlock struct {
+	lang     string
+	filename string
+	content  string
+}
+
+// File extensions used when a block carries no filename hint
+var langExtensions = map[string]string{
+	"bash":       "sh",
+	"c":          "c",
+	"cpp":        "cpp",
+	"css":        "css",
+	"go":         "go",
+	"html":       "html",
+	"java":       "java",
+	"javascript": "js",
+	"js":         "js",
+	"json":       "json",
+	"makefile":   "mk",
+	"markdown":   "md",
+	"python":     "py",
+	"py":         "py",
+	"ruby":       "rb",
+	"rust":       "rs",
+	"sh":         "sh",
+	"shell":      "sh",
+	"sql":        "sql",
+	"toml":       "toml",
+	"ts":         "ts",
+	"typescript": "ts",
+	"yaml":       "yaml",
+	"yml":        "yml",
+	"zsh":        "sh",
+}
+
+var (
+	filenamePattern    = regexp.MustCompile(`[\w./-]+\.[A-Za-z0-9]+`)
+	filenameCommentRex = regexp.MustCompile(`^\s*(?://|#|--|/\*|<!--)\s*(?:file(?:name)?:\s*)?([\w./-]+\.[A-Za-z0-9]+)\s*(?:\*/|-->)?\s*$`)
+)
+
+// Parse the fenced code blocks of a markdown text. Filenames are taken from
+// the fence info string ("go main.go", "go:main.go", "go title=main.go") or
+// from a leading comment such as "// file: main.go".
+func parseCodeBlocks(text string) []codeBlock {
+	var blocks []codeBlock
+	var current *codeBlock
+	var fence string
+	var body []string
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if current == nil {
+			if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+				fence = trimmed[:3]
+				current = parseFenceInfo(strings.TrimSpace(trimmed[3:]))
+				body = nil
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+			if current.filename == "" && len(body) > 0 {
+				if m := filenameCommentRex.FindStringSubmatch(body[0]); m != nil {
+					current.filename = m[1]
+				}
+			}
+			current.content = strings.Join(body, "\n") + "\n"
+			blocks = append(blocks, *current)
+			current = nil
+			continue
+		}
+		body = append(body, line)
+	}
+	return blocks
+}
+
+func parseFenceInfo(info string) *codeBlock {
+	block := &codeBlock{}
+	fields := strings.Fields(info)
+	if len(fields) == 0 {
+		return block
+	}
+	lang := fields[0]
+	if i := strings.Index(lang, ":"); i >= 0 {
+		block.filename = lang[i+1:]
+		lang = lang[:i]
+	}
+	block.lang = strings.ToLower(lang)
+	for _, field := range fields[1:] {
+		if _, value, ok := strings.Cut(field, "="); ok {
+			field = strings.Trim(value, `"'`)
+		}
+		if block.filename == "" && filenamePattern.MatchString(field) {
+			block.filename = field
+		}
+	}
+	return block
+}
+
+// Write the code blocks of a response into dir and return the created paths.
+// Blocks without a filename hint get one from the prompt when it mentions a
+// file with a matching extension, or a generated snippet_N name otherwise.
+func extractCodeBlocks(response, prompt, dir string) ([]string, error) {
+	blocks := parseCodeBlocks(response)
+	hinted := filenamePattern.FindAllString(prompt, -1)
+	used := make(map[string]bool)
+	for _, block := range blocks {
+		used[block.filename] = true
+	}
+
+	var paths []string
+	for i, block := range blocks {
+		name := block.filename
+		if name == "" {
+			ext := langExtensions[block.lang]
+			for _, hint := range hinted {
+				if !used[hint] && ext != "" && strings.TrimPrefix(filepath.Ext(hint), ".") == ext {
+					name = hint
+					break
+				}
+			}
+			if name == "" {
+				if ext == "" {
+					ext = "txt"
+				}
+				name = fmt.Sprintf("snippet_%d.%s", i+1, ext)
+			}
+			used[name] = true
+		}
+
+		path, err := safeJoin(dir, name)
+		if err != nil {
+			return paths, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return paths, fmt.Errorf("creating directory for %s: %w", path, err)
+		}
+		if err := os.WriteFile(path, []byte(block.content), 0644); err != nil {
+			return paths, fmt.Errorf("writing %s: %w", path, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// Join name onto dir, refusing names that would escape it
+func safeJoin(dir, name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("refusing absolute path %s", name)
+	}
+	path := filepath.Join(dir, name)
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("refusing path outside %s: %s", dir, name)
+	}
+	return path, nil
+}
+
+// The code block of each line, fences included, numbered as parseCodeBlocks
+// numbers them; -1 outside of one
+func fenceLines(lines []string) []int {
+	blocks := make([]int, len(lines))
+	block, fence := -1, ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		blocks[i] = -1
+		switch {
+		case fence == "" && (strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")):
+			block++
+			fence = trimmed[:3]
+			blocks[i] = block
+		case fence != "":
+			blocks[i] = block
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+			}
+		}
+	}
+	return blocks
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// command is a subcommand invoked as `deepseek <name> [args]`
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{}
+
+func registerCommand(cmd command) {
+	commands[cmd.name] = cmd
+}
+
+// Print the usage line of every registered subcommand
+func printCommands(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-30s %s\n", name, commands[name].usage)
+	}
+}
+
+// Return the path of a file inside the data directory, creating the directory if needed
+func dataPath(name string) (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("creating data directory: %w", err)
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// Load a name -> text map stored as JSON in the config directory
+func loadStore(name string) (map[string]string, error) {
+	path, err := configPath(name)
+	if err != nil {
+		return nil, err
+	}
+	store := make(map[string]string)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+	if err := json.Unmarshal(data, &store); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", name, err)
+	}
+	return store, nil
+}
+
+func saveStore(name string, store map[string]string) error {
+	path, err := configPath(name)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(store, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling %s: %w", name, err)
+	}
+	if err := writeFileAtomic(path, data, 0600); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	return nil
+}
+
+// optionalString is a flag that may be given bare (-flag) or with a value (-flag=value)
+type optionalString struct {
+	set   bool
+	value string
+	bare  string
+}
+
+func (o *optionalString) String() string { return o.value }
+
+func (o *optionalString) IsBoolFlag() bool { return true }
+
+func (o *optionalString) Set(value string) error {
+	o.set = value != "false"
+	o.value = value
+	if value == "true" {
+		o.value = o.bare
+	}
+	return nil
+}
+
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// Ask a yes/no question on the terminal, defaulting to no
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := stdinReader.ReadString('\n')
+	if err != nil {
+		fmt.Fprintln(os.Stderr)
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// Parse flags allowing them to appear anywhere among the positional
+// arguments, so `deepseek export <id> --format md` works
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...), nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// stringList is a repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// Build a command running cmdline through the platform shell
+func shellCommand(cmdline string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", cmdline)
+	}
+	return exec.Command("sh", "-c", cmdline)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The model IDs -models listed last, per provider, for tab completion
+const MODELS_CACHE_FILE = "models.json"
+
+// Keep the model IDs of the current provider that -models listed
+func cacheModels(ids []string) {
+	path, err := dataPath(MODELS_CACHE_FILE)
+	if err != nil {
+		return
+	}
+	cache := map[string][]string{}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &cache)
+	}
+	cache[currentProvider.name] = ids
+	if data, err := json.MarshalIndent(cache, "", "  "); err == nil {
+		writeFileAtomic(path, data, 0600)
+	}
+}
+
+// The models known for the current provider: its configured ones and those
+// -models listed last
+func knownModels() []string {
+	models := append([]string{currentProvider.model}, currentProvider.models...)
+	if path, err := dataPath(MODELS_CACHE_FILE); err == nil {
+		if data, err := os.ReadFile(path); err == nil {
+			var cache map[string][]string
+			if json.Unmarshal(data, &cache) == nil {
+				models = append(models, cache[currentProvider.name]...)
+			}
+		}
+	}
+	return models
+}
+
+// Complete the word before pos in line: a slash command, the argument of
+// /model, /chat, /role and /save, or an @file anywhere. It returns where
+// the word starts and what may replace it.
+func (s *replSession) complete(line []rune, pos int) (int, []string) {
+	start := pos
+	for start > 0 && line[start-1] != ' ' {
+		start--
+	}
+	word := string(line[start:pos])
+	if strings.HasPrefix(word, "@") {
+		return start, prefixed("@", completeFiles(word[1:]))
+	}
+	before := strings.Fields(string(line[:start]))
+	if !strings.HasPrefix(string(line), "/") || len(before) > 1 {
+		return start, nil
+	}
+	var words []string
+	if len(before) == 0 {
+		for name := range replCommands {
+			words = append(words, "/"+name)
+		}
+		return start, matching(words, word)
+	}
+	switch before[0] {
+	case "/model":
+		words = knownModels()
+	case "/chat":
+		for id, meta := range chatIndex {
+			if meta.Name != "" {
+				words = append(words, meta.Name)
+			}
+			words = append(words, id)
+		}
+	case "/role":
+		roles, _ := loadRoles()
+		for name := range roles {
+			words = append(words, name)
+		}
+	case "/save":
+		return start, completeFiles(word)
+	}
+	return start, matching(words, word)
+}
+
+// The distinct words starting with prefix, sorted
+func matching(words []string, prefix string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, w := range words {
+		if w != "" && strings.HasPrefix(w, prefix) && !seen[w] {
+			seen[w] = true
+			out = append(out, w)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func prefixed(prefix string, words []string) []string {
+	for i := range words {
+		words[i] = prefix + words[i]
+	}
+	return words
+}
+
+// The paths starting with prefix, directories ending in a slash. Hidden
+// files only show up once their dot is typed.
+func completeFiles(prefix string) []string {
+	dir, base := filepath.Split(prefix)
+	entries, err := os.ReadDir(filepath.Join(".", dir))
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		if entry.IsDir() {
+			name += "/"
+		}
+		out = append(out, dir+name)
+	}
+	return out
+}
+
+// The prompt with the files named by @path words attached before it, as
+// `apply -f` sends them. Other words starting with @ are left alone.
+func attachFiles(prompt string) (string, error) {
+	var files strings.Builder
+	for _, word := range strings.Fields(prompt) {
+		path, ok := strings.CutPrefix(word, "@")
+		if !ok || path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("reading %s: %w", path, err)
+		}
+		fmt.Fprintf(&files, "File: %s\n```\n%s\n```\n\n", path, data)
+	}
+	return files.String() + prompt, nil
+}
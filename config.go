@@ -0,0 +1,437 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	CONFIG_FILE = "config.toml"
+	// Path of a config file to read instead of the default one
+	CONFIG_PATH = "DEEPSEEK_CONFIG"
+	// Prefix of the variables overriding flags, e.g. DEEPSEEK_MODEL for -model
+	ENV_PREFIX = "DEEPSEEK_"
+)
+
+// Settings read from the config file, keyed by their dotted name
+var configValues map[string]any
+
+// Settings whose environment variable takes precedence over the config file
+var configEnv = map[string]string{
+	"role":         ROLE,
+	"history_file": HISTORY_FILE,
+}
+
+// Settings of the config file that don't correspond to a flag
+var configSettings = map[string]func(value string) error{
+	"api_key_cmd": func(value string) error {
+		apiKeyCmd = value
+		return nil
+	},
+	"api_keys": func(value string) error {
+		configuredKeys = splitKeys(value)
+		return nil
+	},
+	"api_key_strategy": func(value string) error {
+		if value != KEYS_FAILOVER && value != KEYS_ROTATE {
+			return fmt.Errorf("use %s or %s", KEYS_FAILOVER, KEYS_ROTATE)
+		}
+		keyStrategy = value
+		return nil
+	},
+}
+
+// The config file: DEEPSEEK_CONFIG, or config.toml in the config directory
+func configFilePath() (string, error) {
+	if path := os.Getenv(CONFIG_PATH); path != "" {
+		return path, nil
+	}
+	return configPath(CONFIG_FILE)
+}
+
+// Read the config file and make its settings the defaults of the flags of
+// fs. A setting named like a flag, with underscores for dashes, sets that
+// flag; flags given on the command line and the environment variables of
+// configEnv still win. A missing config file is not an error.
+func applyConfig(fs *flag.FlagSet) error {
+	path, err := configFilePath()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading config: %w", err)
+	}
+	values, err := parseTOML(string(data))
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	configValues = values
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		// Tables configure features of their own
+		if strings.Contains(key, ".") {
+			continue
+		}
+		if env, ok := configEnv[key]; ok && os.Getenv(env) != "" {
+			continue
+		}
+		value := configString(values[key])
+		name := strings.ReplaceAll(key, "_", "-")
+		if commandLineFlags[name] {
+			errorf("Warning: %s: %s is only taken from the command line, ignoring it\n", path, key)
+			continue
+		}
+		if f := fs.Lookup(name); f != nil {
+			if err := f.Value.Set(value); err != nil {
+				return fmt.Errorf("%s: %s: %v", path, key, err)
+			}
+			f.DefValue = f.Value.String()
+			continue
+		}
+		if set, ok := configSettings[key]; ok {
+			if err := set(value); err != nil {
+				return fmt.Errorf("%s: %s: %v", path, key, err)
+			}
+			continue
+		}
+		errorf("Warning: %s: unknown setting %q\n", path, key)
+	}
+	return nil
+}
+
+// Flags only taken from the command line, neither from the config file
+// nor the environment: actions, and what skips a confirmation or a limit
+var commandLineFlags = map[string]bool{
+	"help": true, "ls": true, "rm": true, "models": true, "status": true,
+	"run": true, "yes": true, "force": true,
+}
+
+// Flags without an environment variable besides commandLineFlags:
+// DEEPSEEK_ROLE may also hold a literal system prompt and is read by
+// resolveRole, and DEEPSEEK_KEY would pass for an API key rather than
+// -key of -cert
+var noEnvFlags = map[string]bool{"role": true, "key": true}
+
+// The environment variable of a flag or setting: ENV_PREFIX and its name
+// in upper case with underscores for dashes
+func envName(name string) string {
+	return ENV_PREFIX + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// Override the defaults of the flags of fs, and the settings of the config
+// file, with the environment variables named by envName. One-letter
+// shorthands have none; their long flags do.
+func applyEnv(fs *flag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || len(f.Name) == 1 || noEnvFlags[f.Name] || commandLineFlags[f.Name] {
+			return
+		}
+		if value := os.Getenv(envName(f.Name)); value != "" {
+			if setErr := f.Value.Set(value); setErr != nil {
+				err = fmt.Errorf("%s: invalid value %q: %v", envName(f.Name), value, setErr)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for key, set := range configSettings {
+		if value := os.Getenv(envName(key)); value != "" {
+			if err := set(value); err != nil {
+				return fmt.Errorf("%s: %v", envName(key), err)
+			}
+		}
+	}
+	return nil
+}
+
+// A config value as flag syntax; arrays become comma-separated lists
+func configString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []any:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = configString(item)
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprint(value)
+}
+
+// Parse the subset of TOML a config file needs: tables, bare, quoted and
+// dotted keys, strings, integers, floats, booleans and arrays of them.
+// Keys of tables are returned prefixed with the table name and a dot.
+func parseTOML(text string) (map[string]any, error) {
+	doc, err := scanTOML(text)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]any, len(doc.entries))
+	for _, entry := range doc.entries {
+		values[entry.key] = entry.value
+	}
+	return values, nil
+}
+
+// A TOML file as lines, with where each setting and table is
+type tomlDoc struct {
+	lines   []string
+	entries []tomlEntry
+	// Line of each table header
+	tables map[string]int
+}
+
+// A setting of a TOML file, spanning lines first to last
+type tomlEntry struct {
+	key         string
+	table       string
+	first, last int
+	value       any
+}
+
+func scanTOML(text string) (tomlDoc, error) {
+	doc := tomlDoc{
+		lines:  strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n"),
+		tables: make(map[string]int),
+	}
+	seen := make(map[string]bool)
+	table := ""
+	for n := 0; n < len(doc.lines); n++ {
+		lineNo := n + 1
+		line := strings.TrimSpace(stripTOMLComment(doc.lines[n]))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return doc, fmt.Errorf("line %d: unsupported table header %s", lineNo, line)
+			}
+			parts, err := parseTOMLKey(line[1 : len(line)-1])
+			if err != nil {
+				return doc, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			table = strings.Join(parts, ".")
+			doc.tables[table] = n
+			continue
+		}
+		rawKey, rawValue, ok := cutTOMLAssignment(line)
+		if !ok {
+			return doc, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		parts, err := parseTOMLKey(rawKey)
+		if err != nil {
+			return doc, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		first := n
+		// Arrays may span lines
+		for strings.HasPrefix(rawValue, "[") && !tomlBalanced(rawValue) && n+1 < len(doc.lines) {
+			n++
+			rawValue += " " + strings.TrimSpace(stripTOMLComment(doc.lines[n]))
+		}
+		value, rest, err := parseTOMLValue(rawValue)
+		if err == nil && strings.TrimSpace(rest) != "" {
+			err = fmt.Errorf("unexpected %q after the value", strings.TrimSpace(rest))
+		}
+		if err != nil {
+			return doc, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		key := strings.Join(parts, ".")
+		if table != "" {
+			key = table + "." + key
+		}
+		if seen[key] {
+			return doc, fmt.Errorf("line %d: %s is set twice", lineNo, key)
+		}
+		seen[key] = true
+		doc.entries = append(doc.entries, tomlEntry{key: key, table: table, first: first, last: n, value: value})
+	}
+	return doc, nil
+}
+
+// The line up to a # that is not inside a string
+func stripTOMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote == 0 && c == '#':
+			return line[:i]
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == '"' && c == '\\':
+			i++
+		case c == quote:
+			quote = 0
+		}
+	}
+	return line
+}
+
+// Split key = value at the first = outside a quoted key
+func cutTOMLAssignment(line string) (string, string, bool) {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote == 0 && c == '=':
+			return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]), true
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case c == quote:
+			quote = 0
+		}
+	}
+	return "", "", false
+}
+
+// Whether the brackets of an array outside strings are closed
+func tomlBalanced(text string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == '"' && c == '\\':
+			i++
+		case c == quote:
+			quote = 0
+		case quote == 0 && c == '[':
+			depth++
+		case quote == 0 && c == ']':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+// The parts of a dotted key, unquoting quoted parts
+func parseTOMLKey(key string) ([]string, error) {
+	var parts []string
+	for rest := strings.TrimSpace(key); ; {
+		var part string
+		if rest == "" {
+			return nil, fmt.Errorf("invalid key %q", key)
+		}
+		if rest[0] == '"' || rest[0] == '\'' {
+			value, after, err := parseTOMLValue(rest)
+			if err != nil {
+				return nil, fmt.Errorf("invalid key %q", key)
+			}
+			part, rest = value.(string), strings.TrimSpace(after)
+		} else {
+			end := strings.IndexByte(rest, '.')
+			if end < 0 {
+				end = len(rest)
+			}
+			part, rest = strings.TrimSpace(rest[:end]), rest[end:]
+			for _, r := range part {
+				if !(r == '_' || r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+					return nil, fmt.Errorf("invalid key %q", key)
+				}
+			}
+			if part == "" {
+				return nil, fmt.Errorf("invalid key %q", key)
+			}
+		}
+		parts = append(parts, part)
+		if rest == "" {
+			return parts, nil
+		}
+		if rest[0] != '.' {
+			return nil, fmt.Errorf("invalid key %q", key)
+		}
+		rest = strings.TrimSpace(rest[1:])
+	}
+}
+
+// Parse the value at the start of text, returning what follows it
+func parseTOMLValue(text string) (any, string, error) {
+	text = strings.TrimSpace(text)
+	switch {
+	case text == "":
+		return nil, "", errors.New("missing value")
+	case strings.HasPrefix(text, `"""`) || strings.HasPrefix(text, "'''"):
+		return nil, "", errors.New("multi-line strings are not supported")
+	case text[0] == '"':
+		for i := 1; i < len(text); i++ {
+			switch text[i] {
+			case '\\':
+				i++
+			case '"':
+				s, err := strconv.Unquote(text[:i+1])
+				if err != nil {
+					return nil, "", fmt.Errorf("invalid string %s", text[:i+1])
+				}
+				return s, text[i+1:], nil
+			}
+		}
+		return nil, "", errors.New("unterminated string")
+	case text[0] == '\'':
+		end := strings.IndexByte(text[1:], '\'')
+		if end < 0 {
+			return nil, "", errors.New("unterminated string")
+		}
+		return text[1 : end+1], text[end+2:], nil
+	case text[0] == '[':
+		items := []any{}
+		rest := strings.TrimSpace(text[1:])
+		for {
+			if strings.HasPrefix(rest, "]") {
+				return items, rest[1:], nil
+			}
+			item, after, err := parseTOMLValue(rest)
+			if err != nil {
+				return nil, "", err
+			}
+			items = append(items, item)
+			rest = strings.TrimSpace(after)
+			if strings.HasPrefix(rest, ",") {
+				rest = strings.TrimSpace(rest[1:])
+			} else if !strings.HasPrefix(rest, "]") {
+				return nil, "", errors.New("expected , or ] in array")
+			}
+		}
+	case text[0] == '{':
+		return nil, "", errors.New("inline tables are not supported, use a [table]")
+	}
+
+	end := strings.IndexAny(text, ",] \t")
+	if end < 0 {
+		end = len(text)
+	}
+	word, rest := text[:end], text[end:]
+	switch word {
+	case "true":
+		return true, rest, nil
+	case "false":
+		return false, rest, nil
+	}
+	number := strings.ReplaceAll(word, "_", "")
+	base := 10
+	if len(number) > 2 && number[0] == '0' && strings.ContainsRune("xob", rune(number[1])) {
+		base = 0
+	}
+	if i, err := strconv.ParseInt(number, base, 64); err == nil {
+		return i, rest, nil
+	}
+	if f, err := strconv.ParseFloat(number, 64); err == nil {
+		return f, rest, nil
+	}
+	return nil, "", fmt.Errorf("invalid value %q", word)
+}
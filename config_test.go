@@ -0,0 +1,87 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    map[string]any
+		wantErr bool
+	}{
+		{
+			name: "scalars",
+			text: "model = \"deepseek-reasoner\"\ntemperature = 0.3\nmemory = 20\nno_wrap = true\n",
+			want: map[string]any{"model": "deepseek-reasoner", "temperature": 0.3, "memory": int64(20), "no_wrap": true},
+		},
+		{
+			name: "comments and literal strings",
+			text: "# settings\nrole = 'reviewer' # inline\nbase_url = \"https://x/#frag\"\n",
+			want: map[string]any{"role": "reviewer", "base_url": "https://x/#frag"},
+		},
+		{
+			name: "escapes and numbers",
+			text: "prompt = \"a\\\"b\\n\"\nbig = 1_000\nhex = 0x1f\n",
+			want: map[string]any{"prompt": "a\"b\n", "big": int64(1000), "hex": int64(31)},
+		},
+		{
+			name: "arrays across lines",
+			text: "api_keys = [\n  \"sk-1\", # first\n  \"sk-2\",\n]\n",
+			want: map[string]any{"api_keys": []any{"sk-1", "sk-2"}},
+		},
+		{
+			name: "tables and dotted keys",
+			text: "[providers.local]\nbase_url = \"http://localhost:11434\"\n\"key env\" = \"X\"\n[theme]\nname = \"light\"\n",
+			want: map[string]any{
+				"providers.local.base_url": "http://localhost:11434",
+				"providers.local.key env":  "X",
+				"theme.name":               "light",
+			},
+		},
+		{name: "missing value", text: "model =\n", wantErr: true},
+		{name: "no assignment", text: "model\n", wantErr: true},
+		{name: "set twice", text: "a = 1\na = 2\n", wantErr: true},
+		{name: "trailing garbage", text: "a = 1 2\n", wantErr: true},
+		{name: "unterminated string", text: "a = \"x\n", wantErr: true},
+		{name: "inline table", text: "a = {b = 1}\n", wantErr: true},
+		{name: "array of tables", text: "[[a]]\n", wantErr: true},
+		{name: "invalid key", text: "a b = 1\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseTOML(tt.text)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: parseTOML error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parseTOML = %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFormatTOMLValue(t *testing.T) {
+	tests := []struct {
+		value any
+		want  string
+	}{
+		{"a\"b", `"a\"b"`},
+		{int64(3), "3"},
+		{2.0, "2.0"},
+		{0.5, "0.5"},
+		{true, "true"},
+		{[]any{"x", int64(1)}, `["x", 1]`},
+	}
+	for _, tt := range tests {
+		got := formatTOMLValue(tt.value)
+		if got != tt.want {
+			t.Errorf("formatTOMLValue(%#v) = %s, want %s", tt.value, got, tt.want)
+		}
+		// What is written reads back the same
+		if back, rest, err := parseTOMLValue(got); err != nil || rest != "" || !reflect.DeepEqual(back, tt.value) {
+			t.Errorf("parseTOMLValue(%s) = %#v, %q, %v", got, back, rest, err)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerCommand(command{
+		name:  "config",
+		usage: "get <key> | set <key> <value> | unset <key> | list | path  read and change config.toml",
+		run:   runConfig,
+	})
+}
+
+func runConfig(args []string) error {
+	usage := errors.New("usage: deepseek config get <key> | set <key> <value> | unset <key> | list | path")
+	if len(args) == 0 {
+		return usage
+	}
+	path, err := configFilePath()
+	if err != nil {
+		return err
+	}
+	switch {
+	case args[0] == "path" && len(args) == 1:
+		fmt.Println(path)
+		return nil
+	case args[0] == "list" && len(args) == 1:
+		doc, err := readConfigDoc(path)
+		if err != nil {
+			return err
+		}
+		for _, entry := range doc.entries {
+			fmt.Printf("%s = %s\n", entry.key, formatTOMLValue(entry.value))
+		}
+		return nil
+	case args[0] == "get" && len(args) == 2:
+		doc, err := readConfigDoc(path)
+		if err != nil {
+			return err
+		}
+		for _, entry := range doc.entries {
+			if entry.key == args[1] {
+				fmt.Println(configString(entry.value))
+				return nil
+			}
+		}
+		return fmt.Errorf("%s is not set in %s", args[1], path)
+	case args[0] == "set" && len(args) >= 3:
+		literal, err := configLiteral(args[1], strings.Join(args[2:], " "))
+		if err != nil {
+			return err
+		}
+		return editConfig(path, args[1], literal)
+	case args[0] == "unset" && len(args) == 2:
+		return editConfig(path, args[1], "")
+	}
+	return usage
+}
+
+// Read the config file, an empty one when it doesn't exist yet
+func readConfigDoc(path string) (tomlDoc, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return tomlDoc{}, fmt.Errorf("reading config: %w", err)
+	}
+	doc, err := scanTOML(string(data))
+	if err != nil {
+		return doc, fmt.Errorf("%s: %w", path, err)
+	}
+	return doc, nil
+}
+
+// The TOML literal to store for the setting, checked against the flag or
+// setting it configures. Keys of tables hold whatever their feature reads,
+// so their values are taken as TOML when they parse as such.
+func configLiteral(key, value string) (string, error) {
+	if strings.Contains(key, ".") {
+		if _, err := parseTOMLKey(key); err != nil {
+			return "", err
+		}
+		if v, rest, err := parseTOMLValue(value); err == nil && strings.TrimSpace(rest) == "" {
+			return formatTOMLValue(v), nil
+		}
+		return strconv.Quote(value), nil
+	}
+	if set, ok := configSettings[key]; ok {
+		if err := set(value); err != nil {
+			return "", fmt.Errorf("%s: %v", key, err)
+		}
+		return strconv.Quote(value), nil
+	}
+	name := strings.ReplaceAll(key, "_", "-")
+	if commandLineFlags[name] {
+		return "", fmt.Errorf("%s is only taken from the command line", key)
+	}
+	// Stored as the mTLS key of -cert, where an API key would end up
+	if name == "key" {
+		return "", errors.New("key is the private key file of -cert, not an API key: set api_keys or run `deepseek auth login`, or edit the config file for -key")
+	}
+	f := flag.CommandLine.Lookup(name)
+	if f == nil || strings.Contains(key, "-") {
+		return "", fmt.Errorf("unknown setting %q, use the name of a flag with underscores for dashes", key)
+	}
+	getter, ok := f.Value.(flag.Getter)
+	if !ok {
+		return strconv.Quote(value), nil
+	}
+	switch getter.Get().(type) {
+	case bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("%s takes true or false", key)
+		}
+		return strconv.FormatBool(b), nil
+	case int, int64, uint, uint64:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return "", fmt.Errorf("%s takes a whole number", key)
+		}
+		return value, nil
+	case float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "", fmt.Errorf("%s takes a number", key)
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case time.Duration:
+		if _, err := time.ParseDuration(value); err != nil {
+			return "", fmt.Errorf("%s takes a duration such as 2s", key)
+		}
+	}
+	return strconv.Quote(value), nil
+}
+
+// Set key to the TOML literal in the config file, or remove it when the
+// literal is empty, keeping the rest of the file and its comments as they
+// are. The file is locked across the read and the write.
+func editConfig(path, key, literal string) error {
+	unlock, err := lockPath(path+".lock", "config")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	doc, err := readConfigDoc(path)
+	if err != nil {
+		return err
+	}
+	table, name := "", key
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		table, name = key[:i], key[i+1:]
+	}
+	if strings.ContainsAny(name, " \t\"'") {
+		name = strconv.Quote(name)
+	}
+	line := name + " = " + literal
+
+	lines := doc.lines
+	edited := false
+	for _, entry := range doc.entries {
+		if entry.key != key {
+			continue
+		}
+		replacement := []string{line}
+		if literal == "" {
+			replacement = nil
+		}
+		lines = append(lines[:entry.first:entry.first], append(replacement, lines[entry.last+1:]...)...)
+		edited = true
+		break
+	}
+	switch {
+	case !edited && literal == "":
+		return fmt.Errorf("%s is not set in %s", key, path)
+	case !edited:
+		lines = insertConfigLine(doc, table, line)
+	}
+
+	text := strings.TrimRight(strings.Join(lines, "\n"), "\n") + "\n"
+	if strings.TrimSpace(text) == "" {
+		text = ""
+	}
+	// Never leave behind a file the next run can't read
+	if _, err := scanTOML(text); err != nil {
+		return fmt.Errorf("updating %s: %w", path, err)
+	}
+	if err := writeFileAtomic(path, []byte(text), 0600); err != nil {
+		return fmt.Errorf("writing config: %w", err)
+	}
+	return nil
+}
+
+// The lines of doc with a new setting added after the last one of its
+// table, creating the table when needed. Top-level settings go before the
+// first table.
+func insertConfigLine(doc tomlDoc, table, line string) []string {
+	lines := doc.lines
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	header, ok := doc.tables[table]
+	if table != "" && !ok {
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		return append(lines, "["+table+"]", line)
+	}
+	at := header + 1
+	if table == "" {
+		at = len(lines)
+		for _, n := range doc.tables {
+			at = min(at, n)
+		}
+	}
+	for _, entry := range doc.entries {
+		if entry.table == table {
+			at = entry.last + 1
+		}
+	}
+	at = min(at, len(lines))
+	return append(lines[:at:at], append([]string{line}, lines[at:]...)...)
+}
+
+// A value in TOML syntax
+func formatTOMLValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = formatTOMLValue(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case float64:
+		s := strconv.FormatFloat(v, 'f', -1, 64)
+		if !strings.ContainsAny(s, ".eE") {
+			s += ".0"
+		}
+		return s
+	}
+	return fmt.Sprint(value)
+}
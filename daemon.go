@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	// The socket a daemon listens on, in the runtime directory, and its
+	// log, in the data directory
+	DAEMON_SOCKET = "daemon.sock"
+	DAEMON_LOG    = "daemon.log"
+	// How long a daemon keeps its API connection open after a prompt
+	DAEMON_WARM = 30 * time.Minute
+)
+
+func init() {
+	registerCommand(command{
+		name:  "daemon",
+		usage: "start|stop|status|run  keep the history loaded and the API connection warm in the background, for faster prompts",
+		run:   runDaemonCommand,
+	})
+}
+
+// Flags a daemon takes along with a prompt; with others the prompt is sent
+// as usual. The config and the environment are the daemon's own, those of
+// when it started.
+var daemonFlags = map[string]bool{"chat": true, "new": true, "role": true, "model": true, "temperature": true, "memory": true, "q": true, "no-wrap": true}
+
+// The defaults of the flags before the config and the environment change
+// them: askDaemon leaves invocations setting other flags anywhere to the
+// usual path
+var flagDefaults = map[string]string{}
+
+// GET /api/status of a daemon
+type daemonStatus struct {
+	PID      int       `json:"pid"`
+	Started  time.Time `json:"started"`
+	Provider string    `json:"provider"`
+	Chats    int       `json:"chats"`
+}
+
+// The path of the daemon's socket: in $XDG_RUNTIME_DIR, private to the
+// user and emptied on logout, or the data directory without one
+func daemonSocket() (string, error) {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); filepath.IsAbs(dir) {
+		dir = filepath.Join(dir, APP_DIR)
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return "", fmt.Errorf("creating runtime directory: %w", err)
+		}
+		return filepath.Join(dir, DAEMON_SOCKET), nil
+	}
+	return dataPath(DAEMON_SOCKET)
+}
+
+func runDaemonCommand(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: deepseek daemon start|stop|status|run")
+	}
+	path, err := daemonSocket()
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "start":
+		return startDaemon(path)
+	case "stop":
+		return stopDaemon(path)
+	case "status":
+		status, err := fetchDaemonStatus(path)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Running, pid %d, up %s, provider %s, %d chats\n", status.PID, time.Since(status.Started).Round(time.Second), status.Provider, status.Chats)
+		return nil
+	case "run":
+		return runDaemon(path)
+	}
+	return errors.New("usage: deepseek daemon start|stop|status|run")
+}
+
+// A client of the daemon listening on path
+func daemonClient(path string, timeout time.Duration) *http.Client {
+	var dialer net.Dialer
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+}
+
+// The error a daemon answered with
+func daemonError(resp *http.Response) error {
+	var body struct {
+		Error string `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	return errors.New(body.Error)
+}
+
+// Send a request to a daemon, with a JSON body unless nil
+func daemonRequest(ctx context.Context, client *http.Client, method, endpoint string, body any) (*http.Response, error) {
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, "http://daemon"+endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return client.Do(req)
+}
+
+// The status of the daemon at path, an error when none answers
+func fetchDaemonStatus(path string) (daemonStatus, error) {
+	var status daemonStatus
+	resp, err := daemonRequest(context.Background(), daemonClient(path, time.Second), http.MethodGet, "/api/status", nil)
+	if err != nil {
+		return status, errors.New("no daemon is running, `deepseek daemon start` starts one")
+	}
+	defer resp.Body.Close()
+	return status, json.NewDecoder(resp.Body).Decode(&status)
+}
+
+// Start a daemon in the background with the flags of this invocation,
+// waiting until it answers
+func startDaemon(path string) error {
+	if status, err := fetchDaemonStatus(path); err == nil {
+		infof("A daemon is already running, pid %d\n", status.PID)
+		return nil
+	}
+	// A missing key is reported here rather than in the log
+	if _, err := loadAPIKey(); err != nil {
+		return err
+	}
+	logPath, err := dataPath(DAEMON_LOG)
+	if err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	flags := os.Args[1 : len(os.Args)-flag.NArg()]
+	cmd := exec.Command(exe, append(flags, "daemon", "run")...)
+	cmd.Stdout, cmd.Stderr = logFile, logFile
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		select {
+		case <-exited:
+			return fmt.Errorf("the daemon failed to start, see %s", logPath)
+		case <-time.After(50 * time.Millisecond):
+		}
+		if status, err := fetchDaemonStatus(path); err == nil {
+			infof("Daemon started, pid %d\n", status.PID)
+			return nil
+		}
+	}
+	return fmt.Errorf("the daemon doesn't answer, see %s", logPath)
+}
+
+// Ask the daemon to stop once the answers it is streaming are done
+func stopDaemon(path string) error {
+	resp, err := daemonRequest(context.Background(), daemonClient(path, time.Second), http.MethodPost, "/api/shutdown", nil)
+	if err != nil {
+		return errors.New("no daemon is running")
+	}
+	resp.Body.Close()
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if _, err := fetchDaemonStatus(path); err != nil {
+			infof("Daemon stopped\n")
+			return nil
+		}
+	}
+	return errors.New("the daemon is still running")
+}
+
+// Serve the REST API of serve on the socket at path, along with the status
+// and shutdown of the daemon, until stopped
+func runDaemon(path string) error {
+	if _, err := loadAPIKey(); err != nil {
+		return err
+	}
+	if _, err := fetchDaemonStatus(path); err == nil {
+		return errors.New("a daemon is already running")
+	}
+	// The socket of a daemon that didn't stop cleanly
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return err
+	}
+	// Closing the terminal it was started from doesn't stop it
+	signal.Ignore(syscall.SIGHUP)
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	started := time.Now()
+	var lastPrompt atomic.Int64
+	lastPrompt.Store(started.UnixNano())
+	s := &apiServer{}
+	mux := http.NewServeMux()
+	s.routes(mux)
+	mux.HandleFunc("/api/status", func(w http.ResponseWriter, r *http.Request) {
+		index, err := indexSnapshot()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, daemonStatus{PID: os.Getpid(), Started: started, Provider: currentProvider.name, Chats: len(index)})
+	})
+	mux.HandleFunc("/api/shutdown", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, "POST")
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		stop()
+	})
+	handler := s.authorize(mux)
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/status" {
+				lastPrompt.Store(time.Now().UnixNano())
+			}
+			handler.ServeHTTP(w, r)
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go keepWarm(ctx, &lastPrompt)
+	infof("%s Daemon %d listening on %s\n", started.Format(time.RFC3339), os.Getpid(), path)
+	err = serveUntilDone(ctx, server, listener)
+	infof("%s Daemon %d stopped\n", time.Now().Format(time.RFC3339), os.Getpid())
+	return err
+}
+
+// Keep a connection to the API open while prompts came in lately, the
+// idle ones of the client closing after a minute and a half
+func keepWarm(ctx context.Context, lastPrompt *atomic.Int64) {
+	// A cassette would record the requests, or miss them
+	if recordPath != "" || replayPath != "" {
+		return
+	}
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		if time.Since(time.Unix(0, lastPrompt.Load())) < DAEMON_WARM {
+			warmConnection(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// List the models, leaving the connection open for the next prompt
+func warmConnection(ctx context.Context) {
+	apiKey, err := loadAPIKey()
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, openAIURL("models"), nil)
+	if err != nil {
+		return
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	prepareRequest(req)
+	resp, err := apiClient().Do(req)
+	if err != nil {
+		if *debug {
+			errorf("Warming the API connection: %v\n", err)
+		}
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+// Send the prompt of a plain invocation to a running daemon, printing the
+// answer as it streams. False when no daemon answers, or the invocation
+// sets flags it doesn't take; the prompt is then sent as usual.
+func askDaemon(req promptRequest, wrap bool) bool {
+	plain := true
+	flag.VisitAll(func(f *flag.Flag) {
+		plain = plain && (daemonFlags[f.Name] || f.Value.String() == flagDefaults[f.Name])
+	})
+	if !plain {
+		return false
+	}
+	path, err := daemonSocket()
+	if err != nil {
+		return false
+	}
+	conn, err := net.DialTimeout("unix", path, 100*time.Millisecond)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+
+	// Ctrl-C stops the answer, the daemon keeping what arrived so far
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	resp, err := daemonRequest(ctx, daemonClient(path, 0), http.MethodPost, "/api/prompt", req)
+	if err != nil {
+		if ctx.Err() == nil {
+			return false
+		}
+		setExitStatus(EXIT_INTERRUPTED)
+		return true
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fail(fmt.Errorf("daemon: %w", daemonError(resp)))
+		return true
+	}
+
+	last := printAnswerStream(resp.Body, wrap)
+	if ctx.Err() != nil {
+		infof("Interrupted, the partial answer is kept, `deepseek resume` continues it\n")
+		setExitStatus(EXIT_INTERRUPTED)
+		return true
+	}
+	reportAnswer(last)
+	return true
+}
+
+// Print the deltas of an answer streaming from a daemon as server-sent
+// events, soft-wrapped on a terminal, returning the done or error event
+// it ends with
+func printAnswerStream(body io.Reader, wrap bool) streamEvent {
+	var out io.Writer = os.Stdout
+	var wrapper *wrapWriter
+	if wrap && isTerminal(os.Stdout) {
+		width, _, _ := terminalSize(os.Stdout)
+		wrapper = newWrapWriter(os.Stdout, width)
+		stopResize := watchResize(os.Stdout, wrapper.setWidth)
+		defer stopResize()
+		out = wrapper
+	}
+	var last streamEvent
+	events := newSSEReader(body, nil)
+	for last.Type != "done" && last.Type != "error" {
+		data, err := events.next()
+		if err != nil {
+			last = streamEvent{Type: "error", Error: "the daemon went away: " + err.Error(), Code: EXIT_NETWORK}
+			break
+		}
+		last = streamEvent{}
+		if json.Unmarshal([]byte(data), &last) == nil && last.Type == "delta" {
+			fmt.Fprint(out, last.Content)
+		}
+	}
+	if wrapper != nil {
+		wrapper.Flush()
+	}
+	fmt.Fprintln(out)
+	return last
+}
+
+// Report how an answer streamed from a daemon ended, as the CLI does
+func reportAnswer(last streamEvent) {
+	switch {
+	case last.Type == "error":
+		errorf("\nError: %s\n", last.Error)
+		setExitStatus(max(last.Code, EXIT_ERROR))
+	case last.Finish == "content_filter":
+		errorf("The answer was cut short by the content filter\n")
+		setExitStatus(EXIT_CONTENT_FILTER)
+	}
+}
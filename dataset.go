@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// An importer converts the file or directory at path into chats
+type importer func(path string) ([]Chat, error)
+
+var importers = map[string]importer{
+	"openai":   fileImporter(importOpenAI),
+	"sharegpt": fileImporter(importShareGPT),
+	"aichat":   importAichat,
+	"sgpt":     importSgpt,
+	"llm":      importLLM,
+	"rotated":  importRotated,
+}
+
+// Adapt a parser of file contents to an importer
+func fileImporter(parse func(data []byte) ([]Chat, error)) importer {
+	return func(path string) ([]Chat, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return parse(data)
+	}
+}
+
+func init() {
+	registerCommand(command{
+		name:  "import",
+		usage: "[-from openai|sharegpt|aichat|sgpt|llm|rotated] <path>  import chats, printing their new ids",
+		run:   runImport,
+	})
+}
+
+// A ShareGPT conversation turn
+type shareGPTTurn struct {
+	From  string `json:"from"`
+	Value string `json:"value"`
+}
+
+type shareGPTChat struct {
+	ID            string         `json:"id,omitempty"`
+	Conversations []shareGPTTurn `json:"conversations"`
+}
+
+var shareGPTRoles = map[string]string{
+	"system":    "system",
+	"human":     "user",
+	"user":      "user",
+	"gpt":       "assistant",
+	"assistant": "assistant",
+}
+
+// Write one `{"messages": [...]}` line per chat, the layout used by OpenAI
+// fine-tuning datasets
+func exportOpenAI(w io.Writer, chats []namedChat) error {
+	enc := json.NewEncoder(w)
+	for _, c := range chats {
+		record := struct {
+			Messages []apiMessage `json:"messages"`
+		}{toAPIMessages(datasetMessages(c.chat))}
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write the chats as a ShareGPT JSON array
+func exportShareGPT(w io.Writer, chats []namedChat) error {
+	records := make([]shareGPTChat, 0, len(chats))
+	for _, c := range chats {
+		record := shareGPTChat{ID: c.id}
+		for _, msg := range datasetMessages(c.chat) {
+			from := map[string]string{"system": "system", "user": "human", "assistant": "gpt"}[msg.Role]
+			record.Conversations = append(record.Conversations, shareGPTTurn{From: from, Value: msg.Content})
+		}
+		records = append(records, record)
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// Messages of a chat with the roles datasets understand
+func datasetMessages(chat Chat) []Message {
+	messages := make([]Message, 0, len(chat.Messages))
+	for _, msg := range chat.Messages {
+		switch msg.Role {
+		case "system", "user", "assistant":
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// Read OpenAI-style JSONL: one `{"messages": [...]}` object per line.
+// Content given as an array of parts keeps only the text parts.
+func importOpenAI(data []byte) ([]Chat, error) {
+	var chats []Chat
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var record struct {
+			Messages []struct {
+				Role    string          `json:"role"`
+				Content json.RawMessage `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		chat := Chat{CreatedAt: time.Now()}
+		for _, msg := range record.Messages {
+			chat.Messages = append(chat.Messages, Message{Role: msg.Role, Content: contentText(msg.Content)})
+		}
+		chats = append(chats, chat)
+	}
+	return chats, scanner.Err()
+}
+
+func contentText(raw json.RawMessage) string {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	json.Unmarshal(raw, &parts)
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// Read ShareGPT JSON, either an array of conversations or one per line
+func importShareGPT(data []byte) ([]Chat, error) {
+	var records []shareGPTChat
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &records); err != nil {
+			return nil, err
+		}
+	} else {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		for {
+			var record shareGPTChat
+			if err := dec.Decode(&record); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			records = append(records, record)
+		}
+	}
+
+	chats := make([]Chat, 0, len(records))
+	for _, record := range records {
+		chat := Chat{CreatedAt: time.Now()}
+		for _, turn := range record.Conversations {
+			role, ok := shareGPTRoles[turn.From]
+			if !ok {
+				return nil, fmt.Errorf("unknown ShareGPT speaker %q", turn.From)
+			}
+			chat.Messages = append(chat.Messages, Message{Role: role, Content: turn.Value})
+		}
+		chats = append(chats, chat)
+	}
+	return chats, nil
+}
+
+// Guess the format of a file from its first character
+func detectImportFormat(data []byte) string {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		return "sharegpt"
+	}
+	if bytes.Contains(data, []byte(`"conversations"`)) {
+		return "sharegpt"
+	}
+	return "openai"
+}
+
+func importFormats() []string {
+	formats := make([]string, 0, len(importers))
+	for name := range importers {
+		formats = append(formats, name)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	from := fs.String("from", "", "Format of the file: "+strings.Join(importFormats(), ", ")+" (detected when omitted)")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("usage: deepseek import [-from %s] <path>", strings.Join(importFormats(), "|"))
+	}
+	if *from == "" {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return fmt.Errorf("%w (use -from for other tools' history)", err)
+		}
+		*from = detectImportFormat(data)
+	}
+	convert, ok := importers[*from]
+	if !ok {
+		return fmt.Errorf("unknown import format %q (valid: %s)", *from, strings.Join(importFormats(), ", "))
+	}
+	chats, err := convert(args[0])
+	if err != nil {
+		return fmt.Errorf("reading %s as %s: %w", args[0], *from, err)
+	}
+	if len(chats) == 0 {
+		return errors.New("no chats found")
+	}
+
+	return withHistoryLock(func() error {
+		for _, chat := range chats {
+			id := generateChatID()
+			if err := writeChatFile(id, chat); err != nil {
+				return err
+			}
+			chatIndex[id] = metaFor(chat)
+			fmt.Println(id)
+		}
+		infof("Imported %d chat(s) from %s\n", len(chats), args[0])
+		return nil
+	})
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"time"
+)
+
+func init() {
+	registerCommand(command{
+		name:  "dedupe",
+		usage: "[-dry-run]  remove chats without answers and merge duplicated conversations",
+		run:   runDedupe,
+	})
+}
+
+// One chat removed by dedupe; into is the chat it was merged into, empty
+// when it was removed for having no answer
+type dedupeAction struct {
+	id   string
+	into string
+	meta ChatMeta
+}
+
+func runDedupe(args []string) error {
+	fs := flag.NewFlagSet("dedupe", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "List what would be cleaned without changing anything")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return errors.New("usage: deepseek dedupe [-dry-run]")
+	}
+
+	actions, err := dedupeCandidates()
+	if err != nil {
+		return err
+	}
+	if len(actions) == 0 {
+		infof("Nothing to clean.\n")
+		return nil
+	}
+	for _, a := range actions {
+		if a.into == "" {
+			fmt.Printf("remove %-22s %s  %s (no answer)\n", a.id, a.meta.UpdatedAt.Local().Format(time.DateTime), summarize(a.meta.LastUserMessage, 40))
+		} else {
+			fmt.Printf("merge  %-22s into %s\n", a.id, a.into)
+		}
+	}
+	if *dryRun {
+		infof("%d chat(s) would be removed.\n", len(actions))
+		return nil
+	}
+	if !*assumeYes && !confirm(fmt.Sprintf("Remove these %d chat(s)?", len(actions))) {
+		return nil
+	}
+
+	return withHistoryLock(func() error {
+		autoBackup("dedupe")
+		empty, merged := 0, 0
+		for _, a := range actions {
+			// Spare chats used since they were listed
+			current, ok := chatIndex[a.id]
+			if !ok || !current.UpdatedAt.Equal(a.meta.UpdatedAt) {
+				continue
+			}
+			if a.into != "" {
+				if _, ok := chatIndex[a.into]; !ok {
+					continue
+				}
+				// Named, tagged or pinned since it was listed, which keeps
+				// the time it was last used
+				if err := mergeDuplicate(a.into, current); err != nil {
+					return err
+				}
+			}
+			wasLast := lastChatID == a.id
+			if err := deleteChat(a.id); err != nil {
+				return err
+			}
+			if a.into != "" {
+				if wasLast {
+					lastChatID = a.into
+				}
+				merged++
+			} else {
+				empty++
+			}
+		}
+		infof("Removed %d chat(s) without answers and merged %d duplicate(s).\n", empty, merged)
+		return nil
+	})
+}
+
+// Find the chats that have no assistant message, and the exact duplicates
+// of another chat. Of a group of duplicates, a pinned, archived or named
+// chat is kept before the most recently used one. Pinned, archived and
+// named chats are never removed for being empty.
+func dedupeCandidates() ([]dedupeAction, error) {
+	groups := make(map[string][]string)
+	var actions []dedupeAction
+	for id, meta := range chatIndex {
+		chat, exists, err := loadChat(id)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+		answered := false
+		for _, msg := range chat.Messages {
+			answered = answered || msg.Role == "assistant"
+		}
+		if !answered {
+			if !meta.Pinned && !meta.Archived && meta.Name == "" {
+				actions = append(actions, dedupeAction{id: id, meta: meta})
+			}
+			continue
+		}
+		key := conversationKey(chat.Messages)
+		groups[key] = append(groups[key], id)
+	}
+
+	rank := func(meta ChatMeta) int {
+		switch {
+		case meta.Pinned:
+			return 3
+		case meta.Archived:
+			return 2
+		case meta.Name != "":
+			return 1
+		}
+		return 0
+	}
+	for _, ids := range groups {
+		if len(ids) < 2 {
+			continue
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			a, b := chatIndex[ids[i]], chatIndex[ids[j]]
+			if rank(a) != rank(b) {
+				return rank(a) > rank(b)
+			}
+			return a.UpdatedAt.After(b.UpdatedAt)
+		})
+		for _, id := range ids[1:] {
+			actions = append(actions, dedupeAction{id: id, into: ids[0], meta: chatIndex[id]})
+		}
+	}
+	sort.Slice(actions, func(i, j int) bool { return actions[i].meta.UpdatedAt.Before(actions[j].meta.UpdatedAt) })
+	return actions, nil
+}
+
+// A digest of the roles and contents of the messages, the same for chats
+// holding the same conversation
+func conversationKey(messages []Message) string {
+	h := sha256.New()
+	enc := json.NewEncoder(h)
+	for _, msg := range messages {
+		enc.Encode([2]string{msg.Role, msg.Content})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Carry over what the duplicate adds to the chat kept in its place: its
+// tags, its name and title when the kept chat has none, and pinning
+func mergeDuplicate(into string, dup ChatMeta) error {
+	chat, exists, err := loadChat(into)
+	if err != nil || !exists {
+		return err
+	}
+	for _, tag := range dup.Tags {
+		if !hasTag(chat.Tags, tag) {
+			chat.Tags = append(chat.Tags, tag)
+		}
+	}
+	if chat.Name == "" {
+		chat.Name = dup.Name
+	}
+	if chat.Title == "" {
+		chat.Title = dup.Title
+	}
+	chat.Pinned = chat.Pinned || dup.Pinned
+	if err := writeChatFile(into, chat); err != nil {
+		return err
+	}
+	indexChat(into, chat, false)
+	return nil
+}
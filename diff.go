@@ -0,0 +1,89 @@
+package main
+
+import "fmt"
+
+// Compute the line diff between a and b as unified diff hunks with the given
+// number of context lines. Uses a longest common subsequence table, which is
+// plenty for source files sent to the model.
+func diffLines(a, b []string, context int) []hunk {
+	n, m := len(a), len(b)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	// Walk the table producing one edit line per step
+	type edit struct {
+		op   byte
+		text string
+		oldN int
+		newN int
+	}
+	var edits []edit
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i], i, j})
+			i++
+			j++
+		case i < n && (j == m || lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{'-', a[i], i, j})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j], i, j})
+			j++
+		}
+	}
+
+	// Group changes that are within 2*context lines of each other
+	var hunks []hunk
+	for k := 0; k < len(edits); {
+		if edits[k].op == ' ' {
+			k++
+			continue
+		}
+		start := max(k-context, 0)
+		end := k
+		for end < len(edits) {
+			if edits[end].op != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(edits) && edits[run].op == ' ' {
+				run++
+			}
+			if run == len(edits) || run-end > 2*context {
+				end = min(end+context, len(edits))
+				break
+			}
+			end = run
+		}
+
+		h := hunk{oldStart: edits[start].oldN + 1}
+		oldCount, newCount := 0, 0
+		for _, e := range edits[start:end] {
+			h.lines = append(h.lines, string(e.op)+e.text)
+			if e.op != '+' {
+				oldCount++
+			}
+			if e.op != '-' {
+				newCount++
+			}
+		}
+		h.header = fmt.Sprintf("@@ -%d,%d +%d,%d @@", edits[start].oldN+1, oldCount, edits[start].newN+1, newCount)
+		hunks = append(hunks, h)
+		k = end
+	}
+	return hunks
+}
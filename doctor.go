@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// How far the local clock may be off the API server's
+const MAX_CLOCK_SKEW = 5 * time.Minute
+
+// The error of reading the config file or the environment, which aborts
+// every command but doctor
+var configError error
+
+func init() {
+	registerCommand(command{
+		name:  "doctor",
+		usage: "check the API key, network, config and history, suggesting fixes",
+		run:   runDoctor,
+	})
+}
+
+// The outcome of a doctor check: fix is empty when it passed, and warn
+// marks a problem that doesn't stop deepseek from working
+type diagnosis struct {
+	name   string
+	detail string
+	fix    string
+	warn   bool
+}
+
+func runDoctor(args []string) error {
+	if len(args) > 0 {
+		return errors.New("usage: deepseek doctor")
+	}
+	results := []diagnosis{doctorConfig(), doctorBaseURL()}
+	if results[1].fix == "" {
+		results = append(results, doctorAPI()...)
+	}
+	results = append(results, doctorHistory()...)
+
+	problems := 0
+	for _, d := range results {
+		mark, color := "ok  ", "32"
+		if d.fix != "" && d.warn {
+			mark, color = "warn", "33"
+		} else if d.fix != "" {
+			mark, color = "FAIL", "31"
+			problems++
+		}
+		if isTerminal(os.Stdout) {
+			mark = colorize(mark, color)
+		}
+		fmt.Printf("%s %-12s %s\n", mark, d.name, d.detail)
+		if d.fix != "" {
+			fmt.Printf("     %-12s fix: %s\n", "", d.fix)
+		}
+	}
+	if problems > 0 {
+		return fmt.Errorf("%d problem(s) found", problems)
+	}
+	return nil
+}
+
+func doctorConfig() diagnosis {
+	d := diagnosis{name: "config"}
+	path, err := configFilePath()
+	if err != nil {
+		d.detail, d.fix = err.Error(), "set HOME or XDG_CONFIG_HOME"
+		return d
+	}
+	if configError != nil {
+		d.detail, d.fix = configError.Error(), "correct the setting, or see `deepseek config list`"
+		return d
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		d.detail = "no config file at " + path + ", using defaults"
+		return d
+	}
+	d.detail = fmt.Sprintf("%s parsed, %d settings", path, len(configValues))
+	return d
+}
+
+func doctorBaseURL() diagnosis {
+	d := diagnosis{name: "base URL", detail: apiBaseURL + " (provider " + currentProvider.name + ")"}
+	if err := checkBaseURL(); err != nil {
+		d.detail, d.fix = err.Error(), "use an absolute URL such as "+DEFAULT_BASE_URL
+		return d
+	}
+	u, _ := url.Parse(apiBaseURL)
+	if _, err := net.LookupHost(u.Hostname()); err != nil {
+		d.detail = fmt.Sprintf("cannot resolve %s: %v", u.Hostname(), err)
+		d.fix = "check the host name of -base-url and your DNS settings"
+	}
+	return d
+}
+
+// Check the key, the network and the clock with a request listing the
+// models
+func doctorAPI() []diagnosis {
+	key := diagnosis{name: "API key"}
+	apiKey, err := loadAPIKey()
+	switch {
+	case err != nil:
+		key.detail, key.fix = err.Error(), "export "+currentProvider.keyEnv+" or run `deepseek auth login`"
+	case apiKey != "":
+		key.detail = maskSecret(apiKey)
+	default:
+		key.detail = "none needed"
+	}
+
+	endpoint := "models"
+	if currentProvider.api == API_OLLAMA {
+		endpoint = "api/tags"
+	}
+	network := diagnosis{name: "network", detail: "reached " + apiURL(endpoint)}
+	req, err := http.NewRequest("GET", apiURL(endpoint), nil)
+	if err != nil {
+		network.detail, network.fix = err.Error(), "check -base-url"
+		return []diagnosis{key, network}
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	prepareRequest(req)
+	start := time.Now()
+	resp, err := sendRequest(req, API_TIMEOUT, 0)
+	if err != nil {
+		network.detail = err.Error()
+		network.fix = "check your connection, firewall or proxy (HTTPS_PROXY)"
+		if currentProvider.api == API_OLLAMA {
+			network.fix = "start the server with `ollama serve`, or set OLLAMA_HOST"
+		}
+		return []diagnosis{key, network}
+	}
+	resp.Body.Close()
+	network.detail += fmt.Sprintf(" in %s", time.Since(start).Round(time.Millisecond))
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		key.detail += " rejected: " + resp.Status
+		key.fix = "create a new key and store it with `deepseek auth login`"
+	case resp.StatusCode == http.StatusNotFound:
+		network.detail += ": " + resp.Status
+		network.fix = "-base-url probably lacks or repeats a path such as /v1"
+	case resp.StatusCode != http.StatusOK:
+		network.detail += ": " + resp.Status
+		network.fix = "retry later, or see `deepseek -status`"
+		network.warn = true
+	case apiKey != "":
+		key.detail += " accepted"
+	}
+
+	clock := diagnosis{name: "clock"}
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		clock.detail = "the server sent no Date to compare with"
+		return []diagnosis{key, network, clock}
+	}
+	skew := time.Since(date).Round(time.Second)
+	clock.detail = fmt.Sprintf("%s off the server", skew.Abs())
+	if skew.Abs() > MAX_CLOCK_SKEW {
+		clock.fix = "synchronize the system clock, e.g. `timedatectl set-ntp true`; expiry and sync rely on it"
+		clock.warn = true
+	}
+	return []diagnosis{key, network, clock}
+}
+
+// Check the index and every chat file parse, and that nobody else can
+// read them
+func doctorHistory() []diagnosis {
+	index := diagnosis{name: "history", detail: historyFile}
+	if historyFile == "" {
+		index.detail, index.fix = "no history file", "set HOME or DEEPSEEK_HISTORY_FILE"
+		return []diagnosis{index}
+	}
+	results := []diagnosis{}
+	data, err := os.ReadFile(historyFile)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		index.detail += " doesn't exist yet"
+	case err != nil:
+		index.detail, index.fix = err.Error(), "check the owner and permissions of "+historyDir
+	default:
+		var config Config
+		if err := json.Unmarshal(data, &config); err != nil {
+			index.detail = fmt.Sprintf("%s is corrupt: %v", historyFile, err)
+			index.fix = "restore it with `deepseek restore` or from " + historyFile + ".bak"
+		} else {
+			index.detail = fmt.Sprintf("%s, %d chats", historyFile, len(config.Chats))
+		}
+	}
+	results = append(results, index)
+
+	files := diagnosis{name: "chat files"}
+	broken, missing := 0, 0
+	for id := range chatIndex {
+		if _, exists, err := loadChat(id); err != nil {
+			broken++
+			if files.detail == "" {
+				files.detail = err.Error()
+			}
+		} else if !exists {
+			missing++
+		}
+	}
+	switch {
+	case broken > 0:
+		files.detail = fmt.Sprintf("%d unreadable, e.g. %s", broken, files.detail)
+		files.fix = "restore them with `deepseek restore`, or remove them with `deepseek -rm`"
+	case missing > 0:
+		files.detail = fmt.Sprintf("%d chats of the index have no file", missing)
+		files.fix = "remove them from the index with `deepseek -rm`"
+		files.warn = true
+	default:
+		files.detail = fmt.Sprintf("%d readable", len(chatIndex))
+	}
+	results = append(results, files)
+
+	perms := diagnosis{name: "permissions", detail: historyDir + " is private"}
+	for _, path := range []string{historyDir, historyFile, filepath.Join(historyDir, CHATS_DIR)} {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if info.Mode().Perm()&0077 != 0 {
+			perms.detail = fmt.Sprintf("%s has mode %#o, readable by others", path, info.Mode().Perm())
+			perms.fix = "chmod -R go-rwx " + historyDir
+			perms.warn = true
+			break
+		}
+	}
+	if probe, err := os.CreateTemp(historyDir, ".doctor-*"); err != nil {
+		perms.detail = historyDir + " is not writable: " + err.Error()
+		perms.fix = "check the owner and permissions of " + historyDir
+		perms.warn = false
+	} else {
+		probe.Close()
+		os.Remove(probe.Name())
+	}
+	results = append(results, perms)
+	return results
+}
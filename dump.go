@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// -debug-dump: file to append every API request and response to, headers
+// and bodies, with the secrets redacted
+var debugDumpPath string
+
+const REDACTED = "[REDACTED]"
+
+// Headers carrying credentials, whose values are never dumped
+var secretHeaders = []string{"Authorization", "Proxy-Authorization", "X-Api-Key", "Api-Key", "Cookie", "Set-Cookie"}
+
+// A transport writing the exchanges of next to the -debug-dump file
+type dumpTransport struct {
+	next http.RoundTripper
+	mu   sync.Mutex
+	file *os.File
+	err  error
+	n    int
+}
+
+func (t *dumpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	secrets := requestSecrets(req)
+	redacted := req.Clone(req.Context())
+	for _, name := range secretHeaders {
+		if redacted.Header.Get(name) != "" {
+			redacted.Header.Set(name, REDACTED)
+		}
+	}
+	// Dumping reads the body, the request gets a copy
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		redacted.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	t.mu.Lock()
+	t.n++
+	n := t.n
+	t.mu.Unlock()
+	start := time.Now()
+	if dump, err := httputil.DumpRequestOut(redacted, true); err == nil {
+		t.write(fmt.Sprintf("### #%d request, %s\n", n, start.Format(time.RFC3339Nano)), dump, secrets)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.write(fmt.Sprintf("### #%d failed after %s\n", n, time.Since(start).Round(time.Millisecond)), []byte(err.Error()+"\n"), secrets)
+		return nil, err
+	}
+	header := resp.Header.Clone()
+	for _, name := range secretHeaders {
+		if header.Get(name) != "" {
+			header.Set(name, REDACTED)
+		}
+	}
+	var head bytes.Buffer
+	fmt.Fprintf(&head, "%s %s\n", resp.Proto, resp.Status)
+	header.Write(&head)
+	head.WriteString("\n")
+	headDump := head.Bytes()
+	// The body is dumped as a whole once read, streamed ones too
+	resp.Body = &dumpBody{ReadCloser: resp.Body, done: func(body []byte) {
+		title := fmt.Sprintf("### #%d response after %s\n", n, time.Since(start).Round(time.Millisecond))
+		t.write(title, append(headDump, body...), secrets)
+	}}
+	return resp, nil
+}
+
+// Append an entry to the dump file, opened on first use, with every secret
+// replaced
+func (t *dumpTransport) write(title string, data []byte, secrets []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.file == nil && t.err == nil {
+		t.file, t.err = os.OpenFile(debugDumpPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if t.err != nil {
+			errorf("Error opening -debug-dump file: %v\n", t.err)
+		}
+	}
+	if t.err != nil {
+		return
+	}
+	text := redact(string(data), secrets)
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	fmt.Fprintf(t.file, "%s%s\n", title, text)
+}
+
+// The keys that may show up in the dump of req: those of its headers and
+// of the current provider
+func requestSecrets(req *http.Request) []string {
+	var secrets []string
+	add := func(secret string) {
+		// Short values would redact unrelated text
+		if len(secret) >= 8 {
+			secrets = append(secrets, secret)
+		}
+	}
+	for _, name := range secretHeaders {
+		value := req.Header.Get(name)
+		add(value)
+		if _, token, ok := strings.Cut(value, " "); ok {
+			add(token)
+		}
+	}
+	for _, key := range apiKeys() {
+		add(key)
+	}
+	cmdKeysMu.Lock()
+	for _, result := range cmdKeys {
+		add(result.key)
+	}
+	cmdKeysMu.Unlock()
+	return secrets
+}
+
+// A response body keeping what was read, to dump once closed
+type dumpBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	done func(body []byte)
+	once sync.Once
+}
+
+func (b *dumpBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	return n, err
+}
+
+func (b *dumpBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.done(b.buf.Bytes()) })
+	return err
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Units understood on top of those of time.ParseDuration. A month is 30
+// days and a year 365.
+var longUnits = map[string]time.Duration{
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+	"mo": 30 * 24 * time.Hour,
+	"y":  365 * 24 * time.Hour,
+}
+
+// Parse a duration like time.ParseDuration, also accepting days (d), weeks
+// (w), months (mo) and years (y), as in "2w", "1mo" or "1d12h"
+func parseDuration(value string) (time.Duration, error) {
+	var total time.Duration
+	s := value
+	if s == "0" {
+		return 0, nil
+	}
+	if s == "" {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	for s != "" {
+		// A number, then its unit
+		i := 0
+		for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+			i++
+		}
+		j := i
+		for j < len(s) && (s[j] < '0' || s[j] > '9') && s[j] != '.' {
+			j++
+		}
+		if i == 0 || j == i {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		number, unit := s[:i], s[i:j]
+		var term time.Duration
+		if size, ok := longUnits[unit]; ok {
+			n, err := strconv.ParseFloat(number, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", value)
+			}
+			// Converting past the range of a Duration gives garbage
+			if n*float64(size) >= math.MaxInt64 {
+				return 0, fmt.Errorf("duration %q out of range", value)
+			}
+			term = time.Duration(n * float64(size))
+		} else {
+			d, err := time.ParseDuration(number + unit)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q: units are ns, us, ms, s, m, h, d, w, mo and y", value)
+			}
+			term = d
+		}
+		if total > math.MaxInt64-term {
+			return 0, fmt.Errorf("duration %q out of range", value)
+		}
+		total += term
+		s = s[j:]
+	}
+	return total, nil
+}
+
+// Format a duration using the largest fitting long unit, as in "3d4h"
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d < 24*time.Hour {
+		return d.String()
+	}
+	days := d / (24 * time.Hour)
+	rest := d - days*24*time.Hour
+	s := fmt.Sprintf("%dd", days)
+	if h := rest.Round(time.Hour) / time.Hour; h > 0 {
+		s += fmt.Sprintf("%dh", h)
+	}
+	return s
+}
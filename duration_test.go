@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"90s", 90 * time.Second, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"2d", 2 * day, false},
+		{"1d12h", 36 * time.Hour, false},
+		{"2w", 14 * day, false},
+		{"1mo", 30 * day, false},
+		{"1y", 365 * day, false},
+		{"1.5d", 36 * time.Hour, false},
+		{"292y", 292 * 365 * day, false},
+		{"", 0, true},
+		{"d", 0, true},
+		{"10", 0, true},
+		{"3x", 0, true},
+		{"-1d", 0, true},
+		// Past the range of a time.Duration
+		{"300y", 0, true},
+		{"200y200y", 0, true},
+		{"299y1d", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseDuration(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseDuration(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseDuration(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{90 * time.Second, "1m30s"},
+		{24 * time.Hour, "1d"},
+		{76 * time.Hour, "3d4h"},
+	}
+	for _, tt := range tests {
+		if got := formatDuration(tt.d); got != tt.want {
+			t.Errorf("formatDuration(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const EDIT_PROMPT = `You are a coding assistant that edits a single file.
+Answer ONLY with the complete updated file in one fenced code block, or with a unified diff
+against the original in a fenced diff block. Do not add explanations.`
+
+func init() {
+	registerCommand(command{
+		name:  "edit",
+		usage: "<file> <instruction>  edit a file in place after reviewing the diff",
+		run:   runEdit,
+	})
+}
+
+// Whether the patch is of file: the same path, or the end of it for a
+// diff with relative paths
+func patchNames(p filePatch, file string) bool {
+	path := p.newPath
+	if path == "" {
+		path = p.oldPath
+	}
+	if path == "" {
+		return false
+	}
+	path, file = filepath.Clean(filepath.FromSlash(path)), filepath.Clean(file)
+	return path == file || strings.HasSuffix(file, string(filepath.Separator)+path)
+}
+
+func runEdit(args []string) error {
+	fs := flag.NewFlagSet("edit", flag.ContinueOnError)
+	noBackup := fs.Bool("no-backup", false, "Do not keep a .bak copy of the original file")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 2 {
+		return errors.New("usage: deepseek edit <file> <instruction>")
+	}
+	file := args[0]
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", file, err)
+	}
+	original := string(data)
+
+	apiKey, err := loadAPIKey()
+	if err != nil {
+		return err
+	}
+	messages := []Message{
+		{Role: "system", Content: EDIT_PROMPT},
+		{Role: "user", Content: fmt.Sprintf("File: %s\n```\n%s```\n\n%s", file, original, strings.Join(args[1:], " "))},
+	}
+	infof("Waiting for the model...\n")
+	resp, err := chatWithFallback(chatRequest{apiKey: apiKey, model: *model, messages: messages, debug: *debug})
+	if err != nil {
+		return err
+	}
+	response := resp.content
+
+	oldLines := strings.Split(strings.TrimSuffix(original, "\n"), "\n")
+	var updated string
+	if patches, err := parseUnifiedDiff(response); err == nil {
+		// Hunks of other files would corrupt this one
+		var patch *filePatch
+		for i, p := range patches {
+			if patchNames(p, file) {
+				patch = &patches[i]
+				break
+			}
+		}
+		if patch == nil {
+			return fmt.Errorf("the diff of the answer doesn't change %s", file)
+		}
+		lines, _ := applyHunks(append([]string(nil), oldLines...), patch.hunks, func(h hunk, pos int) bool {
+			if pos < 0 {
+				errorf("Hunk does not apply, skipping: %s\n", h.header)
+			}
+			return true
+		})
+		updated = strings.Join(lines, "\n") + "\n"
+	} else if blocks := parseCodeBlocks(response); len(blocks) > 0 {
+		updated = blocks[0].content
+	} else {
+		updated = strings.TrimSpace(response) + "\n"
+	}
+
+	hunks := diffLines(oldLines, strings.Split(strings.TrimSuffix(updated, "\n"), "\n"), 3)
+	if len(hunks) == 0 {
+		infof("No changes.\n")
+		return nil
+	}
+	fmt.Println(colorize("--- a/"+file, "1"))
+	fmt.Println(colorize("+++ b/"+file, "1"))
+	for _, h := range hunks {
+		printHunk(os.Stdout, h)
+	}
+
+	if !*assumeYes && !confirm("Write changes to "+file+"?") {
+		infof("No changes written.\n")
+		return nil
+	}
+	if !*noBackup {
+		if err := os.WriteFile(file+".bak", data, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("writing backup: %w", err)
+		}
+	}
+	if err := os.WriteFile(file, []byte(updated), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("writing %s: %w", file, err)
+	}
+	infof("Updated %s\n", file)
+	return nil
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	EMBEDDINGS_URL   = "DEEPSEEK_EMBEDDINGS_URL"
+	EMBEDDINGS_MODEL = "DEEPSEEK_EMBEDDINGS_MODEL"
+	EMBEDDINGS_KEY   = "DEEPSEEK_EMBEDDINGS_API_KEY"
+	EMBEDDINGS_FILE  = "embeddings.json"
+
+	// An OpenAI-compatible endpoint served by a local Ollama
+	DEFAULT_EMBEDDINGS_URL   = "http://localhost:11434/v1/embeddings"
+	DEFAULT_EMBEDDINGS_MODEL = "nomic-embed-text"
+
+	// Longest text embedded per message, in bytes
+	EMBED_MAX_TEXT = 4000
+	EMBED_BATCH    = 32
+)
+
+// Embeddings of one chat's messages
+type chatEmbeddings struct {
+	UpdatedAt time.Time   `json:"updated_at"`
+	Model     string      `json:"model"`
+	Messages  []int       `json:"messages"`
+	Vectors   [][]float32 `json:"vectors"`
+}
+
+// The embedding index, keyed by chat ID
+type embeddingIndex map[string]chatEmbeddings
+
+type embeddingsClient struct {
+	url, model, apiKey string
+}
+
+func newEmbeddingsClient() embeddingsClient {
+	c := embeddingsClient{
+		url:    os.Getenv(EMBEDDINGS_URL),
+		model:  os.Getenv(EMBEDDINGS_MODEL),
+		apiKey: os.Getenv(EMBEDDINGS_KEY),
+	}
+	if c.url == "" {
+		c.url = DEFAULT_EMBEDDINGS_URL
+	}
+	if c.model == "" {
+		c.model = DEFAULT_EMBEDDINGS_MODEL
+	}
+	return c
+}
+
+// Embed texts with an OpenAI-compatible /embeddings endpoint
+func (c embeddingsClient) embed(texts []string) ([][]float32, error) {
+	body, err := json.Marshal(map[string]any{"model": c.model, "input": texts})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	resp, err := sendRequest(req, 60*time.Second, 0)
+	if err != nil {
+		return nil, fmt.Errorf("calling embeddings endpoint %s (set %s): %w", c.url, EMBEDDINGS_URL, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embeddings: %w", &apiError{resp.StatusCode, resp.Status, string(data)})
+	}
+	var result struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("parsing embeddings response: %w", err)
+	}
+	if len(result.Data) != len(texts) {
+		return nil, fmt.Errorf("embeddings endpoint returned %d vectors for %d texts", len(result.Data), len(texts))
+	}
+	vectors := make([][]float32, len(texts))
+	for _, d := range result.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, errors.New("embeddings response has an invalid index")
+		}
+		vectors[d.Index] = normalize(d.Embedding)
+	}
+	return vectors, nil
+}
+
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= norm
+	}
+	return v
+}
+
+// Cosine similarity of two normalized vectors
+func similarity(a, b []float32) float64 {
+	var dot float64
+	for i := 0; i < len(a) && i < len(b); i++ {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
+
+func loadEmbeddings() (embeddingIndex, error) {
+	index := embeddingIndex{}
+	data, err := os.ReadFile(filepath.Join(historyDir, EMBEDDINGS_FILE))
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		// The index is only a cache, rebuild it
+		errorf("Warning: ignoring unreadable embedding index: %v\n", err)
+		return embeddingIndex{}, nil
+	}
+	return index, nil
+}
+
+func saveEmbeddings(index embeddingIndex) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(historyDir, EMBEDDINGS_FILE), data, 0600)
+}
+
+// Bring the embedding index up to date with the history, embedding only
+// chats that changed since they were last indexed
+func updateEmbeddings(client embeddingsClient) (embeddingIndex, error) {
+	index, err := loadEmbeddings()
+	if err != nil {
+		return nil, err
+	}
+	changed := false
+	for id := range index {
+		if _, ok := chatIndex[id]; !ok {
+			delete(index, id)
+			changed = true
+		}
+	}
+
+	stale := 0
+	for _, id := range sortedChatIDs() {
+		entry, ok := index[id]
+		if ok && entry.Model == client.model && !entry.UpdatedAt.Before(chatIndex[id].UpdatedAt) {
+			continue
+		}
+		chat, exists, err := loadChat(id)
+		if err != nil || !exists {
+			continue
+		}
+		if stale == 0 {
+			infof("Updating the embedding index...\n")
+		}
+		stale++
+
+		entry = chatEmbeddings{UpdatedAt: chatIndex[id].UpdatedAt, Model: client.model}
+		var texts []string
+		for i, msg := range chat.Messages {
+			if msg.Role == "system" || msg.Content == "" {
+				continue
+			}
+			text := msg.Content
+			if len(text) > EMBED_MAX_TEXT {
+				text = text[:EMBED_MAX_TEXT]
+			}
+			entry.Messages = append(entry.Messages, i)
+			texts = append(texts, text)
+		}
+		for start := 0; start < len(texts); start += EMBED_BATCH {
+			vectors, err := client.embed(texts[start:min(start+EMBED_BATCH, len(texts))])
+			if err != nil {
+				// Keep what was indexed so far for the next run
+				if changed {
+					saveEmbeddings(index)
+				}
+				return nil, err
+			}
+			entry.Vectors = append(entry.Vectors, vectors...)
+		}
+		index[id] = entry
+		changed = true
+	}
+	if changed {
+		if err := saveEmbeddings(index); err != nil {
+			return nil, err
+		}
+	}
+	return index, nil
+}
+
+// Print the chats whose messages are closest in meaning to the query
+func semanticSearch(query string, filter messageFilter, limit int) error {
+	client := newEmbeddingsClient()
+	index, err := updateEmbeddings(client)
+	if err != nil {
+		return err
+	}
+	vectors, err := client.embed([]string{query})
+	if err != nil {
+		return err
+	}
+	q := vectors[0]
+
+	type result struct {
+		chatID  string
+		chat    Chat
+		message int
+		score   float64
+	}
+	var results []result
+	for id, entry := range index {
+		chat, exists, err := loadChat(id)
+		if err != nil || !exists {
+			continue
+		}
+		best := result{chatID: id, chat: chat, score: -2}
+		for i, v := range entry.Vectors {
+			n := entry.Messages[i]
+			if n >= len(chat.Messages) || !filter.match(chat.Messages[n], chat) {
+				continue
+			}
+			if score := similarity(q, v); score > best.score {
+				best.message, best.score = n, score
+			}
+		}
+		if best.score > -2 {
+			results = append(results, best)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].score > results[j].score })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	if len(results) == 0 {
+		infof("No matches.\n")
+	}
+
+	color := isTerminal(os.Stdout)
+	for _, r := range results {
+		printSearchHeader(r.chatID, r.chat, color)
+		msg := r.chat.Messages[r.message]
+		fmt.Printf("  [%d] %-9s %.3f  %s\n", r.message, msg.Role, r.score, snippet(msg.Content, []int{0, 0}, false))
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Exit statuses, for scripts to tell failures apart
+const (
+	EXIT_OK    = 0
+	EXIT_ERROR = 1
+	// Wrong flags or arguments, as the flag package exits with
+	EXIT_USAGE = 2
+	// No API key is set or stored
+	EXIT_NO_KEY = 3
+	// The API refused the key
+	EXIT_AUTH           = 4
+	EXIT_RATE_LIMIT     = 5
+	EXIT_BALANCE        = 6
+	EXIT_NETWORK        = 7
+	EXIT_CONTENT_FILTER = 8
+	// Ctrl-C, as shells report a SIGINT
+	EXIT_INTERRUPTED = 130
+)
+
+// The status main exits with, the one of the first failure
+var exitStatus = EXIT_OK
+
+var errInterrupted = errors.New("interrupted")
+
+// An error exiting with a given status
+type exitError struct {
+	error
+	code int
+}
+
+func (e exitError) Unwrap() error { return e.error }
+
+func withExitCode(err error, code int) error {
+	return exitError{err, code}
+}
+
+// Print err and set the exit status to its kind
+func fail(err error) {
+	errorf("Error: %v\n", err)
+	setExitStatus(exitCode(err))
+}
+
+// Exit with code, unless an earlier failure set the status
+func setExitStatus(code int) {
+	if exitStatus == EXIT_OK {
+		exitStatus = code
+	}
+}
+
+// The exit status matching the kind of err
+func exitCode(err error) int {
+	if err == nil {
+		return EXIT_OK
+	}
+	var coded exitError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+	var api *apiError
+	if errors.As(err, &api) {
+		switch api.status {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return EXIT_AUTH
+		case http.StatusPaymentRequired:
+			return EXIT_BALANCE
+		case http.StatusTooManyRequests:
+			return EXIT_RATE_LIMIT
+		}
+		if api.contentFilter() {
+			return EXIT_CONTENT_FILTER
+		}
+		return EXIT_ERROR
+	}
+	if errors.Is(err, errInterrupted) || errors.Is(err, context.Canceled) {
+		return EXIT_INTERRUPTED
+	}
+	if errors.Is(err, errStalled) || errors.Is(err, io.ErrUnexpectedEOF) || isNetworkError(err) {
+		return EXIT_NETWORK
+	}
+	// Subcommands report wrong arguments as "usage: deepseek ..."
+	if strings.HasPrefix(err.Error(), "usage: ") {
+		return EXIT_USAGE
+	}
+	return EXIT_ERROR
+}
+
+// Whether err is the network's: a failed dial, lookup or request, or a
+// timeout. Not any net.Error, which a bare errno of a local file also is.
+func isNetworkError(err error) bool {
+	var opErr *net.OpError
+	var urlErr *url.Error
+	var dnsErr *net.DNSError
+	if errors.As(err, &opErr) || errors.As(err, &urlErr) || errors.As(err, &dnsErr) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A chat together with its id, as handed to exporters
+type namedChat struct {
+	id   string
+	chat Chat
+}
+
+// An exporter renders one or more chats in one output format
+type exporter func(w io.Writer, chats []namedChat) error
+
+var exporters = map[string]exporter{
+	"md":       exportMarkdown,
+	"html":     exportHTML,
+	"openai":   exportOpenAI,
+	"sharegpt": exportShareGPT,
+}
+
+const EXPORT_USAGE = "usage: deepseek export [chat-id...] [-all] [-format md|html|openai|sharegpt] [-o file]"
+
+func init() {
+	registerCommand(command{
+		name:  "export",
+		usage: "[chat-id...] [-all] [-format md|html|openai|sharegpt] [-o file]  write chat transcripts",
+		run:   runExport,
+	})
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "md", "Output format: "+strings.Join(exportFormats(), ", "))
+	outputFile := fs.String("o", "", "Write the transcript to a file instead of stdout")
+	all := fs.Bool("all", false, "Export every chat, oldest first")
+	ids, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if *all && len(ids) > 0 {
+		return errors.New(EXPORT_USAGE)
+	}
+	export, ok := exporters[*format]
+	if !ok {
+		return fmt.Errorf("unknown export format %q (valid: %s)", *format, strings.Join(exportFormats(), ", "))
+	}
+
+	if *all {
+		ids = sortedChatIDs()
+		for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+			ids[i], ids[j] = ids[j], ids[i]
+		}
+	} else if len(ids) == 0 && lastChatID != "" {
+		ids = []string{lastChatID}
+	}
+	if len(ids) == 0 {
+		return errors.New("no chat to export")
+	}
+	chats := make([]namedChat, 0, len(ids))
+	for _, id := range ids {
+		id = resolveChatID(id)
+		chat, exists, err := loadChat(id)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("chat %s not found", id)
+		}
+		chats = append(chats, namedChat{id, chat})
+	}
+
+	if *outputFile == "" {
+		return export(os.Stdout, chats)
+	}
+	f, err := os.Create(*outputFile)
+	if err != nil {
+		return err
+	}
+	if err := export(f, chats); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	infof("Exported %d chat(s) to %s\n", len(chats), *outputFile)
+	return nil
+}
+
+func exportFormats() []string {
+	formats := make([]string, 0, len(exporters))
+	for name := range exporters {
+		formats = append(formats, name)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// Heading for a message, such as "Assistant (deepseek-chat) · 2024-05-01 10:00"
+func messageTitle(msg Message) string {
+	title := strings.ToUpper(msg.Role[:1]) + msg.Role[1:]
+	if msg.Model != "" {
+		title += " (" + msg.Model + ")"
+	}
+	if msg.Time != nil {
+		title += " · " + msg.Time.Local().Format(time.DateTime)
+	}
+	if msg.Interrupted {
+		title += " · interrupted"
+	}
+	return title
+}
+
+// Render the chats as Markdown. Message contents are already Markdown, so
+// they are copied verbatim and code fences survive untouched.
+func exportMarkdown(w io.Writer, chats []namedChat) error {
+	for i, c := range chats {
+		if i > 0 {
+			fmt.Fprint(w, "\n---\n\n")
+		}
+		fmt.Fprintf(w, "# Chat %s\n\n", c.id)
+		fmt.Fprintf(w, "- Created: %s\n", c.chat.CreatedAt.Local().Format(time.DateTime))
+		if c.chat.Role != "" {
+			fmt.Fprintf(w, "- Role: %s\n", c.chat.Role)
+		}
+		for _, msg := range c.chat.Messages {
+			if msg.Role == "" {
+				continue
+			}
+			fmt.Fprintf(w, "\n## %s\n\n", messageTitle(msg))
+			content := strings.TrimRight(msg.Content, "\n")
+			if unclosedFence(content) {
+				content += "\n```"
+			}
+			if _, err := fmt.Fprintf(w, "%s\n", content); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Whether the text leaves a code fence open, as a truncated answer might
+func unclosedFence(text string) bool {
+	open := false
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			open = !open
+		}
+	}
+	return open
+}
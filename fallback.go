@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// -fallback: the models to try in order when a request fails, each a model
+// of the current provider or "<provider>:<model>" of another one
+var fallbackModels string
+
+// A step of the fallback chain
+type fallbackTarget struct {
+	provider provider
+	model    string
+}
+
+// Parse -fallback. A prefix up to a colon names a provider only when one
+// has that name, since model names such as Ollama's deepseek-r1:32b may
+// contain colons themselves.
+func parseFallback(value string) []fallbackTarget {
+	providers := allProviders()
+	var targets []fallbackTarget
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		target := fallbackTarget{provider: currentProvider, model: item}
+		if name, model, ok := strings.Cut(item, ":"); ok {
+			if p, ok := providers[name]; ok {
+				if model == "" {
+					model = p.model
+				}
+				target = fallbackTarget{provider: p, model: model}
+			}
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// Send r, and when it fails before any of the answer arrived, try the
+// models of -fallback in order. The response's model is the one that
+// answered, for the history.
+func chatWithFallback(r chatRequest) (chatResponse, error) {
+	if err := checkBudget(); err != nil {
+		return chatResponse{}, err
+	}
+	response, err := streamChat(r)
+	if err == nil || fallbackModels == "" || response.content != "" || response.reasoning != "" || r.context().Err() != nil {
+		return response, err
+	}
+	targets := parseFallback(fallbackModels)
+	// Each step carries its provider, others sending at the same time
+	// in serve or the daemon keep the current one
+	primary, primaryURL := r.target()
+	r.provider, r.baseURL = primary, primaryURL
+	failed := r.model
+	for _, target := range targets {
+		if target.provider.name == r.provider.name && target.model == r.model {
+			continue
+		}
+		name := target.model
+		if target.provider.name != primary.name {
+			name = target.provider.name + ":" + target.model
+		}
+		infof("%s failed: %v\nFalling back to %s\n", failed, err, name)
+		if target.provider.name != r.provider.name {
+			baseURL := target.provider.baseURL
+			if target.provider.name == primary.name {
+				baseURL = primaryURL
+			}
+			key, kerr := providerAPIKey(target.provider)
+			if kerr != nil {
+				failed, err = name, kerr
+				continue
+			}
+			r.provider, r.baseURL, r.apiKey = target.provider, baseURL, key
+		}
+		r.model, r.keysTried = target.model, 0
+		response, err = streamChat(r)
+		if err == nil {
+			if response.model == "" {
+				response.model = target.model
+			}
+			return response, nil
+		}
+		if response.content != "" || response.reasoning != "" || r.context().Err() != nil {
+			return response, err
+		}
+		failed = name
+	}
+	return response, err
+}
+
+// Check every step of -fallback has a model
+func checkFallback() error {
+	for _, target := range parseFallback(fallbackModels) {
+		if target.model == "" {
+			return fmt.Errorf("-fallback: provider %s has no default model", target.provider.name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+func init() {
+	registerCommand(command{
+		name:  "fork",
+		usage: "[chat-id] [-at N]  copy a chat, up to message N, into a new chat",
+		run:   runFork,
+	})
+}
+
+func runFork(args []string) error {
+	fs := flag.NewFlagSet("fork", flag.ContinueOnError)
+	at := fs.Int("at", -1, "Index of the last message to keep (see: deepseek show)")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	chatID, chat, err := chatFromArgs(args, "usage: deepseek fork [chat-id] [-at N]")
+	if err != nil {
+		return err
+	}
+	messages := chat.Messages
+	if *at >= 0 {
+		if *at >= len(messages) {
+			return fmt.Errorf("chat %s has no message %d", chatID, *at)
+		}
+		messages = messages[:*at+1]
+	}
+
+	fork := Chat{
+		CreatedAt: time.Now(),
+		Role:      chat.Role,
+		Messages:  append([]Message(nil), messages...),
+	}
+	forkID := generateChatID()
+	err = withHistoryLock(func() error {
+		if err := writeChatFile(forkID, fork); err != nil {
+			return err
+		}
+		chatIndex[forkID] = metaFor(fork)
+		// Continue in the fork by default
+		lastChatID = forkID
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println(forkID)
+	infof("Forked %d message(s) of chat %s.\n", len(fork.Messages), chatID)
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// The object exposed to -format templates
+type templateResult struct {
+	Content      string
+	Reasoning    string
+	Prompt       string
+	Model        string
+	ChatID       string
+	FinishReason string
+	Usage        Usage
+	Duration     time.Duration
+	FirstToken   time.Duration
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"trim": strings.TrimSpace,
+}
+
+func parseFormat(format string) (*template.Template, error) {
+	tmpl, err := template.New("format").Funcs(templateFuncs).Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("parsing -format template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// Render the result through the template, ending with a newline
+func renderFormat(out io.Writer, tmpl *template.Template, result templateResult) error {
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, result); err != nil {
+		return fmt.Errorf("executing -format template: %w", err)
+	}
+	text := buf.String()
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	_, err := io.WriteString(out, text)
+	return err
+}
@@ -0,0 +1,480 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	INDEX_FILE = "index.json"
+	CHATS_DIR  = "chats"
+)
+
+var (
+	chatIndex     map[string]ChatMeta
+	historyDir    string
+	historyFile   string
+	lastChatID    string
+	schemaVersion int
+	mutex         = &sync.Mutex{}
+)
+
+// The index as last read or written, reused while the file stays the same
+// so that a long-running serve or daemon doesn't parse it for every request
+var indexCache struct {
+	info   os.FileInfo
+	config Config
+}
+
+type Chat struct {
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name,omitempty"`
+	Title     string    `json:"title,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	Archived  bool      `json:"archived,omitempty"`
+	Pinned    bool      `json:"pinned,omitempty"`
+	// When set, the chat is removed automatically after this time
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Role      string     `json:"role,omitempty"`
+	Messages  []Message  `json:"messages"`
+}
+
+// Lightweight description of a chat kept in the index, so listing chats
+// doesn't require reading every chat file
+type ChatMeta struct {
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	Name            string     `json:"name,omitempty"`
+	Title           string     `json:"title,omitempty"`
+	Tags            []string   `json:"tags,omitempty"`
+	Archived        bool       `json:"archived,omitempty"`
+	Pinned          bool       `json:"pinned,omitempty"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	Role            string     `json:"role,omitempty"`
+	Messages        int        `json:"messages"`
+	LastUserMessage string     `json:"last_user_message,omitempty"`
+	// Model of the latest answer and the tokens used by all answers
+	Model            string `json:"model,omitempty"`
+	PromptTokens     int    `json:"prompt_tokens,omitempty"`
+	CompletionTokens int    `json:"completion_tokens,omitempty"`
+}
+
+// The index file. History holds the chats of the legacy single-file
+// layout and is only read for migration.
+type Config struct {
+	SchemaVersion int                 `json:"schema_version"`
+	LastChatID    string              `json:"last_chat_id"`
+	Chats         map[string]ChatMeta `json:"chats"`
+	History       map[string]Chat     `json:"history,omitempty"`
+}
+
+func metaFor(chat Chat) ChatMeta {
+	meta := ChatMeta{
+		CreatedAt: chat.CreatedAt,
+		UpdatedAt: time.Now(),
+		Name:      chat.Name,
+		Title:     chat.Title,
+		Tags:      chat.Tags,
+		Archived:  chat.Archived,
+		Pinned:    chat.Pinned,
+		ExpiresAt: chat.ExpiresAt,
+		Role:      chat.Role,
+		Messages:  len(chat.Messages),
+	}
+	for i := len(chat.Messages) - 1; i >= 0; i-- {
+		if chat.Messages[i].Role == "user" {
+			meta.LastUserMessage = chat.Messages[i].Content
+			break
+		}
+	}
+	for _, msg := range chat.Messages {
+		if msg.Role != "assistant" {
+			continue
+		}
+		if msg.Model != "" {
+			meta.Model = msg.Model
+		}
+		if msg.Usage != nil {
+			meta.PromptTokens += msg.Usage.PromptTokens
+			meta.CompletionTokens += msg.Usage.CompletionTokens
+		}
+	}
+	return meta
+}
+
+// Put chat in the index after a change. Unless used, when only its
+// metadata such as tags, a name or a title changed, it keeps the time it
+// was last used.
+func indexChat(chatID string, chat Chat, used bool) {
+	meta := metaFor(chat)
+	if old, ok := chatIndex[chatID]; ok && !used {
+		meta.UpdatedAt = old.UpdatedAt
+	}
+	chatIndex[chatID] = meta
+}
+
+// The messages of a chat as JSON, to tell whether a change touched them
+func messagesKey(messages []Message) string {
+	data, _ := json.Marshal(messages)
+	return string(data)
+}
+
+// Current time for message timestamps
+func now() *time.Time {
+	t := time.Now()
+	return &t
+}
+
+// Chat ids name files in the chats directory: they follow the rules of
+// chat names and can't climb out of it with ..
+func validChatID(chatID string) error {
+	if validChatName(chatID) != nil || strings.Contains(chatID, "..") {
+		return fmt.Errorf("invalid chat id %q: use letters, digits, - or _", chatID)
+	}
+	return nil
+}
+
+func chatPath(chatID string) string {
+	return filepath.Join(historyDir, CHATS_DIR, chatID+".json")
+}
+
+// Load the chat index, migrating the legacy single-file history if needed
+func loadHistory() {
+	path, err := historyFilePath()
+	if err != nil {
+		errorf("Error: %v\n", err)
+		return
+	}
+	historyDir = filepath.Dir(path)
+	historyFile = path
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	chatIndex = make(map[string]ChatMeta)
+
+	if err := os.MkdirAll(filepath.Join(historyDir, CHATS_DIR), 0700); err != nil {
+		errorf("Error creating chats directory: %v\n", err)
+		return
+	}
+	unlock, err := lockHistory()
+	if err != nil {
+		errorf("Error: %v\n", err)
+		return
+	}
+	defer unlock()
+
+	if err := readIndex(); err != nil {
+		errorf("Error: %v\n", err)
+		return
+	}
+	if err := migrateHistory(); err != nil {
+		errorf("Error migrating history: %v\n", err)
+	}
+	// A history cloned from another machine comes without its index
+	if syncEnabled() && len(chatIndex) == 0 {
+		if err := reindexChats(); err == nil && len(chatIndex) > 0 {
+			writeIndex()
+		}
+	}
+}
+
+// Read the index file into chatIndex and lastChatID
+func readIndex() error {
+	if info, err := os.Stat(historyFile); err == nil && sameIndex(info) {
+		useIndex(indexCache.config)
+		return nil
+	}
+	data, err := os.ReadFile(historyFile)
+	if os.IsNotExist(err) {
+		schemaVersion = 0
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading history file: %w", err)
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		// Fall back to the previous version kept by writeFileAtomic
+		bak, bakErr := os.ReadFile(historyFile + ".bak")
+		if bakErr != nil || json.Unmarshal(bak, &config) != nil {
+			return fmt.Errorf("parsing history file: %w", err)
+		}
+		errorf("Warning: history file is corrupt (%v), using %s.bak\n", err, historyFile)
+	}
+	if config.SchemaVersion > SCHEMA_VERSION {
+		return fmt.Errorf("history schema version %d is newer than supported (%d), please upgrade deepseek", config.SchemaVersion, SCHEMA_VERSION)
+	}
+	useIndex(config)
+	cacheIndex()
+	return nil
+}
+
+// Take the chats of config as the index, a copy of them
+func useIndex(config Config) {
+	chatIndex = make(map[string]ChatMeta, len(config.Chats))
+	for id, meta := range config.Chats {
+		chatIndex[id] = meta
+	}
+	lastChatID = config.LastChatID
+	schemaVersion = config.SchemaVersion
+}
+
+// Whether info is of the index file as cached: a rewrite renames a new
+// file into place
+func sameIndex(info os.FileInfo) bool {
+	cached := indexCache.info
+	return cached != nil && os.SameFile(info, cached) && info.ModTime().Equal(cached.ModTime()) && info.Size() == cached.Size()
+}
+
+// Remember the index as it is on disk now
+func cacheIndex() {
+	info, err := os.Stat(historyFile)
+	if err != nil {
+		indexCache.info = nil
+		return
+	}
+	indexCache.info = info
+	indexCache.config = Config{SchemaVersion: schemaVersion, LastChatID: lastChatID}
+	indexCache.config.Chats = make(map[string]ChatMeta, len(chatIndex))
+	for id, meta := range chatIndex {
+		indexCache.config.Chats[id] = meta
+	}
+}
+
+// Run fn with exclusive access to the history. The index is re-read under
+// the cross-process lock before fn runs and written back afterwards, so
+// concurrent invocations don't drop each other's changes.
+func withHistoryLock(fn func() error) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	unlock, err := lockHistory()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := readIndex(); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	if err := pushRemote(); err != nil {
+		errorf("Warning: uploading history, will retry on the next run: %v\n", err)
+	}
+	if err := writeIndex(); err != nil {
+		return err
+	}
+	if syncEnabled() {
+		if err := commitHistory(); err != nil {
+			errorf("Warning: committing history: %v\n", err)
+		}
+	}
+	return nil
+}
+
+func writeIndex() error {
+	config := Config{
+		SchemaVersion: schemaVersion,
+		LastChatID:    lastChatID,
+		Chats:         chatIndex,
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling history: %w", err)
+	}
+	if err := writeFileAtomic(historyFile, data, 0600); err != nil {
+		indexCache.info = nil
+		return err
+	}
+	cacheIndex()
+	return nil
+}
+
+// Read a single chat from its file
+func loadChat(chatID string) (Chat, bool, error) {
+	var chat Chat
+	if err := validChatID(chatID); err != nil {
+		return chat, false, err
+	}
+	data, err := os.ReadFile(chatPath(chatID))
+	if os.IsNotExist(err) {
+		return chat, false, nil
+	}
+	if err != nil {
+		return chat, false, fmt.Errorf("reading chat %s: %w", chatID, err)
+	}
+	if err := json.Unmarshal(data, &chat); err != nil {
+		return chat, false, fmt.Errorf("parsing chat %s: %w", chatID, err)
+	}
+	return chat, true, nil
+}
+
+// Write a whole chat to its file and update the index
+func saveChat(chatID string, chat Chat) error {
+	return withHistoryLock(func() error {
+		if err := writeChatFile(chatID, chat); err != nil {
+			return err
+		}
+		chatIndex[chatID] = metaFor(chat)
+		return nil
+	})
+}
+
+// Modify the latest stored version of a chat under the history lock
+func updateChat(chatID string, fn func(chat *Chat, exists bool)) error {
+	return withHistoryLock(func() error {
+		chat, exists, err := loadChat(chatID)
+		if err != nil {
+			return err
+		}
+		before := messagesKey(chat.Messages)
+		fn(&chat, exists)
+		if err := writeChatFile(chatID, chat); err != nil {
+			return err
+		}
+		indexChat(chatID, chat, !exists || messagesKey(chat.Messages) != before)
+		return nil
+	})
+}
+
+// Modify each of the chats named by ids or names under one history lock.
+// Fails without changes if any of them doesn't exist.
+func updateChats(idsOrNames []string, fn func(chatID string, chat *Chat)) error {
+	return withHistoryLock(func() error {
+		ids := make([]string, len(idsOrNames))
+		for i, arg := range idsOrNames {
+			ids[i] = resolveChatID(arg)
+			if _, ok := chatIndex[ids[i]]; !ok {
+				return fmt.Errorf("chat %s not found", arg)
+			}
+		}
+		for _, chatID := range ids {
+			chat, _, err := loadChat(chatID)
+			if err != nil {
+				return err
+			}
+			before := messagesKey(chat.Messages)
+			fn(chatID, &chat)
+			if err := writeChatFile(chatID, chat); err != nil {
+				return err
+			}
+			indexChat(chatID, chat, messagesKey(chat.Messages) != before)
+		}
+		if chatIndex[lastChatID].Archived {
+			lastChatID = latestActiveChat()
+		}
+		return nil
+	})
+}
+
+func writeChatFile(chatID string, chat Chat) error {
+	if err := validChatID(chatID); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(chat, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling chat %s: %w", chatID, err)
+	}
+	if err := writeFileAtomic(chatPath(chatID), data, 0600); err != nil {
+		return fmt.Errorf("writing chat %s: %w", chatID, err)
+	}
+	markRemoteDirty(chatID)
+	return nil
+}
+
+// Remove a chat file and its index entry. The caller holds the history lock.
+func deleteChat(chatID string) error {
+	if err := validChatID(chatID); err != nil {
+		return err
+	}
+	if err := os.Remove(chatPath(chatID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing chat %s: %w", chatID, err)
+	}
+	os.Remove(chatPath(chatID) + ".bak")
+	delete(chatIndex, chatID)
+	markRemoteDirty(chatID)
+	if lastChatID == chatID {
+		lastChatID = ""
+	}
+	return nil
+}
+
+// Remove the chats whose TTL has passed, sparing archived and pinned ones
+func pruneExpired() {
+	expired := func(meta ChatMeta) bool {
+		return meta.ExpiresAt != nil && meta.ExpiresAt.Before(time.Now()) && !meta.Archived && !meta.Pinned
+	}
+	found := false
+	for _, meta := range chatIndex {
+		found = found || expired(meta)
+	}
+	if !found {
+		return
+	}
+	err := withHistoryLock(func() error {
+		var removed []string
+		for id, meta := range chatIndex {
+			if !expired(meta) {
+				continue
+			}
+			if err := deleteChat(id); err != nil {
+				return err
+			}
+			removed = append(removed, id)
+		}
+		sort.Strings(removed)
+		if len(removed) > 0 {
+			infof("Removed %d expired chat(s): %s\n", len(removed), strings.Join(removed, ", "))
+		}
+		return nil
+	})
+	if err != nil {
+		errorf("Error removing expired chats: %v\n", err)
+	}
+}
+
+// Map a chat name to its id. Anything else, including unknown names, is
+// returned unchanged.
+func resolveChatID(idOrName string) string {
+	if _, ok := chatIndex[idOrName]; ok {
+		return idOrName
+	}
+	for id, meta := range chatIndex {
+		if meta.Name == idOrName {
+			return id
+		}
+	}
+	return idOrName
+}
+
+// Return the chat ids of the index, newest first
+func sortedChatIDs() []string {
+	ids := make([]string, 0, len(chatIndex))
+	for id := range chatIndex {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return chatIndex[ids[i]].CreatedAt.After(chatIndex[ids[j]].CreatedAt)
+	})
+	return ids
+}
+
+// Set the content of the chat's system message, adding one if missing
+func setSystemMessage(chat *Chat, content string) {
+	for i, msg := range chat.Messages {
+		if msg.Role == "system" {
+			chat.Messages[i].Content = content
+			return
+		}
+	}
+	chat.Messages = append([]Message{{Role: "system", Content: content}}, chat.Messages...)
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const HTML_STYLE = `body{font-family:-apple-system,"Segoe UI",Helvetica,Arial,sans-serif;max-width:50rem;margin:2rem auto;padding:0 1rem;line-height:1.5;color:#1f2328}
+header{border-bottom:1px solid #d0d7de;margin-bottom:1rem}
+.message{border:1px solid #d0d7de;border-radius:6px;margin:1rem 0;padding:0 1rem}
+.message h2{font-size:.9rem;margin:.5rem 0;color:#59636e}
+.user{background:#f6f8fa}
+.system{opacity:.7}
+details{margin:.5rem 0;color:#59636e}
+pre{background:#0d1117;color:#e6edf3;padding:.75rem;border-radius:6px;overflow:auto}
+code{font-family:ui-monospace,Menlo,Consolas,monospace;font-size:.9em}
+:not(pre)>code{background:#eff1f3;padding:.1em .3em;border-radius:4px}
+blockquote{border-left:3px solid #d0d7de;margin:0;padding-left:1rem;color:#59636e}
+.kw{color:#ff7b72}.str{color:#a5d6ff}.com{color:#8b949e;font-style:italic}.num{color:#79c0ff}`
+
+// Render the chats as a standalone HTML page. Reasoning is folded into a
+// collapsible section and code blocks get a simple syntax highlighter.
+func exportHTML(w io.Writer, chats []namedChat) error {
+	var b strings.Builder
+	title := "Chats"
+	if len(chats) == 1 {
+		title = "Chat " + chats[0].id
+	}
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>\n%s\n</style>\n</head>\n<body>\n", html.EscapeString(title), HTML_STYLE)
+
+	for _, c := range chats {
+		fmt.Fprintf(&b, "<article>\n<header>\n<h1>%s</h1>\n<p>Created %s", html.EscapeString("Chat "+c.id), c.chat.CreatedAt.Local().Format(time.DateTime))
+		if c.chat.Role != "" {
+			fmt.Fprintf(&b, " · role %s", html.EscapeString(c.chat.Role))
+		}
+		b.WriteString("</p>\n</header>\n")
+
+		for _, msg := range c.chat.Messages {
+			if msg.Role == "" {
+				continue
+			}
+			fmt.Fprintf(&b, "<section class=\"message %s\">\n<h2>%s</h2>\n", html.EscapeString(msg.Role), html.EscapeString(messageTitle(msg)))
+			if msg.Reasoning != "" {
+				b.WriteString("<details>\n<summary>Reasoning</summary>\n")
+				b.WriteString(renderMarkdown(msg.Reasoning))
+				b.WriteString("</details>\n")
+			}
+			b.WriteString(renderMarkdown(msg.Content))
+			b.WriteString("</section>\n")
+		}
+		b.WriteString("</article>\n")
+	}
+	b.WriteString("</body>\n</html>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var (
+	headingPattern = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	bulletPattern  = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	orderedPattern = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+	rulePattern    = regexp.MustCompile(`^(-\s*){3,}$|^(\*\s*){3,}$|^(_\s*){3,}$`)
+)
+
+// Convert the Markdown subset models commonly produce (headings, lists,
+// quotes, fenced code, emphasis and links) to HTML
+func renderMarkdown(text string) string {
+	var b strings.Builder
+	var paragraph []string
+	list := ""
+
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			b.WriteString("<p>" + renderInline(strings.Join(paragraph, "\n")) + "</p>\n")
+			paragraph = nil
+		}
+	}
+	closeList := func() {
+		if list != "" {
+			b.WriteString("</" + list + ">\n")
+			list = ""
+		}
+	}
+	openList := func(tag string) {
+		if list != tag {
+			closeList()
+			b.WriteString("<" + tag + ">\n")
+			list = tag
+		}
+	}
+
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "```") {
+			flushParagraph()
+			closeList()
+			lang := parseFenceInfo(strings.TrimSpace(trimmed[3:])).lang
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			class := ""
+			if lang != "" {
+				class = fmt.Sprintf(" class=\"language-%s\"", html.EscapeString(lang))
+			}
+			fmt.Fprintf(&b, "<pre><code%s>%s</code></pre>\n", class, highlightCode(strings.Join(code, "\n"), lang))
+			continue
+		}
+
+		switch m := headingPattern.FindStringSubmatch(trimmed); {
+		case trimmed == "":
+			flushParagraph()
+			closeList()
+		case m != nil:
+			flushParagraph()
+			closeList()
+			fmt.Fprintf(&b, "<h%d>%s</h%d>\n", len(m[1]), renderInline(m[2]), len(m[1]))
+		case rulePattern.MatchString(trimmed):
+			flushParagraph()
+			closeList()
+			b.WriteString("<hr>\n")
+		case bulletPattern.MatchString(line):
+			flushParagraph()
+			openList("ul")
+			b.WriteString("<li>" + renderInline(bulletPattern.FindStringSubmatch(line)[1]) + "</li>\n")
+		case orderedPattern.MatchString(line):
+			flushParagraph()
+			openList("ol")
+			b.WriteString("<li>" + renderInline(orderedPattern.FindStringSubmatch(line)[1]) + "</li>\n")
+		case strings.HasPrefix(trimmed, ">"):
+			flushParagraph()
+			closeList()
+			b.WriteString("<blockquote>" + renderInline(strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))) + "</blockquote>\n")
+		default:
+			closeList()
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flushParagraph()
+	closeList()
+	return b.String()
+}
+
+var (
+	boldPattern   = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	italicPattern = regexp.MustCompile(`\*([^*\s][^*]*?)\*`)
+	linkPattern   = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+)
+
+// Render inline Markdown. Code spans are split out first so their content
+// is escaped but otherwise left alone.
+func renderInline(text string) string {
+	var b strings.Builder
+	parts := strings.Split(text, "`")
+	for i, part := range parts {
+		// An odd part is inside a code span, unless its closing backtick is missing
+		if i%2 == 1 && i < len(parts)-1 {
+			b.WriteString("<code>" + html.EscapeString(part) + "</code>")
+			continue
+		}
+		if i%2 == 1 {
+			b.WriteString("`")
+		}
+		s := html.EscapeString(part)
+		s = linkPattern.ReplaceAllStringFunc(s, func(m string) string {
+			sub := linkPattern.FindStringSubmatch(m)
+			url := sub[2]
+			if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "mailto:") {
+				return m
+			}
+			return fmt.Sprintf("<a href=\"%s\">%s</a>", url, sub[1])
+		})
+		s = boldPattern.ReplaceAllString(s, "<strong>$1$2</strong>")
+		s = italicPattern.ReplaceAllString(s, "<em>$1</em>")
+		b.WriteString(strings.ReplaceAll(s, "\n", "<br>\n"))
+	}
+	return b.String()
+}
+
+// Comment markers and keywords used by the highlighter, keyed by language
+type syntax struct {
+	comments []string
+	keywords []string
+}
+
+var cKeywords = []string{"if", "else", "for", "while", "do", "switch", "case", "default", "break", "continue", "return", "struct", "const", "static", "void", "int", "char", "float", "double", "long", "unsigned", "typedef", "enum", "sizeof", "include", "define"}
+
+var syntaxes = map[string]syntax{
+	"go":         {[]string{"//"}, []string{"package", "import", "func", "return", "if", "else", "for", "range", "switch", "case", "default", "break", "continue", "go", "defer", "select", "chan", "map", "struct", "interface", "type", "var", "const", "nil", "true", "false", "fallthrough", "goto"}},
+	"python":     {[]string{"#"}, []string{"def", "class", "return", "if", "elif", "else", "for", "while", "in", "not", "and", "or", "is", "import", "from", "as", "with", "try", "except", "finally", "raise", "lambda", "yield", "pass", "break", "continue", "None", "True", "False", "async", "await", "global", "nonlocal"}},
+	"javascript": {[]string{"//"}, []string{"function", "return", "if", "else", "for", "while", "do", "switch", "case", "default", "break", "continue", "const", "let", "var", "new", "class", "extends", "import", "export", "from", "async", "await", "try", "catch", "finally", "throw", "typeof", "instanceof", "null", "undefined", "true", "false", "this"}},
+	"rust":       {[]string{"//"}, []string{"fn", "let", "mut", "if", "else", "match", "for", "while", "loop", "in", "return", "struct", "enum", "impl", "trait", "pub", "use", "mod", "crate", "self", "Self", "const", "static", "async", "await", "move", "ref", "where", "true", "false", "Some", "None", "Ok", "Err"}},
+	"shell":      {[]string{"#"}, []string{"if", "then", "else", "elif", "fi", "for", "while", "do", "done", "case", "esac", "in", "function", "return", "export", "local", "echo"}},
+	"ruby":       {[]string{"#"}, []string{"def", "end", "class", "module", "if", "elsif", "else", "unless", "while", "until", "for", "in", "do", "return", "yield", "require", "nil", "true", "false", "self"}},
+	"sql":        {[]string{"--"}, []string{"select", "from", "where", "insert", "into", "values", "update", "set", "delete", "create", "table", "drop", "alter", "join", "left", "right", "inner", "outer", "on", "group", "by", "order", "having", "limit", "and", "or", "not", "null", "as", "distinct"}},
+	"c":          {[]string{"//"}, cKeywords},
+	"java":       {[]string{"//"}, []string{"class", "interface", "public", "private", "protected", "static", "final", "void", "int", "long", "boolean", "new", "return", "if", "else", "for", "while", "switch", "case", "default", "break", "continue", "try", "catch", "finally", "throw", "throws", "import", "package", "extends", "implements", "null", "true", "false", "this"}},
+}
+
+var syntaxAliases = map[string]string{
+	"golang": "go", "py": "python", "js": "javascript", "ts": "javascript", "typescript": "javascript",
+	"jsx": "javascript", "tsx": "javascript", "rs": "rust", "sh": "shell", "bash": "shell", "zsh": "shell",
+	"rb": "ruby", "cpp": "c", "c++": "c", "h": "c", "cs": "java", "csharp": "java", "kotlin": "java",
+}
+
+var numberPattern = regexp.MustCompile(`^\d[\d_]*(\.\d+)?`)
+
+// Escape code and wrap keywords, strings, numbers and line comments in
+// spans. Unknown languages are only escaped.
+func highlightCode(code, lang string) string {
+	lang = strings.ToLower(lang)
+	if alias, ok := syntaxAliases[lang]; ok {
+		lang = alias
+	}
+	syn, ok := syntaxes[lang]
+	if !ok {
+		return html.EscapeString(code)
+	}
+	keywords := make(map[string]bool, len(syn.keywords))
+	for _, kw := range syn.keywords {
+		keywords[kw] = true
+	}
+	span := func(class, text string) string {
+		return "<span class=\"" + class + "\">" + html.EscapeString(text) + "</span>"
+	}
+
+	var b strings.Builder
+	for n, line := range strings.Split(code, "\n") {
+		if n > 0 {
+			b.WriteByte('\n')
+		}
+	scan:
+		for i := 0; i < len(line); {
+			rest := line[i:]
+			for _, marker := range syn.comments {
+				if strings.HasPrefix(rest, marker) {
+					b.WriteString(span("com", rest))
+					break scan
+				}
+			}
+			c := line[i]
+			switch {
+			case c == '"' || c == '\'' || c == '`':
+				end := i + 1
+				for end < len(line) && line[end] != c {
+					if line[end] == '\\' {
+						end++
+					}
+					end++
+				}
+				end = min(end+1, len(line))
+				b.WriteString(span("str", line[i:end]))
+				i = end
+			case isIdentStart(c):
+				end := i
+				for end < len(line) && (isIdentStart(line[end]) || line[end] >= '0' && line[end] <= '9') {
+					end++
+				}
+				word := line[i:end]
+				if keywords[word] || lang == "sql" && keywords[strings.ToLower(word)] {
+					b.WriteString(span("kw", word))
+				} else {
+					b.WriteString(html.EscapeString(word))
+				}
+				i = end
+			case c >= '0' && c <= '9' && (i == 0 || !isIdentStart(line[i-1])):
+				num := numberPattern.FindString(rest)
+				b.WriteString(span("num", num))
+				i += len(num)
+			default:
+				b.WriteString(html.EscapeString(string(c)))
+				i++
+			}
+		}
+	}
+	return b.String()
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
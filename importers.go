@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Files to import from path: path itself, or the files of a directory
+// matching pattern
+func importPaths(path, pattern string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	paths, err := filepath.Glob(filepath.Join(path, pattern))
+	sort.Strings(paths)
+	return paths, err
+}
+
+func modTime(path string) time.Time {
+	if info, err := os.Stat(path); err == nil {
+		return info.ModTime()
+	}
+	return time.Now()
+}
+
+// Read aichat sessions, the YAML files of ~/.config/aichat/sessions
+func importAichat(path string) ([]Chat, error) {
+	paths, err := importPaths(path, "*.yaml")
+	if err != nil {
+		return nil, err
+	}
+	var chats []Chat
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		model, messages, err := parseAichatSession(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		if len(messages) == 0 {
+			continue
+		}
+		for i := range messages {
+			if messages[i].Role == "assistant" {
+				messages[i].Model = model
+			}
+		}
+		chats = append(chats, Chat{CreatedAt: modTime(p), Messages: messages})
+	}
+	return chats, nil
+}
+
+// Parse the parts of an aichat session we need: the top-level model and the
+// messages list of role/content pairs. Only the YAML aichat itself writes
+// is understood: plain, quoted and block scalars.
+func parseAichatSession(data []byte) (string, []Message, error) {
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	model := ""
+	var messages []Message
+	inMessages := false
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if line == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if indent == 0 && !strings.HasPrefix(line, "- ") {
+			key, value, _ := strings.Cut(line, ":")
+			inMessages = key == "messages"
+			if key == "model" {
+				model, _ = yamlScalar(strings.TrimSpace(value))
+			}
+			continue
+		}
+		if !inMessages {
+			continue
+		}
+
+		item := strings.TrimSpace(line)
+		itemIndent := indent
+		if strings.HasPrefix(item, "- ") {
+			messages = append(messages, Message{})
+			item = strings.TrimSpace(item[2:])
+			itemIndent = indent + 2
+		}
+		if len(messages) == 0 {
+			return "", nil, fmt.Errorf("line %d: unexpected %q", i+1, item)
+		}
+		key, value, ok := strings.Cut(item, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">") {
+			var block []string
+			for i+1 < len(lines) && (strings.TrimSpace(lines[i+1]) == "" || len(lines[i+1])-len(strings.TrimLeft(lines[i+1], " ")) > itemIndent) {
+				i++
+				block = append(block, lines[i])
+			}
+			value = yamlBlock(value, block)
+		} else if value, ok = yamlScalar(value); !ok {
+			// A quoted scalar folded over several lines
+			for i+1 < len(lines) && !ok {
+				i++
+				value += " " + strings.TrimSpace(lines[i])
+				value, ok = yamlScalar(value)
+			}
+		}
+		msg := &messages[len(messages)-1]
+		switch key {
+		case "role":
+			msg.Role = value
+		case "content":
+			msg.Content = value
+		}
+	}
+	return model, messages, nil
+}
+
+// Decode a single-line scalar. ok is false for a quoted scalar whose closing
+// quote is on a later line.
+func yamlScalar(value string) (string, bool) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		if len(value) < 2 || !strings.HasSuffix(value, `"`) || strings.HasSuffix(value, `\"`) && !strings.HasSuffix(value, `\\"`) {
+			return value, false
+		}
+		s, err := strconv.Unquote(value)
+		if err != nil {
+			return value[1 : len(value)-1], true
+		}
+		return s, true
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return value, false
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), true
+	case value == "null" || value == "~":
+		return "", true
+	}
+	return value, true
+}
+
+// Decode a literal (|) or folded (>) block scalar from its indented lines
+func yamlBlock(header string, lines []string) string {
+	indent := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " "))
+		if indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	for i, line := range lines {
+		if len(line) >= indent && indent >= 0 {
+			lines[i] = line[indent:]
+		} else {
+			lines[i] = strings.TrimSpace(line)
+		}
+	}
+	sep := "\n"
+	if strings.HasPrefix(header, ">") {
+		sep = " "
+	}
+	text := strings.Join(lines, sep)
+	switch {
+	case strings.Contains(header, "-"):
+		return strings.TrimRight(text, "\n ")
+	case strings.Contains(header, "+"):
+		return text + "\n"
+	}
+	return strings.TrimRight(text, "\n ") + "\n"
+}
+
+// Read shell_gpt chat caches: files of JSON messages in /tmp/chat_cache
+func importSgpt(path string) ([]Chat, error) {
+	paths, err := importPaths(path, "*")
+	if err != nil {
+		return nil, err
+	}
+	var chats []Chat
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		var messages []struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		}
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		chat := Chat{CreatedAt: modTime(p)}
+		for _, msg := range messages {
+			chat.Messages = append(chat.Messages, Message{Role: msg.Role, Content: msg.Content})
+		}
+		if len(chat.Messages) > 0 {
+			chats = append(chats, chat)
+		}
+	}
+	return chats, nil
+}
+
+// A response logged by llm, as printed by `llm logs --json`
+type llmResponse struct {
+	Model          string `json:"model"`
+	Prompt         string `json:"prompt"`
+	System         string `json:"system"`
+	Response       string `json:"response"`
+	ConversationID string `json:"conversation_id"`
+	DatetimeUTC    string `json:"datetime_utc"`
+}
+
+// Read llm's logs, given either the output of `llm logs -n 0 --json` or the
+// logs.db database itself, which is converted by running llm
+func importLLM(path string) ([]Chat, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte("SQLite format 3")) {
+		cmd := exec.Command("llm", "logs", "-n", "0", "--json", "-d", path)
+		cmd.Stderr = os.Stderr
+		if data, err = cmd.Output(); err != nil {
+			return nil, fmt.Errorf("running llm to read the database (export it with `llm logs -n 0 --json` instead): %w", err)
+		}
+	}
+
+	var responses []llmResponse
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &responses)
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+		for scanner.Scan() && err == nil {
+			var r llmResponse
+			if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+				err = json.Unmarshal(line, &r)
+				responses = append(responses, r)
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Group responses into conversations, in the order they were logged
+	sort.SliceStable(responses, func(i, j int) bool { return responses[i].DatetimeUTC < responses[j].DatetimeUTC })
+	var order []string
+	conversations := make(map[string]*Chat)
+	for i, r := range responses {
+		id := r.ConversationID
+		if id == "" {
+			id = strconv.Itoa(i)
+		}
+		chat, ok := conversations[id]
+		if !ok {
+			created, err := time.Parse("2006-01-02T15:04:05.999999", r.DatetimeUTC)
+			if err != nil {
+				created = time.Now()
+			}
+			chat = &Chat{CreatedAt: created}
+			conversations[id] = chat
+			order = append(order, id)
+		}
+		if r.System != "" {
+			setSystemMessage(chat, r.System)
+		}
+		chat.Messages = append(chat.Messages,
+			Message{Role: "user", Content: r.Prompt},
+			Message{Role: "assistant", Content: r.Response, Model: r.Model})
+	}
+	chats := make([]Chat, 0, len(order))
+	for _, id := range order {
+		chats = append(chats, *conversations[id])
+	}
+	return chats, nil
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+)
+
+const (
+	// The jobs of -bg, each a record, the answer as it streams, the errors
+	// and the lock its process holds while running
+	JOBS_DIR = "jobs"
+	// Set to the id of the job for the process running it
+	JOB_ENV = "DEEPSEEK_JOB"
+	// Random bytes of a job id, written in hex
+	JOB_ID_BYTES = 4
+)
+
+// Statuses of a job: starting until its process runs, lost when that
+// process ended without saying how
+const (
+	JOB_STARTING = "starting"
+	JOB_RUNNING  = "running"
+	JOB_DONE     = "done"
+	JOB_FAILED   = "failed"
+	JOB_LOST     = "lost"
+)
+
+// A prompt answered in the background
+type job struct {
+	ID       string     `json:"id"`
+	Prompt   string     `json:"prompt"`
+	ChatID   string     `json:"chat_id,omitempty"`
+	Model    string     `json:"model"`
+	Status   string     `json:"status"`
+	PID      int        `json:"pid,omitempty"`
+	ExitCode int        `json:"exit_code"`
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+}
+
+// The job this process runs, if any
+var runningJob *job
+
+func init() {
+	registerCommand(command{
+		name:  "jobs",
+		usage: "[-clean]  list the prompts sent with ask -bg, or remove the finished ones",
+		run:   runJobs,
+	})
+	registerCommand(command{
+		name:  "job",
+		usage: "<id> [-wait]  show the status and the answer of a job, waiting for it with -wait",
+		run:   runJob,
+	})
+}
+
+// The path of a file of job id
+func jobPath(id, ext string) (string, error) {
+	// The hex digits of startJob
+	if _, err := hex.DecodeString(id); err != nil || len(id) != 2*JOB_ID_BYTES {
+		return "", fmt.Errorf("invalid job id %q", id)
+	}
+	dir, err := dataPath(JOBS_DIR)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("creating jobs directory: %w", err)
+	}
+	return filepath.Join(dir, id+ext), nil
+}
+
+func loadJob(id string) (job, error) {
+	var j job
+	path, err := jobPath(id, ".json")
+	if err != nil {
+		return j, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return j, fmt.Errorf("job %s not found", id)
+	}
+	if err != nil {
+		return j, err
+	}
+	if err := json.Unmarshal(data, &j); err != nil {
+		return j, fmt.Errorf("parsing job %s: %w", id, err)
+	}
+	// A process killed before finishing leaves its lock free
+	if j.Status == JOB_RUNNING && !jobAlive(id) {
+		j.Status = JOB_LOST
+	}
+	return j, nil
+}
+
+func saveJob(j job) error {
+	path, err := jobPath(j.ID, ".json")
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0600)
+}
+
+// Whether the process of job id holds its lock
+func jobAlive(id string) bool {
+	path, err := jobPath(id, ".lock")
+	if err != nil {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	locked, err := tryLockFile(f)
+	if locked {
+		unlockFile(f)
+	}
+	return err == nil && !locked
+}
+
+// Hand the prompt to a new process running this invocation again, with
+// its answer going to the files of a job, and print the job's id once it
+// runs
+func startJob(prompt, chatID, model string) error {
+	id := make([]byte, JOB_ID_BYTES)
+	rand.Read(id)
+	j := job{ID: hex.EncodeToString(id), Prompt: prompt, ChatID: chatID, Model: model, Status: JOB_STARTING, Started: time.Now()}
+	if err := saveJob(j); err != nil {
+		return err
+	}
+	outPath, err := jobPath(j.ID, ".out")
+	if err != nil {
+		return err
+	}
+	errPath, err := jobPath(j.ID, ".err")
+	if err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), JOB_ENV+"="+j.ID)
+	stdout, err := os.OpenFile(outPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer stdout.Close()
+	stderr, err := os.OpenFile(errPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer stderr.Close()
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); {
+		ended := false
+		select {
+		case <-exited:
+			ended = true
+		case <-time.After(50 * time.Millisecond):
+		}
+		if started, err := loadJob(j.ID); err == nil && started.Status != JOB_STARTING {
+			fmt.Println(j.ID)
+			infof("Job %s started, `deepseek job %s -wait` shows the answer\n", j.ID, j.ID)
+			return nil
+		}
+		if ended {
+			break
+		}
+	}
+	j.Status = JOB_FAILED
+	saveJob(j)
+	return fmt.Errorf("job %s failed to start, see %s", j.ID, errPath)
+}
+
+// Take the lock of the job this process runs, marking it running; nil
+// when it runs none
+func beginJob() (*job, error) {
+	id := os.Getenv(JOB_ENV)
+	if id == "" {
+		return nil, nil
+	}
+	j, err := loadJob(id)
+	if err != nil {
+		return nil, err
+	}
+	path, err := jobPath(id, ".lock")
+	if err != nil {
+		return nil, err
+	}
+	// Held until the process exits
+	if _, err := lockPath(path, "job "+id); err != nil {
+		return nil, err
+	}
+	// Closing the terminal it was started from doesn't stop it
+	signal.Ignore(syscall.SIGHUP)
+	j.Status, j.PID = JOB_RUNNING, os.Getpid()
+	if err := saveJob(j); err != nil {
+		return nil, err
+	}
+	runningJob = &j
+	return runningJob, nil
+}
+
+// Record how the job this process runs ended
+func finishJob() {
+	if runningJob == nil {
+		return
+	}
+	finished := time.Now()
+	runningJob.Status, runningJob.ExitCode, runningJob.Finished = JOB_DONE, exitStatus, &finished
+	if exitStatus != EXIT_OK {
+		runningJob.Status = JOB_FAILED
+	}
+	if err := saveJob(*runningJob); err != nil {
+		errorf("Error saving job %s: %v\n", runningJob.ID, err)
+	}
+}
+
+// All jobs, the newest first
+func listJobs() ([]job, error) {
+	dir, err := dataPath(JOBS_DIR)
+	if err != nil {
+		return nil, err
+	}
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	var jobs []job
+	for _, path := range paths {
+		j, err := loadJob(filepath.Base(path[:len(path)-len(".json")]))
+		if err != nil {
+			errorf("Warning: %v\n", err)
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].Started.After(jobs[b].Started) })
+	return jobs, nil
+}
+
+// Remove the files of job id
+func removeJob(id string) {
+	for _, ext := range []string{".json", ".json.bak", ".out", ".err", ".lock"} {
+		if path, err := jobPath(id, ext); err == nil {
+			os.Remove(path)
+		}
+	}
+}
+
+func runJobs(args []string) error {
+	fs := flag.NewFlagSet("jobs", flag.ContinueOnError)
+	clean := fs.Bool("clean", false, "Remove the jobs that are no longer running")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return errors.New("usage: deepseek jobs [-clean]")
+	}
+	jobs, err := listJobs()
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		infof("No jobs\n")
+		return nil
+	}
+	for _, j := range jobs {
+		if *clean {
+			if j.Status != JOB_RUNNING && j.Status != JOB_STARTING {
+				removeJob(j.ID)
+				infof("Removed job %s\n", j.ID)
+			}
+			continue
+		}
+		chat := j.ChatID
+		if chat == "" {
+			chat = "-"
+		}
+		fmt.Printf("%s  %-8s  %s  %-20s  %s\n", j.ID, j.Status, j.Started.Local().Format("2006-01-02 15:04"), chat, summarize(j.Prompt, 50))
+	}
+	return nil
+}
+
+func runJob(args []string) error {
+	fs := flag.NewFlagSet("job", flag.ContinueOnError)
+	wait := fs.Bool("wait", false, "Wait for the job to finish")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errors.New("usage: deepseek job <id> [-wait]")
+	}
+	j, err := loadJob(args[0])
+	if err != nil {
+		return err
+	}
+	for *wait && (j.Status == JOB_RUNNING || j.Status == JOB_STARTING) {
+		time.Sleep(200 * time.Millisecond)
+		if j, err = loadJob(j.ID); err != nil {
+			return err
+		}
+	}
+	status := j.Status
+	if j.Finished != nil {
+		status += fmt.Sprintf(" after %s", j.Finished.Sub(j.Started).Round(time.Second))
+	}
+	if j.ChatID != "" {
+		status += ", chat " + j.ChatID
+	}
+	infof("Job %s %s\n", j.ID, status)
+	if path, err := jobPath(j.ID, ".out"); err == nil {
+		if data, err := os.ReadFile(path); err == nil {
+			os.Stdout.Write(data)
+			// An answer still streaming, or cut short
+			if len(data) > 0 && data[len(data)-1] != '\n' {
+				fmt.Println()
+			}
+		}
+	}
+	return jobResult(j)
+}
+
+// Report how job j ended: with the errors of a failed job, exiting with
+// its status
+func jobResult(j job) error {
+	switch j.Status {
+	case JOB_FAILED, JOB_LOST:
+		if path, err := jobPath(j.ID, ".err"); err == nil {
+			if data, err := os.ReadFile(path); err == nil {
+				os.Stderr.Write(data)
+			}
+		}
+		if j.Status == JOB_LOST {
+			return fmt.Errorf("job %s ended without finishing", j.ID)
+		}
+		setExitStatus(max(j.ExitCode, EXIT_ERROR))
+	}
+	return nil
+}
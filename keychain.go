@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+const (
+	// Service and account the API key is stored under in the keychain
+	KEYCHAIN_SERVICE = "deepseek"
+	KEYCHAIN_ACCOUNT = "api-key"
+)
+
+var errKeyNotStored = errors.New("no API key stored in the keychain")
+
+// The keychain account of the key of p
+func keychainAccount(p provider) string {
+	if p.name == DEFAULT_PROVIDER {
+		return KEYCHAIN_ACCOUNT
+	}
+	return KEYCHAIN_ACCOUNT + "-" + p.name
+}
+
+func init() {
+	registerCommand(command{
+		name:  "auth",
+		usage: "login | logout | status  keep the API key in the system keychain",
+		run:   runAuth,
+	})
+}
+
+func runAuth(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: deepseek auth login | logout | status")
+	}
+	switch args[0] {
+	case "login":
+		key, err := readSecret("API key for " + currentProvider.name + ": ")
+		if err != nil {
+			return err
+		}
+		if key == "" {
+			return errors.New("no API key given")
+		}
+		if err := keychainSet(keychainAccount(currentProvider), key); err != nil {
+			return fmt.Errorf("storing the API key: %w", err)
+		}
+		infof("API key stored in the %s.\n", keychainName())
+		if os.Getenv(currentProvider.keyEnv) != "" {
+			infof("%s is set and still takes precedence.\n", currentProvider.keyEnv)
+		}
+		return nil
+	case "logout":
+		if err := keychainDelete(keychainAccount(currentProvider)); err != nil {
+			return err
+		}
+		infof("API key removed from the %s.\n", keychainName())
+		return nil
+	case "status":
+		if key := os.Getenv(currentProvider.keyEnv); key != "" {
+			fmt.Printf("API key %s from %s\n", maskSecret(key), currentProvider.keyEnv)
+			return nil
+		}
+		key, err := keychainGet(keychainAccount(currentProvider))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("API key %s from the %s\n", maskSecret(key), keychainName())
+		return nil
+	}
+	return errors.New("usage: deepseek auth login | logout | status")
+}
+
+// Read a secret from the terminal without echoing it, or the first line
+// of stdin when it isn't a terminal
+func readSecret(prompt string) (string, error) {
+	if isTerminal(os.Stdin) {
+		errorf("%s", prompt)
+		if runtime.GOOS != "windows" {
+			stty := func(arg string) {
+				cmd := exec.Command("stty", arg)
+				cmd.Stdin = os.Stdin
+				cmd.Run()
+			}
+			stty("-echo")
+			defer func() {
+				stty("echo")
+				errorf("\n")
+			}()
+		}
+	}
+	line, err := stdinReader.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("reading the API key: %w", err)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// The start and end of a secret, enough to tell keys apart
+func maskSecret(secret string) string {
+	if len(secret) <= 8 {
+		return strings.Repeat("*", len(secret))
+	}
+	return secret[:3] + "…" + secret[len(secret)-4:]
+}
+
+// What the system keychain is called on this platform
+func keychainName() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "macOS Keychain"
+	case "windows":
+		return "Windows Credential Manager"
+	}
+	return "Secret Service keyring"
+}
+
+// Run a keychain tool, returning its output without the final newline
+func keychainTool(stdin string, name string, args ...string) (string, error) {
+	if _, err := exec.LookPath(name); err != nil {
+		if runtime.GOOS == "darwin" {
+			return "", fmt.Errorf("%s not found", name)
+		}
+		return "", fmt.Errorf("%s not found (install libsecret-tools)", name)
+	}
+	cmd := exec.Command(name, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %w: %s", name, err, msg)
+		}
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
+
+// The API key stored by `auth login` under account, or errKeyNotStored
+func keychainGet(account string) (string, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		key, err := keychainTool("", "security", "find-generic-password", "-s", KEYCHAIN_SERVICE, "-a", account, "-w")
+		// Exits with an error when there is no such item
+		var exit *exec.ExitError
+		if errors.As(err, &exit) {
+			return "", errKeyNotStored
+		}
+		return key, err
+	case "windows":
+		return windowsCredentialGet(account)
+	}
+	key, err := keychainTool("", "secret-tool", "lookup", "service", KEYCHAIN_SERVICE, "account", account)
+	var exit *exec.ExitError
+	if errors.As(err, &exit) || err == nil && key == "" {
+		return "", errKeyNotStored
+	}
+	return key, err
+}
+
+func keychainSet(account, key string) error {
+	var err error
+	switch runtime.GOOS {
+	case "darwin":
+		_, err = keychainTool("", "security", "add-generic-password", "-U", "-s", KEYCHAIN_SERVICE, "-a", account, "-l", "deepseek "+account, "-w", key)
+	case "windows":
+		err = windowsCredentialSet(account, key)
+	default:
+		_, err = keychainTool(key, "secret-tool", "store", "--label=deepseek "+account, "service", KEYCHAIN_SERVICE, "account", account)
+	}
+	return err
+}
+
+func keychainDelete(account string) error {
+	if _, err := keychainGet(account); err != nil {
+		return err
+	}
+	var err error
+	switch runtime.GOOS {
+	case "darwin":
+		_, err = keychainTool("", "security", "delete-generic-password", "-s", KEYCHAIN_SERVICE, "-a", account)
+	case "windows":
+		err = windowsCredentialDelete(account)
+	default:
+		_, err = keychainTool("", "secret-tool", "clear", "service", KEYCHAIN_SERVICE, "account", account)
+	}
+	return err
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+// The Windows Credential Manager only exists on Windows
+var errNoCredentialManager = errors.New("the Windows Credential Manager is not available")
+
+func windowsCredentialGet(account string) (string, error) {
+	return "", errNoCredentialManager
+}
+
+func windowsCredentialSet(account, secret string) error {
+	return errNoCredentialManager
+}
+
+func windowsCredentialDelete(account string) error {
+	return errNoCredentialManager
+}
@@ -0,0 +1,87 @@
+//go:build windows
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const (
+	CRED_TYPE_GENERIC          = 1
+	CRED_PERSIST_LOCAL_MACHINE = 2
+	ERROR_NOT_FOUND            = syscall.Errno(1168)
+)
+
+var (
+	advapi32       = syscall.NewLazyDLL("advapi32.dll")
+	procCredReadW  = advapi32.NewProc("CredReadW")
+	procCredWriteW = advapi32.NewProc("CredWriteW")
+	procCredDelete = advapi32.NewProc("CredDeleteW")
+	procCredFree   = advapi32.NewProc("CredFree")
+)
+
+// CREDENTIALW of the Windows Credential Manager
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// The Credential Manager target the API key of account is stored under
+func credentialTarget(account string) *uint16 {
+	target, _ := syscall.UTF16PtrFromString(KEYCHAIN_SERVICE + ":" + account)
+	return target
+}
+
+func windowsCredentialGet(account string) (string, error) {
+	var cred *credential
+	r, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(credentialTarget(account))), CRED_TYPE_GENERIC, 0, uintptr(unsafe.Pointer(&cred)))
+	if r == 0 {
+		if err == ERROR_NOT_FOUND {
+			return "", errKeyNotStored
+		}
+		return "", err
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+	return string(unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)), nil
+}
+
+func windowsCredentialSet(account, secret string) error {
+	blob := []byte(secret)
+	user, _ := syscall.UTF16PtrFromString(account)
+	cred := credential{
+		Type:               CRED_TYPE_GENERIC,
+		TargetName:         credentialTarget(account),
+		CredentialBlobSize: uint32(len(blob)),
+		Persist:            CRED_PERSIST_LOCAL_MACHINE,
+		UserName:           user,
+	}
+	if len(blob) > 0 {
+		cred.CredentialBlob = &blob[0]
+	}
+	if r, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0); r == 0 {
+		return err
+	}
+	return nil
+}
+
+func windowsCredentialDelete(account string) error {
+	r, _, err := procCredDelete.Call(uintptr(unsafe.Pointer(credentialTarget(account))), CRED_TYPE_GENERIC, 0)
+	if r == 0 {
+		if err == ERROR_NOT_FOUND {
+			return errKeyNotStored
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	// Where round-robin rotation keeps the index of the next key
+	KEY_STATE_FILE = "keys.json"
+	KEYS_FAILOVER  = "failover"
+	KEYS_ROTATE    = "round-robin"
+)
+
+var (
+	// Keys of api_keys in the config file
+	configuredKeys []string
+	// api_key_strategy: KEYS_FAILOVER tries the keys in order, KEYS_ROTATE
+	// starts each request with the next one
+	keyStrategy = KEYS_FAILOVER
+)
+
+// The API keys of the current provider
+func apiKeys() []string {
+	return providerKeys(currentProvider)
+}
+
+// The API keys of p, from its environment variable (separated by commas),
+// such as DEEPSEEK_API_KEY, or api_keys in the config file
+func providerKeys(p provider) []string {
+	if keys := splitKeys(os.Getenv(p.keyEnv)); len(keys) > 0 {
+		return keys
+	}
+	return p.keys
+}
+
+func splitKeys(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+}
+
+// The key to send a request with first: the first key, or with round-robin
+// rotation the one after the key the previous request started with
+func pickAPIKey(keys []string) string {
+	if keyStrategy != KEYS_ROTATE || len(keys) < 2 {
+		return keys[0]
+	}
+	var state struct {
+		Next int `json:"next"`
+	}
+	path, err := dataPath(KEY_STATE_FILE)
+	if err != nil {
+		return keys[0]
+	}
+	// Parallel invocations and the daemon each take the next key
+	unlock, err := lockPath(path+".lock", "API key rotation")
+	if err != nil {
+		return keys[0]
+	}
+	defer unlock()
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &state)
+	}
+	key := keys[max(state.Next, 0)%len(keys)]
+	state.Next = (max(state.Next, 0) + 1) % len(keys)
+	if data, err := json.Marshal(state); err == nil {
+		writeFileAtomic(path, data, 0600)
+	}
+	return key
+}
+
+// Whether a response with this status may succeed with another key:
+// invalid key, insufficient balance and rate limit
+func keyFailed(status int) bool {
+	return status == http.StatusUnauthorized || status == http.StatusPaymentRequired || status == http.StatusTooManyRequests
+}
+
+// The key of p to retry with after current failed, when tried keys
+// haven't been tried yet; "" when there is none
+func nextAPIKey(p provider, current string, tried int) string {
+	keys := providerKeys(p)
+	if tried >= len(keys) {
+		return ""
+	}
+	for i, key := range keys {
+		if key == current {
+			return keys[(i+1)%len(keys)]
+		}
+	}
+	return ""
+}
+
+// Log which key serves a request, masked, with -debug
+func logAPIKey(key string) {
+	if debug != nil && *debug && len(apiKeys()) > 1 {
+		log.Printf("Using API key %s\n", maskSecret(key))
+	}
+}
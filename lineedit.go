@@ -0,0 +1,393 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// The prompts typed in the REPL, one per line, apart from the chats
+	PROMPT_HISTORY_FILE = "prompt_history"
+	// Lines of it kept
+	PROMPT_HISTORY_SIZE = 1000
+)
+
+// A line editor reading the REPL input in raw mode: arrows and Emacs keys
+// move and edit, Up and Down recall the prompt history, Ctrl-R searches it,
+// Tab completes
+type lineEditor struct {
+	history []string
+	path    string
+	// Tab completion: where the word before pos starts and what may
+	// replace it
+	complete func(line []rune, pos int) (int, []string)
+}
+
+func newLineEditor() *lineEditor {
+	e := &lineEditor{}
+	path, err := dataPath(PROMPT_HISTORY_FILE)
+	if err != nil {
+		errorf("Warning: no prompt history: %v\n", err)
+		return e
+	}
+	e.path = path
+	if data, err := os.ReadFile(path); err == nil {
+		e.history = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+		if len(e.history) == 1 && e.history[0] == "" {
+			e.history = nil
+		}
+	}
+	if len(e.history) > PROMPT_HISTORY_SIZE {
+		// The file is trimmed once it has grown by as much again
+		trim := len(e.history) > 2*PROMPT_HISTORY_SIZE
+		e.history = e.history[len(e.history)-PROMPT_HISTORY_SIZE:]
+		if trim {
+			e.save()
+		}
+	}
+	return e
+}
+
+// Rewrite the history file with the lines kept
+func (e *lineEditor) save() {
+	if err := writeFileAtomic(e.path, []byte(strings.Join(e.history, "\n")+"\n"), 0600); err != nil {
+		errorf("Warning: saving the prompt history: %v\n", err)
+	}
+}
+
+// Add a line to the history, unless it repeats the last one
+func (e *lineEditor) remember(line string) {
+	if line == "" || strings.Contains(line, "\n") || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+	e.history = append(e.history, line)
+	if e.path == "" {
+		return
+	}
+	f, err := os.OpenFile(e.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err == nil {
+		_, err = fmt.Fprintln(f, line)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		errorf("Warning: saving the prompt history: %v\n", err)
+	}
+}
+
+// Read a line after prompt, shown in the prompt color on a terminal.
+// Without one, or raw mode, the line is read as is; otherwise Ctrl-C
+// clears it, returning errInterrupted, and Ctrl-D on an empty line returns
+// io.EOF.
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	if !isTerminal(os.Stderr) {
+		fmt.Fprint(os.Stderr, prompt)
+		return readPlainLine()
+	}
+	var restore func()
+	err := errors.New("not a terminal")
+	if isTerminal(os.Stdin) {
+		restore, err = makeRaw(os.Stdin)
+	}
+	if err != nil {
+		fmt.Fprint(os.Stderr, colorize(prompt, colors.prompt))
+		return readPlainLine()
+	}
+	defer restore()
+	s := &editState{editor: e, prompt: prompt, recall: len(e.history)}
+	for {
+		s.draw()
+		key, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+		done, err := s.handle(key)
+		if done || err != nil {
+			s.draw()
+			if err != io.EOF {
+				fmt.Fprint(os.Stderr, "\r\n")
+			}
+			line := string(s.line)
+			if err == nil {
+				e.remember(line)
+			}
+			return line, err
+		}
+	}
+}
+
+// Read a line of input without editing
+func readPlainLine() (string, error) {
+	line, err := stdinReader.ReadString('\n')
+	if err == io.EOF && line != "" {
+		return line, nil
+	}
+	return line, err
+}
+
+// Read a key, escape sequences and multi-byte characters whole
+func (e *lineEditor) readKey() (string, error) {
+	keys := stdinReader
+	b, err := keys.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case b == '\033' && keys.Buffered() > 0:
+		next, _ := keys.ReadByte()
+		if next != '[' && next != 'O' {
+			return "\033" + string(next), nil
+		}
+		seq := []byte{b, next}
+		for {
+			c, err := keys.ReadByte()
+			if err != nil {
+				return string(seq), nil
+			}
+			seq = append(seq, c)
+			if c >= 0x40 && c <= 0x7e {
+				return string(seq), nil
+			}
+		}
+	case b >= 0x80:
+		keys.UnreadByte()
+		r, _, err := keys.ReadRune()
+		return string(r), err
+	}
+	return string(b), nil
+}
+
+// The line being edited
+type editState struct {
+	editor *lineEditor
+	prompt string
+	line   []rune
+	pos    int
+	// The history entry shown, len(history) for the new line, kept in draft
+	recall int
+	draft  []rune
+	// Ctrl-R search, and the entry it matched
+	searching bool
+	term      string
+	match     int
+}
+
+// Act on a key; true once the line is entered
+func (s *editState) handle(key string) (bool, error) {
+	if s.searching {
+		if s.searchKey(key) {
+			return false, nil
+		}
+	}
+	switch key {
+	case "\r", "\n":
+		return true, nil
+	case "\x03":
+		s.line, s.pos = nil, 0
+		return true, errInterrupted
+	case "\x04":
+		if len(s.line) == 0 {
+			return true, io.EOF
+		}
+		s.delete(s.pos, s.pos+1)
+	case "\x7f", "\b":
+		s.delete(s.pos-1, s.pos)
+	case "\033[3~":
+		s.delete(s.pos, s.pos+1)
+	case "\033[D", "\x02":
+		s.pos = max(s.pos-1, 0)
+	case "\033[C", "\x06":
+		s.pos = min(s.pos+1, len(s.line))
+	case "\033[H", "\033OH", "\x01":
+		s.pos = 0
+	case "\033[F", "\033OF", "\x05":
+		s.pos = len(s.line)
+	case "\033b", "\033[1;5D":
+		s.pos = s.wordStart()
+	case "\033f", "\033[1;5C":
+		for s.pos < len(s.line) && s.line[s.pos] == ' ' {
+			s.pos++
+		}
+		for s.pos < len(s.line) && s.line[s.pos] != ' ' {
+			s.pos++
+		}
+	case "\x15":
+		s.delete(0, s.pos)
+	case "\x0b":
+		s.delete(s.pos, len(s.line))
+	case "\x17":
+		s.delete(s.wordStart(), s.pos)
+	case "\033[A", "\x10":
+		s.recallEntry(s.recall - 1)
+	case "\033[B", "\x0e":
+		s.recallEntry(s.recall + 1)
+	case "\x12":
+		s.searching, s.term, s.match = true, "", len(s.editor.history)
+	case "\x0c":
+		fmt.Fprint(os.Stderr, "\033[H\033[2J")
+	case "\t":
+		s.completeWord()
+	default:
+		if r := []rune(key); len(r) == 1 && r[0] >= ' ' {
+			s.line = append(s.line[:s.pos], append([]rune{r[0]}, s.line[s.pos:]...)...)
+			s.pos++
+		}
+	}
+	return false, nil
+}
+
+// Complete the word before the cursor: with the only candidate, else with
+// what the candidates share, else by listing them
+func (s *editState) completeWord() {
+	if s.editor.complete == nil {
+		return
+	}
+	start, candidates := s.editor.complete(s.line, s.pos)
+	if len(candidates) == 0 {
+		fmt.Fprint(os.Stderr, "\a")
+		return
+	}
+	word := candidates[0]
+	if len(candidates) == 1 && !strings.HasSuffix(word, "/") {
+		word += " "
+	}
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, word) {
+			_, size := utf8.DecodeLastRuneInString(word)
+			word = word[:len(word)-size]
+		}
+	}
+	if word == string(s.line[start:s.pos]) {
+		listCandidates(candidates)
+		return
+	}
+	s.line = append(append(s.line[:start:start], []rune(word)...), s.line[s.pos:]...)
+	s.pos = start + len([]rune(word))
+}
+
+// Print the candidates of a completion in columns under the line
+func listCandidates(candidates []string) {
+	width, _, _ := terminalSize(os.Stderr)
+	column := 0
+	for _, c := range candidates {
+		column = max(column, displayWidth(c)+2)
+	}
+	perRow := max(width/column, 1)
+	var b strings.Builder
+	b.WriteString("\r\n")
+	for i, c := range candidates {
+		b.WriteString(padWidth(c, column, false))
+		if (i+1)%perRow == 0 || i == len(candidates)-1 {
+			b.WriteString("\r\n")
+		}
+	}
+	fmt.Fprint(os.Stderr, b.String())
+}
+
+// Delete the runes from start to end
+func (s *editState) delete(start, end int) {
+	start, end = max(start, 0), min(end, len(s.line))
+	if start >= end {
+		return
+	}
+	s.line = append(s.line[:start], s.line[end:]...)
+	s.pos = start
+}
+
+// Where the word before the cursor starts
+func (s *editState) wordStart() int {
+	i := s.pos
+	for i > 0 && s.line[i-1] == ' ' {
+		i--
+	}
+	for i > 0 && s.line[i-1] != ' ' {
+		i--
+	}
+	return i
+}
+
+// Show history entry i, or the line being written past the last one
+func (s *editState) recallEntry(i int) {
+	history := s.editor.history
+	if i < 0 || i > len(history) {
+		return
+	}
+	if s.recall == len(history) {
+		s.draft = s.line
+	}
+	s.recall = i
+	if i == len(history) {
+		s.line = s.draft
+	} else {
+		s.line = []rune(history[i])
+	}
+	s.pos = len(s.line)
+}
+
+// Handle a key of a Ctrl-R search: typing narrows it, Ctrl-R goes to an
+// older match, Ctrl-G or Esc gives up. Other keys take the match and are
+// handled as usual; false for those.
+func (s *editState) searchKey(key string) bool {
+	switch key {
+	case "\x12":
+		s.find(s.match - 1)
+		return true
+	case "\x07", "\033":
+		s.searching = false
+		return true
+	case "\x7f", "\b":
+		if r := []rune(s.term); len(r) > 0 {
+			s.term = string(r[:len(r)-1])
+		}
+		s.find(len(s.editor.history) - 1)
+		return true
+	}
+	if r := []rune(key); len(r) == 1 && r[0] >= ' ' {
+		s.term += key
+		s.find(s.match)
+		return true
+	}
+	s.searching = false
+	return false
+}
+
+// Match the newest entry from i back containing the search term
+func (s *editState) find(i int) {
+	history := s.editor.history
+	for i = min(i, len(history)-1); i >= 0; i-- {
+		if strings.Contains(history[i], s.term) {
+			s.match, s.recall = i, i
+			s.line = []rune(history[i])
+			s.pos = len(s.line)
+			return
+		}
+	}
+}
+
+// Redraw the line, scrolled to keep the cursor in view
+func (s *editState) draw() {
+	prompt := s.prompt
+	if s.searching {
+		prompt = fmt.Sprintf("(reverse-i-search)'%s': ", s.term)
+	}
+	width, _, _ := terminalSize(os.Stderr)
+	room := max(width-displayWidth(prompt)-1, 10)
+	start := 0
+	for displayWidth(string(s.line[start:s.pos])) > room {
+		start++
+	}
+	end := start
+	for end < len(s.line) && displayWidth(string(s.line[start:end+1])) <= room {
+		end++
+	}
+	back := displayWidth(string(s.line[s.pos:end]))
+	fmt.Fprintf(os.Stderr, "\r\033[K%s%s", colorize(prompt, colors.prompt), string(s.line[start:end]))
+	if back > 0 {
+		fmt.Fprintf(os.Stderr, "\033[%dD", back)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	LOCK_FILE    = "lock"
+	LOCK_TIMEOUT = 10 * time.Second
+)
+
+// Take the cross-process history lock, waiting up to LOCK_TIMEOUT for other
+// deepseek processes to release it
+func lockHistory() (func(), error) {
+	return lockPath(filepath.Join(historyDir, LOCK_FILE), "history")
+}
+
+// Take an exclusive lock on the file at path, creating it if needed. what
+// names the data it guards in errors.
+func lockPath(path, what string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening lock file: %w", err)
+	}
+
+	deadline := time.Now().Add(LOCK_TIMEOUT)
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("locking %s: %w", what, err)
+		}
+		if locked {
+			return func() {
+				unlockFile(f)
+				f.Close()
+			}, nil
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("%s is locked by another deepseek process (waited %s on %s)", what, LOCK_TIMEOUT, path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
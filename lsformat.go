@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats of -ls besides the table
+var listFormats = map[string]func(w io.Writer, records []chatRecord) error{
+	"json": writeListJSON,
+	"csv":  writeListCSV,
+	"yaml": writeListYAML,
+}
+
+// One chat of a machine-readable listing
+type chatRecord struct {
+	ID               string    `json:"id"`
+	Name             string    `json:"name,omitempty"`
+	Title            string    `json:"title,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+	Messages         int       `json:"messages"`
+	Model            string    `json:"model,omitempty"`
+	Tags             []string  `json:"tags"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	TotalTokens      int       `json:"total_tokens"`
+	Current          bool      `json:"current"`
+	Pinned           bool      `json:"pinned"`
+	Archived         bool      `json:"archived"`
+	LastUserMessage  string    `json:"last_user_message,omitempty"`
+}
+
+func recordFor(id string, meta ChatMeta) chatRecord {
+	tags := meta.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return chatRecord{
+		ID:               id,
+		Name:             meta.Name,
+		Title:            meta.Title,
+		CreatedAt:        meta.CreatedAt,
+		UpdatedAt:        meta.UpdatedAt,
+		Messages:         meta.Messages,
+		Model:            meta.Model,
+		Tags:             tags,
+		PromptTokens:     meta.PromptTokens,
+		CompletionTokens: meta.CompletionTokens,
+		TotalTokens:      meta.PromptTokens + meta.CompletionTokens,
+		Current:          id == lastChatID,
+		Pinned:           meta.Pinned,
+		Archived:         meta.Archived,
+		LastUserMessage:  meta.LastUserMessage,
+	}
+}
+
+func writeListJSON(w io.Writer, records []chatRecord) error {
+	if records == nil {
+		records = []chatRecord{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(records)
+}
+
+// The fields of a record in the column order of csv and yaml
+func recordFields(r chatRecord) [][2]string {
+	return [][2]string{
+		{"id", r.ID},
+		{"name", r.Name},
+		{"title", r.Title},
+		{"created_at", r.CreatedAt.Format(time.RFC3339)},
+		{"updated_at", r.UpdatedAt.Format(time.RFC3339)},
+		{"messages", strconv.Itoa(r.Messages)},
+		{"model", r.Model},
+		{"tags", strings.Join(r.Tags, ",")},
+		{"prompt_tokens", strconv.Itoa(r.PromptTokens)},
+		{"completion_tokens", strconv.Itoa(r.CompletionTokens)},
+		{"total_tokens", strconv.Itoa(r.TotalTokens)},
+		{"current", strconv.FormatBool(r.Current)},
+		{"pinned", strconv.FormatBool(r.Pinned)},
+		{"archived", strconv.FormatBool(r.Archived)},
+		{"last_user_message", r.LastUserMessage},
+	}
+}
+
+func writeListCSV(w io.Writer, records []chatRecord) error {
+	cw := csv.NewWriter(w)
+	var header []string
+	for _, field := range recordFields(chatRecord{}) {
+		header = append(header, field[0])
+	}
+	cw.Write(header)
+	for _, r := range records {
+		var row []string
+		for _, field := range recordFields(r) {
+			row = append(row, field[1])
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Write the records as a YAML sequence. Strings are written as JSON, which
+// YAML reads as double-quoted scalars; tags become a flow sequence.
+func writeListYAML(w io.Writer, records []chatRecord) error {
+	if len(records) == 0 {
+		_, err := fmt.Fprintln(w, "[]")
+		return err
+	}
+	quote := func(s string) string {
+		data, _ := json.Marshal(s)
+		return string(data)
+	}
+	for _, r := range records {
+		prefix := "- "
+		for _, field := range recordFields(r) {
+			value := quote(field[1])
+			switch field[0] {
+			case "messages", "prompt_tokens", "completion_tokens", "total_tokens", "current", "pinned", "archived":
+				value = field[1]
+			case "tags":
+				quoted := make([]string, len(r.Tags))
+				for i, tag := range r.Tags {
+					quoted[i] = quote(tag)
+				}
+				value = "[" + strings.Join(quoted, ", ") + "]"
+			}
+			if _, err := fmt.Fprintf(w, "%s%s: %s\n", prefix, field[0], value); err != nil {
+				return err
+			}
+			prefix = "  "
+		}
+	}
+	return nil
+}
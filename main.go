@@ -1,21 +1,22 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
-	"crypto/rand"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 )
 
@@ -25,31 +26,69 @@ type column struct {
 	name     string
 	format   string
 	width    int
-	getValue func(asterisk string, chatId string, age string, created string, lastMsg string) string
+	getValue func(row chatRow) string
+}
+
+// The values shown for one chat by -ls
+type chatRow struct {
+	asterisk, chatID, name, age, created, title, lastMsg, tags string
+	updated, messages, model, tokens                           string
 }
 
 const (
-	STATUS_URL = "https://status.deepseek.com/api/v2/status.json"
-	CHAT_URL   = "https://api.deepseek.com/v1/chat/completions"
-	MODELS_URL = "https://api.deepseek.com/v1/models"
+	STATUS_URL       = "https://status.deepseek.com/api/v2/status.json"
+	DEFAULT_BASE_URL = "https://api.deepseek.com/v1"
 )
 
+// The flags given on the command line, without ask, for the processes an
+// invocation starts
+var invocationFlags []string
+
+// Base URL of the chat completions API, set by -base-url
+var apiBaseURL = DEFAULT_BASE_URL
+
+// URL of an endpoint of the API, e.g. chat/completions
+func apiURL(endpoint string) string {
+	return endpointURL(apiBaseURL, endpoint)
+}
+
+// URL of an endpoint of the API at baseURL
+func endpointURL(baseURL, endpoint string) string {
+	return strings.TrimSuffix(baseURL, "/") + "/" + endpoint
+}
+
+// Check that -base-url is an absolute http(s) URL
+func checkBaseURL() error {
+	u, err := url.Parse(apiBaseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("-base-url %q is not an http(s) URL", apiBaseURL)
+	}
+	return nil
+}
+
 func checkServiceStatus() {
-	resp, err := http.Get(STATUS_URL)
+	req, err := http.NewRequest("GET", STATUS_URL, nil)
 	if err != nil {
-		fmt.Println("Error fetching service status:", err)
+		errorf("Error fetching service status: %v\n", err)
+		return
+	}
+	resp, err := sendRequest(req, API_TIMEOUT, 0)
+	if err != nil {
+		errorf("Error fetching service status: %v\n", err)
+		setExitStatus(EXIT_NETWORK)
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		fmt.Printf("Failed to get service status: %s\n", resp.Status)
+		errorf("Failed to get service status: %s\n", resp.Status)
+		setExitStatus(EXIT_ERROR)
 		return
 	}
 
 	var result map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		fmt.Println("Error parsing JSON response:", err)
+		errorf("Error parsing JSON response: %v\n", err)
 		return
 	}
 
@@ -71,10 +110,151 @@ func checkServiceStatus() {
 	fmt.Printf("Service Status: %s %s - %s\n", emoji, indicator, status["description"])
 }
 
-func listChats() {
+// What -ls lists and how
+type listOptions struct {
+	// tag, when set, only lists chats carrying it
+	tag string
+	// all also lists archived chats
+	all bool
+	// format is one of listFormats, or empty for the table
+	format string
+	// columns are the ids of the table columns, empty for the default ones
+	columns []string
+	// sort is a key of listSorts; without one pinned chats come first,
+	// then the newest
+	sort    string
+	reverse bool
+	// since, when set, only lists chats used after it
+	since time.Time
+	// model, when set, only lists chats whose latest answer came from it
+	model string
+	// grep, when set, only lists chats containing it, ignoring case
+	grep string
+	// offset chats are skipped and at most limit listed, when above 0
+	offset, limit int
+	// page shows a table taller than the terminal through $PAGER
+	page bool
+	// noTrunc shows whole values instead of cutting them at the column width
+	noTrunc bool
+	// watch, when set, redraws the table at this interval
+	watch time.Duration
+}
+
+// Orders of -ls -sort, each in its natural direction
+var listSorts = map[string]func(a, b ChatMeta) bool{
+	"age":      func(a, b ChatMeta) bool { return a.CreatedAt.After(b.CreatedAt) },
+	"created":  func(a, b ChatMeta) bool { return a.CreatedAt.Before(b.CreatedAt) },
+	"updated":  func(a, b ChatMeta) bool { return a.UpdatedAt.After(b.UpdatedAt) },
+	"messages": func(a, b ChatMeta) bool { return a.Messages > b.Messages },
+	"tokens": func(a, b ChatMeta) bool {
+		return a.PromptTokens+a.CompletionTokens > b.PromptTokens+b.CompletionTokens
+	},
+	"name":  func(a, b ChatMeta) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) },
+	"title": func(a, b ChatMeta) bool { return strings.ToLower(a.Title) < strings.ToLower(b.Title) },
+}
+
+// The chats -ls lists, in the order of opts
+func listedChatIDs(opts listOptions) []string {
+	ids := sortedChatIDs()
+	if less, ok := listSorts[opts.sort]; ok {
+		sort.SliceStable(ids, func(i, j int) bool {
+			a, b := chatIndex[ids[i]], chatIndex[ids[j]]
+			if opts.reverse {
+				a, b = b, a
+			}
+			return less(a, b)
+		})
+	} else {
+		sort.SliceStable(ids, func(i, j int) bool { return chatIndex[ids[i]].Pinned && !chatIndex[ids[j]].Pinned })
+		if opts.reverse {
+			for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+				ids[i], ids[j] = ids[j], ids[i]
+			}
+		}
+	}
+	listed := ids[:0]
+	for _, id := range ids {
+		meta := chatIndex[id]
+		if opts.tag != "" && !hasTag(meta.Tags, opts.tag) || meta.Archived && !opts.all {
+			continue
+		}
+		if meta.UpdatedAt.Before(opts.since) || opts.model != "" && !strings.EqualFold(meta.Model, opts.model) {
+			continue
+		}
+		if opts.grep != "" && !chatContains(id, meta, strings.ToLower(opts.grep)) {
+			continue
+		}
+		listed = append(listed, id)
+	}
+	listed = listed[min(opts.offset, len(listed)):]
+	if opts.limit > 0 && opts.limit < len(listed) {
+		listed = listed[:opts.limit]
+	}
+	return listed
+}
+
+// Whether the chat's id, name, title, tags or any message contains the
+// lowercase text
+func chatContains(id string, meta ChatMeta, text string) bool {
+	for _, field := range append([]string{id, meta.Name, meta.Title, meta.LastUserMessage}, meta.Tags...) {
+		if strings.Contains(strings.ToLower(field), text) {
+			return true
+		}
+	}
+	chat, _, err := loadChat(id)
+	if err != nil {
+		return false
+	}
+	for _, msg := range chat.Messages {
+		if msg.Role != "system" && strings.Contains(strings.ToLower(msg.Content), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// List the chats of the index as a table, or as records in opts.format
+func listChats(opts listOptions) error {
 	mutex.Lock()
 	defer mutex.Unlock()
 
+	if _, ok := listSorts[opts.sort]; opts.sort != "" && !ok {
+		keys := make([]string, 0, len(listSorts))
+		for key := range listSorts {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return fmt.Errorf("unknown sort key %q, use one of %s", opts.sort, strings.Join(keys, ", "))
+	}
+	if write, ok := listFormats[opts.format]; ok {
+		var records []chatRecord
+		for _, id := range listedChatIDs(opts) {
+			records = append(records, recordFor(id, chatIndex[id]))
+		}
+		return write(os.Stdout, records)
+	}
+	if opts.watch > 0 {
+		return watchChats(opts)
+	}
+
+	table, err := chatTable(opts, nil)
+	if err != nil {
+		return err
+	}
+	// Keep the newest chats on screen when the table is taller than it
+	if opts.page && isTerminal(os.Stdout) {
+		width, height, _ := terminalSize(os.Stdout)
+		if displayRows(table, width) > height {
+			return page(table)
+		}
+	}
+	fmt.Print(table)
+	return nil
+}
+
+// Render the -ls table. style, when set, gives the SGR code to show the
+// row of a chat in, if any. The caller holds mutex.
+func chatTable(opts listOptions, style func(id string) string) (string, error) {
 	// Define columns and their order
 	columns := []column{
 		{
@@ -82,183 +262,257 @@ func listChats() {
 			name:     "",
 			format:   "%-2s",
 			width:    2,
-			getValue: func(asterisk, _, _, _, _ string) string { return asterisk },
+			getValue: func(row chatRow) string { return row.asterisk },
 		},
 		{
 			id:       "chat_id",
 			name:     "CHAT ID",
-			format:   "%-18s",
-			width:    18,
-			getValue: func(_, chatId, _, _, _ string) string { return chatId },
+			format:   "%-22s",
+			width:    22,
+			getValue: func(row chatRow) string { return row.chatID },
+		},
+		{
+			id:       "name",
+			name:     "NAME",
+			format:   "%-16s",
+			width:    16,
+			getValue: func(row chatRow) string { return row.name },
 		},
 		{
 			id:       "age",
 			name:     "AGE",
 			format:   "%-10s",
 			width:    10,
-			getValue: func(_, _, age, _, _ string) string { return age },
+			getValue: func(row chatRow) string { return row.age },
 		},
 		{
 			id:       "created_at",
 			name:     "CREATED AT",
 			format:   "%-20s",
 			width:    20,
-			getValue: func(_, _, _, created, _ string) string { return created },
+			getValue: func(row chatRow) string { return row.created },
+		},
+		{
+			id:       "title",
+			name:     "TITLE",
+			format:   "%-30s",
+			width:    30,
+			getValue: func(row chatRow) string { return row.title },
+		},
+		{
+			id:       "tags",
+			name:     "TAGS",
+			format:   "%-12s",
+			width:    12,
+			getValue: func(row chatRow) string { return row.tags },
 		},
 		{
 			id:       "last_message",
 			name:     "LAST USER MESSAGE",
 			format:   "%-30s",
 			width:    30,
-			getValue: func(_, _, _, _, lastMsg string) string { return lastMsg },
+			getValue: func(row chatRow) string { return row.lastMsg },
 		},
 	}
-
-	// Build format string and print headers
-	headers := make([]string, len(columns))
-	values := make([]interface{}, len(columns))
-	valuesFmt := make([]string, len(columns))
-	for i, col := range columns {
-		headers[i] = fmt.Sprintf(col.format, col.name)
-		valuesFmt[i] += col.format
+	// Further columns for -columns
+	extraColumns := []column{
+		{
+			id:       "updated_at",
+			name:     "UPDATED AT",
+			format:   "%-20s",
+			width:    20,
+			getValue: func(row chatRow) string { return row.updated },
+		},
+		{
+			id:       "messages",
+			name:     "MSGS",
+			format:   "%5s",
+			width:    5,
+			getValue: func(row chatRow) string { return row.messages },
+		},
+		{
+			id:       "model",
+			name:     "MODEL",
+			format:   "%-18s",
+			width:    18,
+			getValue: func(row chatRow) string { return row.model },
+		},
+		{
+			id:       "tokens",
+			name:     "TOKENS",
+			format:   "%8s",
+			width:    8,
+			getValue: func(row chatRow) string { return row.tokens },
+		},
 	}
-	fmt.Println(strings.Join(headers, " "))
-
-	// Convert map to slice for sorting
-	type chatEntry struct {
-		id   string
-		chat Chat
+	if len(opts.columns) > 0 {
+		selected, err := selectColumns(append(columns, extraColumns...), opts.columns)
+		if err != nil {
+			return "", err
+		}
+		columns = selected
 	}
-	var chats []chatEntry
-	for id, chat := range chatHistory {
-		chats = append(chats, chatEntry{id, chat})
+
+	// Fit a value to its column by display width, so wide characters such
+	// as CJK text and emoji keep the columns aligned
+	cell := func(col column, value string) string {
+		value = singleLine(value)
+		if !opts.noTrunc {
+			value = truncateWidth(value, col.width)
+		}
+		return padWidth(value, col.width, !strings.HasPrefix(col.format, "%-"))
 	}
 
-	// Sort by creation time, newest first
-	sort.Slice(chats, func(i, j int) bool {
-		return chats[i].chat.CreatedAt.After(chats[j].chat.CreatedAt)
-	})
+	// Print headers
+	cells := make([]string, len(columns))
+	for i, col := range columns {
+		cells[i] = cell(col, col.name)
+	}
+	var table strings.Builder
+	fmt.Fprintln(&table, strings.Join(cells, " "))
 
 	// Print each chat entry
-	for _, entry := range chats {
-		var lastUserMessage string
-		for i := len(entry.chat.Messages) - 1; i >= 0; i-- {
-			if entry.chat.Messages[i].Role == "user" {
-				lastUserMessage = entry.chat.Messages[i].Content
-				break
-			}
-		}
+	for _, id := range listedChatIDs(opts) {
+		meta := chatIndex[id]
+		lastUserMessage := meta.LastUserMessage
 
 		asterisk := ""
-		if entry.id == lastChatID {
+		if id == lastChatID {
 			asterisk = "*"
+		} else if meta.Pinned {
+			asterisk = "p"
+		} else if meta.Archived {
+			asterisk = "a"
 		}
 
-		age := time.Since(entry.chat.CreatedAt).Round(time.Second)
-		created := entry.chat.CreatedAt.Format(time.DateTime)
+		age := formatDuration(time.Since(meta.CreatedAt))
+		created := meta.CreatedAt.Format(time.DateTime)
 
 		// Get values for each column
+		row := chatRow{
+			asterisk: asterisk,
+			chatID:   id,
+			name:     meta.Name,
+			age:      age,
+			created:  created,
+			title:    meta.Title,
+			lastMsg:  lastUserMessage,
+			tags:     strings.Join(meta.Tags, ","),
+			updated:  meta.UpdatedAt.Local().Format(time.DateTime),
+			messages: strconv.Itoa(meta.Messages),
+			model:    meta.Model,
+			tokens:   strconv.Itoa(meta.PromptTokens + meta.CompletionTokens),
+		}
 		for i, col := range columns {
-			values[i] = col.getValue(asterisk, entry.id, fmt.Sprint(age), created, lastUserMessage)
+			cells[i] = cell(col, col.getValue(row))
 		}
 
 		// Print the row
-		fmt.Printf(strings.Join(valuesFmt, " ")+"\n", values...)
+		line := strings.Join(cells, " ")
+		if style != nil {
+			if code := style(id); code != "" {
+				line = colorize(line, code)
+			}
+		}
+		fmt.Fprintln(&table, line)
 	}
+	return table.String(), nil
+}
+
+// Short names accepted by -columns
+var columnAliases = map[string]string{
+	"id":      "chat_id",
+	"marker":  "asterisk",
+	"created": "created_at",
+	"updated": "updated_at",
+	"last":    "last_message",
+}
 
+// The columns named by ids, in that order
+func selectColumns(columns []column, ids []string) ([]column, error) {
+	byID := make(map[string]column, len(columns))
+	var known []string
+	for _, col := range columns {
+		byID[col.id] = col
+		known = append(known, col.id)
+	}
+	var selected []column
+	for _, id := range ids {
+		id = strings.ToLower(strings.TrimSpace(id))
+		if alias, ok := columnAliases[id]; ok {
+			id = alias
+		}
+		col, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q, use some of %s", id, strings.Join(known, ", "))
+		}
+		selected = append(selected, col)
+	}
+	return selected, nil
 }
 
 const (
 	API_KEY = "DEEPSEEK_API_KEY"
 	ROLE    = "DEEPSEEK_ROLE"
 	HISTORY = "DEEPSEEK_HISTORY"
+	// Set to 1 to run every prompt in incognito mode
+	NO_HISTORY = "DEEPSEEK_NO_HISTORY"
 )
 
+// Flags shared with subcommands
 var (
-	chatHistory (map[string]Chat)
-	historyFile string
-	lastChatID  string
-	mutex       = &sync.Mutex{}
+	checkStatus *bool
+	assumeYes   *bool
+	debug       *bool
+	model       *string
+	noStream    *bool
 )
 
-type Chat struct {
-	CreatedAt time.Time `json:"created_at"`
-	Messages  []Message `json:"messages"`
-}
-
-type Config struct {
-	LastChatID string          `json:"last_chat_id"`
-	History    map[string]Chat `json:"history"`
-}
-
-var checkStatus *bool
-
 func init() {
 }
 
-func loadHistory() {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		fmt.Println("Error getting home directory:", err)
-		return
-	}
-	historyFile = filepath.Join(homeDir, HISTORY)
-
-	mutex.Lock()
-	defer mutex.Unlock()
-
-	data, err := os.ReadFile(historyFile)
-	if err != nil {
-		if !os.IsNotExist(err) {
-			fmt.Println("Error reading history file:", err)
-		}
-		return
-	}
-
-	var config Config
-	err = json.Unmarshal(data, &config)
-	if err != nil {
-		fmt.Println("Error parsing history file:", err)
-		return
-	}
-	chatHistory = make(map[string]Chat)
-	if config.History != nil {
-		chatHistory = config.History
-	} else {
-		chatHistory = make(map[string]Chat)
-	}
-	lastChatID = config.LastChatID
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	// Chain of thought of reasoning models, kept for exports only
+	Reasoning string `json:"reasoning,omitempty"`
+	Model     string `json:"model,omitempty"`
+	Usage     *Usage `json:"usage,omitempty"`
+	Stats     *Stats `json:"stats,omitempty"`
+	// When the message was sent or received; empty for older messages
+	Time *time.Time `json:"time,omitempty"`
+	// Interrupted marks an answer cut short by Ctrl-C or a dropped
+	// connection, kept as far as it got
+	Interrupted bool `json:"interrupted,omitempty"`
 }
 
-func saveHistory() {
-	mutex.Lock()
-	defer mutex.Unlock()
-
-	config := Config{
-		LastChatID: lastChatID,
-		History:    chatHistory,
-	}
-	data, err := json.MarshalIndent(config, "", "  ")
-	if err != nil {
-		fmt.Println("Error marshaling history:", err)
-		return
-	}
-
-	err = os.WriteFile(historyFile, data, 0600)
-	if err != nil {
-		fmt.Println("Error writing history file:", err)
-	}
+// Timing of the request that produced an assistant message
+type Stats struct {
+	FirstTokenMs    int64   `json:"first_token_ms"`
+	LatencyMs       int64   `json:"latency_ms"`
+	TokensPerSecond float64 `json:"tokens_per_second,omitempty"`
+	// Masked API key that served the request, when several are configured
+	Key string `json:"key,omitempty"`
 }
 
-type Message struct {
+// The part of a Message sent to the API
+type apiMessage struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// Prefix asks DeepSeek to continue this last assistant message
+	Prefix bool `json:"prefix,omitempty"`
 }
 
 type RequestBody struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
-	Stream   bool      `json:"stream"`
+	Model         string         `json:"model"`
+	Messages      []apiMessage   `json:"messages"`
+	Stream        bool           `json:"stream"`
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+	Temperature   *float64       `json:"temperature,omitempty"`
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type ResponseBody struct {
@@ -272,46 +526,302 @@ type ResponseBody struct {
 type StreamResponse struct {
 	Choices []struct {
 		Delta struct {
-			Content string `json:"content"`
+			Content          string            `json:"content"`
+			ReasoningContent string            `json:"reasoning_content"`
+			ToolCalls        []json.RawMessage `json:"tool_calls"`
 		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
+	Model string `json:"model"`
+	Usage *Usage `json:"usage"`
+}
+
+// The body of a completion requested without streaming
+type CompletionResponse struct {
+	Choices []struct {
+		Message struct {
+			Content          string `json:"content"`
+			ReasoningContent string `json:"reasoning_content"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Model string `json:"model"`
+	Usage *Usage `json:"usage"`
+}
+
+type Usage struct {
+	PromptTokens          int `json:"prompt_tokens"`
+	CompletionTokens      int `json:"completion_tokens"`
+	TotalTokens           int `json:"total_tokens"`
+	PromptCacheHitTokens  int `json:"prompt_cache_hit_tokens,omitempty"`
+	PromptCacheMissTokens int `json:"prompt_cache_miss_tokens,omitempty"`
+}
+
+// Shell command printing the API key, from api_key_cmd in the config file
+var apiKeyCmd string
+
+// The output of api_key_cmd per provider: it runs once per invocation
+type cmdKey struct {
+	key string
+	err error
+}
+
+var (
+	cmdKeysMu sync.Mutex
+	cmdKeys   = map[string]cmdKey{}
+)
+
+// Read the API key of the current provider
+func loadAPIKey() (string, error) {
+	return providerAPIKey(currentProvider)
 }
 
-// Generate a unique chat-id
-func generateChatID() string {
-	b := make([]byte, 8)
-	_, err := rand.Read(b)
+// Read the API key of p from the environment or api_keys, the output of
+// api_key_cmd, or else the system keychain
+func providerAPIKey(p provider) (string, error) {
+	// The cassette answers without one
+	if replayPath != "" {
+		return "replay", nil
+	}
+	if keys := providerKeys(p); len(keys) > 0 {
+		return pickAPIKey(keys), nil
+	}
+	if p.keyCmd != "" {
+		cmdKeysMu.Lock()
+		defer cmdKeysMu.Unlock()
+		result, ok := cmdKeys[p.name]
+		if !ok {
+			cmd := shellCommand(p.keyCmd)
+			cmd.Stdin = os.Stdin
+			cmd.Stderr = os.Stderr
+			out, err := cmd.Output()
+			// Secret managers print the secret first, metadata may follow
+			line, _, _ := strings.Cut(strings.TrimLeft(string(out), "\r\n"), "\n")
+			result.key = strings.TrimSpace(line)
+			switch {
+			case err != nil:
+				result.err = fmt.Errorf("running api_key_cmd: %w", err)
+			case result.key == "":
+				result.err = withExitCode(errors.New("api_key_cmd printed no key"), EXIT_NO_KEY)
+			}
+			cmdKeys[p.name] = result
+		}
+		return result.key, result.err
+	}
+	// A local Ollama has no keys
+	if p.api == API_OLLAMA {
+		return "", nil
+	}
+	apiKey, err := keychainGet(keychainAccount(p))
 	if err != nil {
-		panic(err)
+		if *debug && !errors.Is(err, errKeyNotStored) {
+			log.Printf("Reading the keychain: %v\n", err)
+		}
+		login := "deepseek auth login"
+		if p.name != DEFAULT_PROVIDER {
+			login = "deepseek -provider " + p.name + " auth login"
+		}
+		return "", withExitCode(fmt.Errorf("%s environment variable is not set and no key is stored, run `%s`", p.keyEnv, login), EXIT_NO_KEY)
 	}
-	return hex.EncodeToString(b)
+	return apiKey, nil
 }
 
 // Show help message
 func showHelp() {
-	fmt.Println("deepseek cli")
-	fmt.Println("\nUsage:")
-	fmt.Println("  deepseek [flags] <prompt>")
-	fmt.Println("\nFlags:")
+	w := flag.CommandLine.Output()
+	fmt.Fprintln(w, "deepseek cli")
+	fmt.Fprintln(w, "\nUsage:")
+	fmt.Fprintln(w, "  deepseek [flags] <prompt>")
+	fmt.Fprintln(w, "  deepseek ask [-bg] [flags] <prompt>")
+	fmt.Fprintln(w, "  deepseek [flags] <command> [args]")
+	fmt.Fprintln(w, "\nCommands:")
+	printCommands(w)
+	fmt.Fprintln(w, "\nFlags:")
 	flag.PrintDefaults()
 }
 
 // Main function
 func main() {
+	runMain()
+	finishJob()
+	os.Exit(exitStatus)
+}
+
+func runMain() {
 
 	// Define flags
 	chatID := flag.String("chat", "", "Conversation ID (optional, generates one if not provided)")
+	appendOutput := flag.Bool("append", false, "Append to the -o file instead of overwriting it")
 	checkModels := flag.Bool("models", false, "List available Deepseek models")
 	checkStatus = flag.Bool("status", false, "Check DeepSeek service status")
-	debug := flag.Bool("debug", false, "Enable debug logging")
+	copyAnswer := flag.Bool("copy", false, "Copy the answer to the clipboard")
+	copyCode := flag.Bool("copy-code", false, "Copy the first code block of the answer to the clipboard")
+	debug = flag.Bool("debug", false, "Enable debug logging")
+	flag.StringVar(&recordPath, "record", "", "Save the API interactions to this cassette file, for -replay")
+	flag.StringVar(&replayPath, "replay", "", "Answer API requests from this cassette file, without network or API key")
+	flag.StringVar(&themeName, "theme", "", "Color theme: dark, light or solarized, refined by the [theme] table of the config file (default dark)")
+	flag.StringVar(&debugDumpPath, "debug-dump", "", "Append every API request and response, headers and bodies, to this file with the API keys redacted")
+	extractCode := &optionalString{bare: "."}
+	flag.Var(extractCode, "extract-code", "Write fenced code blocks of the answer to files (optionally -extract-code=dir)")
+	format := flag.String("format", "", "Go template for the result, e.g. '{{.Content}}' (fields: Content, Reasoning, Prompt, Model, ChatID, FinishReason, Usage, Duration, FirstToken)")
+	ttl := flag.String("ttl", "", "Remove the chat automatically after this long (e.g. 12h, 7d, 1mo)")
+	incognito := flag.Bool("incognito", false, "Send only the system message and the prompt, and save nothing to history")
+	flag.BoolVar(incognito, "i", false, "Shorthand for -incognito")
+	flag.StringVar(&historyFileFlag, "history-file", "", "History index file, with the chats stored next to it (default: $XDG_DATA_HOME/deepseek/index.json, or DEEPSEEK_HISTORY_FILE)")
 	listChatsFlag := flag.Bool("ls", false, "List all chats and their last message")
+	listAll := flag.Bool("all", false, "With -ls, also list archived chats")
+	listColumns := flag.String("columns", "", "With -ls, comma-separated columns to show (marker, id, name, age, created, updated, title, tags, last, messages, model, tokens)")
+	listSort := flag.String("sort", "", "With -ls, order by age, created, updated, messages, tokens, name or title")
+	listReverse := flag.Bool("reverse", false, "With -ls, reverse the order")
+	listSince := flag.String("since", "", "With -ls, only chats used since a duration ago (7d) or a date (2024-05-01)")
+	listGrep := flag.String("grep", "", "With -ls, only chats whose title, name, tags or messages contain this text")
+	listLimit := flag.Int("limit", 0, "With -ls, list at most this many chats")
+	listOffset := flag.Int("offset", 0, "With -ls, skip this many chats first")
+	watchList := flag.Bool("watch", false, "With -ls, redraw the listing every few seconds, highlighting chats with new messages")
+	watchInterval := flag.Duration("interval", WATCH_INTERVAL, "With -ls -watch, time between refreshes")
+	noTrunc := flag.Bool("no-trunc", false, "With -ls, do not truncate values to the column width")
+	tagFilter := flag.String("tag", "", "With -ls or -rm, only consider chats with this tag")
+	temperature := flag.Float64("temperature", -1, "Sampling temperature, 0 to 2 (default: the model's)")
 	memoryLimit := flag.Int("memory", 10, "Number of messages to include in the memory (default: 10)")
-	model := flag.String("model", "deepseek-chat", "Model to use (default: deepseek-chat)")
+	model = flag.String("model", "deepseek-chat", "Model to use (default: deepseek-chat)")
+	providerName := flag.String("provider", DEFAULT_PROVIDER, "Service to use: deepseek, openai, groq, together, openrouter, ollama or one of the config file (see: deepseek providers)")
+	flag.StringVar(&caCertFile, "cacert", "", "PEM file of certificate authorities to trust besides the system's")
+	flag.StringVar(&certFile, "cert", "", "PEM client certificate for mutual TLS, with -key")
+	flag.StringVar(&keyFile, "key", "", "PEM private key of -cert")
+	flag.StringVar(&proxyURL, "proxy", "", "Proxy of API requests, e.g. http://proxy:3128 or socks5://localhost:1080 (hosts of NO_PROXY bypass it)")
+	flag.DurationVar(&requestTimeout, "timeout", requestTimeout, "Longest a request may take, 0 for no limit (e.g. for long deepseek-reasoner runs)")
+	flag.DurationVar(&connectTimeout, "connect-timeout", connectTimeout, "Longest connecting and waiting for the first response may take, 0 for no limit")
+	flag.DurationVar(&stallTimeout, "stall-timeout", stallTimeout, "Longest a streaming answer may go without data before it is given up, 0 for no limit")
+	flag.IntVar(&requestsPerMinute, "rpm", 0, "Requests per minute not to exceed across invocations, waiting as needed (0: no limit)")
+	flag.IntVar(&tokensPerMinute, "tpm", 0, "Tokens per minute not to exceed across invocations, waiting as needed (0: no limit)")
+	flag.Float64Var(&warnBelow, "warn-below", 0, "Warn before prompts when the DeepSeek balance of a currency is below this amount (0: never)")
+	flag.Float64Var(&monthlyBudget, "budget", 0, "Estimated USD a month not to exceed, refusing requests once spent (0: no limit)")
+	flag.BoolVar(&forceBudget, "force", false, "Send even when the -budget of the month is spent")
+	flag.BoolVar(&queueOffline, "queue", false, "Queue prompts that fail for lack of network, for `deepseek flush` to send later")
+	flag.IntVar(&maxRetries, "retries", maxRetries, "Times to retry a request after a rate limit, a server error or a failed connection")
+	flag.Var(&extraHeaders, "header", "HTTP header 'Name: value' to send with every request (repeatable)")
+	flag.StringVar(&fallbackModels, "fallback", "", "Comma-separated models to try in order when a request fails, as model or provider:model")
+	flag.StringVar(&apiBaseURL, "base-url", DEFAULT_BASE_URL, "Base URL of an API compatible with DeepSeek's, e.g. a self-hosted gateway")
 	newChat := flag.Bool("new", false, "Create a new conversation")
-	removeChat := flag.String("rm", "", "Remove chats older than the specified duration (e.g., 10d) or by ID")
+	background := flag.Bool("bg", false, "Answer the prompt in the background as a job, printing its id (see: deepseek jobs)")
+	runCode := flag.Bool("run", false, "Offer to run the first code block of the answer (asks for confirmation)")
+	removeChat := flag.String("rm", "", "Remove chats older than the specified duration (e.g., 10d, 2w, 3mo), by ID or name, or by a glob or /regexp/ over names and titles; more can follow as arguments")
+	dryRun := flag.Bool("dry-run", false, "With -rm, only list the chats that would be removed")
+	noStream = flag.Bool("no-stream", false, "Wait for the whole answer instead of streaming it")
+	notifyDone := flag.Bool("notify", false, "Show a desktop notification when the answer is complete")
+	flag.StringVar(&webhookURL, "webhook", "", "URL to POST a summary of every answer to: its chat, prompt, start and cost")
+	flag.StringVar(&webhookFormat, "webhook-format", "", "Payload of -webhook: generic JSON or slack (default: slack for hooks.slack.com URLs)")
+	flag.IntVar(&webhookChars, "webhook-chars", webhookChars, "Characters of the answer sent to -webhook")
+	noWrap := flag.Bool("no-wrap", false, "Do not soft-wrap answers at the terminal width")
+	noPager := flag.Bool("no-pager", false, "Do not page answers or -ls tables longer than the terminal")
+	outputMode := flag.String("output", "text", "Output format of the answer: text, jsonl or raw; of -ls: json, csv or yaml")
+	outputFile := flag.String("o", "", "Write the answer to a file; with -ls, the format of the listing (json, csv or yaml)")
+	pipeCmd := flag.String("pipe", "", "Pass the answer through a shell command (e.g. \"glow -\")")
+	flag.BoolVar(&quiet, "q", false, "Quiet mode: only print the answer, errors go to stderr")
+	roleName := flag.String("role", "", "Persona to use as the system prompt (see: deepseek role)")
+	showStats := flag.Bool("stats", false, "Print latency and tokens/second to stderr after the answer")
+	snippetNames := flag.String("snippet", "", "Comma-separated snippets to prepend to the prompt")
+	tee := flag.Bool("tee", false, "With -o, also stream the answer to the terminal")
 	verbose := flag.Bool("verbose", false, "Enable verbose logging")
+	assumeYes = flag.Bool("yes", false, "Skip confirmation prompts")
 	help := flag.Bool("help", false, "Enable verbose logging")
+	flag.VisitAll(func(f *flag.Flag) {
+		flagDefaults[f.Name] = f.DefValue
+	})
+	configError = applyConfig(flag.CommandLine)
+	if configError == nil {
+		configError = applyEnv(flag.CommandLine)
+	}
 	flag.Parse()
+	invocationFlags = os.Args[1 : len(os.Args)-flag.NArg()]
+	// ask takes the flags of the prompt after it too
+	asking := flag.Arg(0) == "ask"
+	if asking {
+		args := flag.Args()[1:]
+		flag.CommandLine.Parse(args)
+		invocationFlags = append(invocationFlags[:len(invocationFlags):len(invocationFlags)], args[:len(args)-flag.NArg()]...)
+	}
+	// doctor reports it along with other problems
+	if configError != nil && flag.Arg(0) != "doctor" {
+		errorf("Error: %v\n", configError)
+		setExitStatus(EXIT_USAGE)
+		return
+	}
+	if err := selectProvider(*providerName); err != nil {
+		fail(err)
+		return
+	}
+	if err := checkBaseURL(); err != nil {
+		fail(err)
+		return
+	}
+	if err := loadTLS(); err != nil {
+		fail(err)
+		return
+	}
+	if err := checkRateLimit(); err != nil {
+		fail(err)
+		return
+	}
+	if err := checkProxy(); err != nil {
+		fail(err)
+		return
+	}
+	if err := checkHeaders(); err != nil {
+		fail(err)
+		return
+	}
+	if err := checkFallback(); err != nil {
+		fail(err)
+		return
+	}
+	if err := checkCassette(); err != nil {
+		fail(err)
+		return
+	}
+	if err := checkWebhook(); err != nil {
+		fail(err)
+		return
+	}
+	if err := loadTheme(); err != nil {
+		fail(err)
+		return
+	}
+
+	if _, ok := listFormats[*outputMode]; !(ok && *listChatsFlag) && *outputMode != "text" && *outputMode != "jsonl" && *outputMode != "raw" {
+		errorf("Error: unknown -output format %q\n", *outputMode)
+		setExitStatus(EXIT_USAGE)
+		return
+	}
+
+	// A running daemon answers plain prompts without the history loaded here
+	if _, ok := commands[flag.Arg(0)]; (!ok || asking) && flag.NArg() > 0 && *outputMode == "text" && os.Getenv(NO_HISTORY) != "1" {
+		req := promptRequest{Chat: *chatID, New: *newChat, Role: *roleName}
+		req.Content, req.Model, req.Memory = flag.Arg(0), *model, memoryLimit
+		if *temperature >= 0 {
+			req.Temperature = temperature
+		}
+		if askDaemon(req, !*noWrap) {
+			return
+		}
+	}
+
+	loadHistory()
+	pullRemote()
+	pruneExpired()
+	rotateHistory()
+	// Archived chats are never picked up as the last chat
+	if chatIndex[lastChatID].Archived {
+		lastChatID = ""
+	}
+	if *chatID != "" {
+		*chatID = resolveChatID(*chatID)
+		if err := validChatID(*chatID); err != nil {
+			errorf("Error: -chat: %v\n", err)
+			setExitStatus(EXIT_USAGE)
+			return
+		}
+	}
 
 	// Check if the -status flag was passed
 	if *checkStatus {
@@ -327,62 +837,169 @@ func main() {
 
 	// Check if the -rm flag was passed
 	if *removeChat != "" {
-		removeChats(*removeChat)
-		saveHistory()
+		// Further criteria may follow, mixed with flags such as -dry-run
+		rest, err := parseFlags(flag.CommandLine, flag.Args())
+		if err != nil {
+			fail(err)
+			return
+		}
+		criteria := append(strings.Split(*removeChat, ","), rest...)
+		if err := removeChats(criteria, *tagFilter, *dryRun); err != nil {
+			fail(err)
+		}
 		return
 	}
 
 	// Check if the -ls flag was passed
 	if *listChatsFlag {
-		listChats()
+		opts := listOptions{tag: *tagFilter, all: *listAll, format: *outputMode, sort: *listSort, reverse: *listReverse, grep: *listGrep}
+		opts.offset, opts.limit, opts.page = max(*listOffset, 0), *listLimit, !*noPager
+		opts.noTrunc = *noTrunc
+		if *watchList {
+			opts.watch = max(*watchInterval, 100*time.Millisecond)
+		}
+		if *listColumns != "" {
+			opts.columns = strings.Split(*listColumns, ",")
+		}
+		if *listSince != "" {
+			since, err := parseTimeFilter(*listSince)
+			if err != nil {
+				fail(err)
+				return
+			}
+			opts.since = since
+		}
+		// -model always has a value; it only filters when given
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "model" {
+				opts.model = *model
+			}
+		})
+		// -o names the format of the listing rather than a file
+		if _, ok := listFormats[*outputFile]; ok {
+			opts.format = *outputFile
+		}
+		if err := listChats(opts); err != nil {
+			fail(err)
+		}
+		return
+	}
+
+	// Check if a subcommand was passed
+	if cmd, ok := commands[flag.Arg(0)]; ok && !asking {
+		if err := cmd.run(flag.Args()[1:]); err != nil {
+			fail(err)
+		}
 		return
 	}
 
 	// Read API token from environment variable
-	apiKey := os.Getenv(API_KEY)
-	if apiKey == "" {
-		fmt.Printf("Error: %s environment variable is not set.\n", API_KEY)
+	apiKey, err := loadAPIKey()
+	if err != nil {
+		fail(err)
 		return
 	}
+	checkBalance(apiKey)
+
+	if os.Getenv(NO_HISTORY) == "1" {
+		*incognito = true
+	}
+	var expiry time.Time
+	if *ttl != "" {
+		d, err := parseDuration(*ttl)
+		if err != nil {
+			errorf("Error: invalid -ttl: %v\n", err)
+			setExitStatus(EXIT_USAGE)
+			return
+		}
+		expiry = time.Now().Add(d)
+	}
+	if *incognito && *chatID != "" {
+		errorf("Error: -chat can't be used in incognito mode\n")
+		setExitStatus(EXIT_USAGE)
+		return
+	}
+
+	// A job answers in the chat picked when it was started
+	if job, err := beginJob(); err != nil {
+		fail(err)
+		return
+	} else if job != nil && job.ChatID != "" {
+		*chatID, *newChat = job.ChatID, false
+	}
 
 	// Handle chat ID selection
-	if *newChat || (*chatID == "" && lastChatID == "") {
+	if *incognito {
+		infof("Incognito: this prompt won't be saved.\n")
+	} else if *newChat || (*chatID == "" && lastChatID == "") {
 		*chatID = generateChatID()
 		if *verbose {
-			fmt.Println("New chat-id generated:", *chatID)
+			infof("New chat-id generated: %s\n", *chatID)
 		}
 	} else if *chatID == "" {
 		*chatID = lastChatID
 		if *verbose {
-			fmt.Println("Using last chat-id:", *chatID)
+			infof("Using last chat-id: %s\n", *chatID)
 		}
 	}
-	lastChatID = *chatID
+	if !*incognito {
+		lastChatID = *chatID
+	}
 
 	// Get user prompt
 	if *help || (len(flag.Args()) == 0) {
 		showHelp()
+		if !*help {
+			setExitStatus(EXIT_USAGE)
+		}
 		return
 	}
 
 	prompt := flag.Args()[0]
-	loadHistory()
+	if *background && runningJob == nil {
+		if err := startJob(prompt, *chatID, *model); err != nil {
+			fail(err)
+		}
+		return
+	}
+	if *snippetNames != "" {
+		text, err := expandSnippets(strings.Split(*snippetNames, ","))
+		if err != nil {
+			fail(err)
+			return
+		}
+		prompt = text + "\n\n" + prompt
+	}
 
 	// Get chat history for this chat-id
-	mutex.Lock()
-	chat, exists := chatHistory[*chatID]
-	if !exists {
-		sys_content := os.Getenv(ROLE)
-		if sys_content == "" {
-			sys_content = "You are a helpful assistant. Be concise."
+	var chat Chat
+	exists := false
+	if !*incognito {
+		chat, exists, err = loadChat(*chatID)
+		if err != nil {
+			fail(err)
+			return
+		}
+	}
+	if !exists || *roleName != "" {
+		name, sys_content, err := resolveRole(*roleName)
+		if err != nil {
+			fail(err)
+			return
 		}
 
-		chat = Chat{
-			CreatedAt: time.Now(),
-			Messages: []Message{
-				{Role: "system", Content: sys_content},
-			},
+		if !exists {
+			chat = Chat{
+				CreatedAt: time.Now(),
+				Messages: []Message{
+					{Role: "system", Content: sys_content},
+				},
+			}
+		} else if chat.Role != name {
+			// Switch the persona of an existing chat
+			setSystemMessage(&chat, sys_content)
 		}
+		chat.Role = name
 	}
 	// Ensure the last system role message is included
 	var systemMessage Message
@@ -394,164 +1011,319 @@ func main() {
 	}
 
 	// Limit the memory to the last N messages plus the system message
-	if len(chat.Messages) > *memoryLimit+1 {
-		chat.Messages = chat.Messages[len(chat.Messages)-*memoryLimit:]
-		chat.Messages = append([]Message{systemMessage}, chat.Messages...)
-	}
+	context := memoryContext(chat, *memoryLimit)
 	// add the current user message which means memory + 2
-	chat.Messages = append(chat.Messages, Message{Role: "user", Content: prompt})
-	chatHistory[*chatID] = chat
-	mutex.Unlock()
-
-	// Build request body
-	requestBody := RequestBody{
-		Model:    *model,
-		Messages: chat.Messages,
-		Stream:   true,
-	}
+	userMessage := Message{Role: "user", Content: prompt, Time: now()}
+	context = append(context, userMessage)
 
-	// Convert body to JSON
-	jsonData, err := json.Marshal(requestBody)
+	out, closeOutput, err := openOutput(*outputFile, *tee, *appendOutput)
 	if err != nil {
-		fmt.Println("Error marshaling request body:", err)
+		fail(err)
 		return
 	}
-
-	if *debug {
-		log.Printf("Request body: %s\n", string(jsonData))
+	var tmpl *template.Template
+	if *format != "" {
+		tmpl, err = parseFormat(*format)
+		if err != nil {
+			fail(err)
+			return
+		}
 	}
 
-	// Create HTTP request
-	req, err := http.NewRequest("POST", CHAT_URL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		fmt.Println("Error creating request:", err)
-		return
+	// Feed the answer through the -pipe command
+	waitPipe := func() error { return nil }
+	if *pipeCmd != "" {
+		out, waitPipe, err = startPipe(*pipeCmd, out)
+		if err != nil {
+			fail(err)
+			return
+		}
 	}
 
-	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-
-	// Send request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Println("Error making request:", err)
-		return
+	// Soft-wrap prose when streaming straight to a terminal
+	var wrapper *wrapWriter
+	if *outputMode == "text" && *format == "" && out == os.Stdout && !*noWrap && isTerminal(os.Stdout) {
+		width, _, _ := terminalSize(os.Stdout)
+		wrapper = newWrapWriter(os.Stdout, width)
+		stopResize := watchResize(os.Stdout, wrapper.setWidth)
+		defer stopResize()
+		out = wrapper
 	}
-	defer resp.Body.Close()
 
-	if *debug {
-		log.Printf("=== Response status: %s\n", resp.Status)
-		log.Println("=== Response headers:")
-		for key, values := range resp.Header {
-			log.Printf("  %s: %v\n", key, values)
+	request := chatRequest{
+		apiKey:   apiKey,
+		model:    *model,
+		messages: context,
+		out:      out,
+		debug:    *debug,
+	}
+	if *temperature >= 0 {
+		request.temperature = temperature
+	}
+	var events *json.Encoder
+	if *outputMode == "jsonl" {
+		events = json.NewEncoder(out)
+		request.out = nil
+		request.onEvent = func(event streamEvent) { events.Encode(event) }
+	} else if tmpl != nil {
+		request.out = nil
+	} else if *outputMode == "raw" {
+		request.out = nil
+		request.onRaw = func(line string) { fmt.Fprintln(out, line) }
+	}
+	// Ctrl-C stops the answer, keeping what arrived so far
+	ctx, stopInterrupt := signal.NotifyContext(request.context(), os.Interrupt)
+	request.ctx = ctx
+	response, err := chatWithFallback(request)
+	// Stopping cancels ctx too
+	canceled := ctx.Err() != nil
+	stopInterrupt()
+	// A cut-short answer is kept like a whole one
+	streamErr := err
+	if response.interrupted && (response.content != "" || response.reasoning != "") {
+		err = nil
+	}
+	answeredBy := response.message(*model).Model
+	if events != nil {
+		done := streamEvent{Type: "done", ChatID: *chatID, Model: answeredBy, Finish: response.finishReason}
+		if err != nil {
+			done = streamEvent{Type: "error", ChatID: *chatID, Model: answeredBy, Error: err.Error(), Code: exitCode(err)}
+		}
+		events.Encode(done)
+	} else if tmpl != nil {
+		if err == nil {
+			usage := Usage{}
+			if response.usage != nil {
+				usage = *response.usage
+			}
+			err = renderFormat(out, tmpl, templateResult{
+				Content:      response.content,
+				Reasoning:    response.reasoning,
+				Prompt:       prompt,
+				Model:        answeredBy,
+				ChatID:       *chatID,
+				FinishReason: response.finishReason,
+				Usage:        usage,
+				Duration:     response.latency,
+				FirstToken:   response.firstToken,
+			})
 		}
+	} else if *outputMode == "text" {
+		if wrapper != nil {
+			wrapper.Flush()
+		}
+		fmt.Fprintln(out)
 	}
-
-	// Check if the response status is not 200
-	if resp.StatusCode != http.StatusOK {
-		// Read and log the error response
-		body, err := io.ReadAll(resp.Body)
+	if perr := waitPipe(); perr != nil && err == nil {
+		err = perr
+	}
+	if cerr := closeOutput(); cerr != nil && err == nil {
+		err = cerr
+	}
+	// Incognito prompts and answers stay on this machine
+	if !*incognito {
+		summary := webhookSummary{ChatID: *chatID, Prompt: prompt, Answer: response.content, Model: answeredBy, Usage: response.usage}
 		if err != nil {
-			log.Printf("Error reading error response: %v\n", err)
-			return
+			summary.Error = err.Error()
 		}
-		log.Printf("API Error Response: %s\n", string(body))
-		return
+		postWebhook(summary)
 	}
-
-	// Process streaming response
-	scanner := bufio.NewScanner(resp.Body)
-	var fullResponse strings.Builder
-
-	if *debug {
-		log.Println("=== Starting to process stream response...")
+	if *notifyDone {
+		title, body := "deepseek: answer ready", summarize(response.content, 120)
+		if err != nil {
+			title, body = "deepseek: request failed", err.Error()
+		}
+		if nerr := notify(title, body); nerr != nil {
+			errorf("Error sending notification: %v\n", nerr)
+		}
 	}
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		if *debug {
-			log.Printf("== Raw line received: %s\n", line)
+	if err != nil {
+		if canceled {
+			err = errInterrupted
 		}
-
-		if line == "" {
-			if *debug {
-				log.Println("Empty line, skipping")
+		errorf("\nError: %v\n", err)
+		setExitStatus(exitCode(err))
+		// Keep the prompt for when the network is back
+		if queueOffline && !*incognito && exitCode(err) == EXIT_NETWORK && response.content == "" {
+			qerr := queuePrompt(queuedPrompt{
+				ChatID:      *chatID,
+				Prompt:      prompt,
+				Provider:    currentProvider.name,
+				BaseURL:     apiBaseURL,
+				Model:       *model,
+				Temperature: request.temperature,
+				Memory:      *memoryLimit,
+				Role:        chat.Role,
+				System:      systemMessage.Content,
+			})
+			if qerr != nil {
+				errorf("Error queuing the prompt: %v\n", qerr)
+			} else {
+				infof("The prompt is queued, `deepseek flush` sends it once online\n")
 			}
-			continue
 		}
+		return
+	}
+	if response.interrupted {
+		hint := ""
+		if !*incognito {
+			hint = ", `deepseek resume` continues it"
+		}
+		if canceled {
+			infof("Interrupted, the partial answer is kept%s\n", hint)
+			setExitStatus(EXIT_INTERRUPTED)
+		} else {
+			errorf("\nError: %v\nThe partial answer is kept%s\n", streamErr, hint)
+			setExitStatus(exitCode(streamErr))
+		}
+	}
+	if response.finishReason == "content_filter" {
+		errorf("The answer was cut short by the content filter\n")
+		setExitStatus(EXIT_CONTENT_FILTER)
+	}
+	assistantMessage := response.content
+
+	if *showStats {
+		printStats(response)
+	}
 
-		if !strings.HasPrefix(line, "data: ") {
-			if *debug {
-				log.Printf("Line doesn't start with 'data: ', skipping: %s\n", line)
+	// Page long answers once streaming is done
+	if *outputMode == "text" && *format == "" && *outputFile == "" && *pipeCmd == "" && !*noPager && !response.interrupted && isTerminal(os.Stdout) {
+		width, height, _ := terminalSize(os.Stdout)
+		if displayRows(assistantMessage, width) > height {
+			if err := page(assistantMessage); err != nil {
+				errorf("Error running pager: %v\n", err)
 			}
-			continue
 		}
+	}
 
-		line = strings.TrimPrefix(line, "data: ")
-		if line == "[DONE]" {
-			if *debug {
-				log.Println("Received [DONE] message, ending stream")
+	// Update message history, appending to the latest stored version of the
+	// chat in case another invocation wrote to it meanwhile
+	if !*incognito {
+		turn := []Message{userMessage, response.message(*model)}
+		err = updateChat(*chatID, func(stored *Chat, exists bool) {
+			if !exists {
+				stored.CreatedAt = chat.CreatedAt
 			}
-			break
+			if !exists || stored.Role != chat.Role {
+				setSystemMessage(stored, systemMessage.Content)
+			}
+			stored.Role = chat.Role
+			if !expiry.IsZero() {
+				stored.ExpiresAt = &expiry
+			}
+			stored.Messages = append(stored.Messages, turn...)
+			lastChatID = *chatID
+		})
+		if err != nil {
+			errorf("Error saving chat: %v\n", err)
+		} else if !exists {
+			titleInBackground(*chatID)
 		}
+	}
 
-		var streamResp StreamResponse
-		if err := json.Unmarshal([]byte(line), &streamResp); err != nil {
-			if *debug {
-				log.Printf("Error unmarshaling JSON: %v\nProblematic line: %s\n", err, line)
+	if *copyAnswer || *copyCode {
+		text := assistantMessage
+		if *copyCode {
+			if blocks := parseCodeBlocks(assistantMessage); len(blocks) > 0 {
+				text = blocks[0].content
+			} else {
+				infof("No code block found, copying the full answer.\n")
 			}
-			continue
 		}
+		if err := copyToClipboard(text); err != nil {
+			errorf("Error copying to clipboard: %v\n", err)
+		}
+	}
 
-		if len(streamResp.Choices) > 0 {
-			content := streamResp.Choices[0].Delta.Content
-			if *debug {
-				log.Printf("Received content chunk: %s\n", content)
+	if *runCode {
+		blocks := parseCodeBlocks(assistantMessage)
+		if len(blocks) == 0 {
+			infof("No code block found to run.\n")
+		} else if *assumeYes || confirm(fmt.Sprintf("Run the %s code block above?", blocks[0].lang)) {
+			output, err := runCodeBlock(blocks[0])
+			if err != nil {
+				errorf("Error running code: %v\n", err)
+				output += "\n" + err.Error()
+			}
+			// Append the captured output so the model sees it on the next turn
+			if !*incognito {
+				err = updateChat(*chatID, func(stored *Chat, _ bool) {
+					stored.Messages = append(stored.Messages, Message{
+						Role:    "user",
+						Content: "Output of running the code:\n```\n" + output + "\n```",
+						Time:    now(),
+					})
+				})
+				if err != nil {
+					errorf("Error saving chat: %v\n", err)
+				}
 			}
-			fmt.Print(content)
-			fullResponse.WriteString(content)
-		} else if *debug {
-			log.Println("No choices in response")
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		fmt.Println("\nError reading stream:", err)
-		return
+	if extractCode.set {
+		paths, err := extractCodeBlocks(assistantMessage, prompt, extractCode.value)
+		for _, path := range paths {
+			infof("Created %s\n", path)
+		}
+		if err != nil {
+			errorf("Error extracting code blocks: %v\n", err)
+		}
 	}
-	fmt.Println()
+}
 
-	// Update message history
-	assistantMessage := fullResponse.String()
-	mutex.Lock()
-	chat.Messages = append(chat.Messages, Message{Role: "assistant", Content: assistantMessage})
-	chatHistory[*chatID] = chat
-	mutex.Unlock()
-	saveHistory()
+// The context length and the price per million prompt and completion
+// tokens of a model of a /models catalog, when it lists them
+func modelDetails(model map[string]interface{}) string {
+	var details []string
+	if length, ok := model["context_length"].(float64); ok && length > 0 {
+		details = append(details, fmt.Sprintf("%6dk ctx", int(length)/1000))
+	}
+	if pricing, ok := model["pricing"].(map[string]interface{}); ok {
+		prompt, err1 := strconv.ParseFloat(fmt.Sprint(pricing["prompt"]), 64)
+		completion, err2 := strconv.ParseFloat(fmt.Sprint(pricing["completion"]), 64)
+		// Routers such as openrouter/auto price by the model they pick: -1
+		if err1 == nil && err2 == nil && prompt >= 0 && completion >= 0 {
+			details = append(details, fmt.Sprintf("$%.2f/$%.2f per M tokens", prompt*1e6, completion*1e6))
+		}
+	}
+	return strings.Join(details, "  ")
 }
 
 func listDeepseekModels() {
-	// Read API token from environment variable
-	apiKey := os.Getenv("DEEPSEEK_API_KEY")
-	if apiKey == "" {
-		fmt.Println("Error: DEEPSEEK_API_KEY environment variable is not set.")
+	if currentProvider.api == API_OLLAMA {
+		models, err := ollamaModels()
+		if err != nil {
+			fail(err)
+			return
+		}
+		infof("Available model IDs:\n")
+		for _, name := range models {
+			fmt.Println(name)
+		}
+		cacheModels(models)
+		return
+	}
+	apiKey, err := loadAPIKey()
+	if err != nil {
+		fail(err)
 		return
 	}
 
 	// Create a simple request to check models endpoint
-	req, err := http.NewRequest("GET", MODELS_URL, nil)
+	req, err := http.NewRequest("GET", apiURL("models"), nil)
 	if err != nil {
 		return
 	}
 
 	req.Header.Set("Authorization", "Bearer "+apiKey)
+	prepareRequest(req)
 
 	// Send request
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := sendRequest(req, API_TIMEOUT, 0)
 	if err != nil {
+		fail(err)
 		return
 	}
 	defer resp.Body.Close()
@@ -567,57 +1339,38 @@ func listDeepseekModels() {
 		var prettyJSON bytes.Buffer
 		err = json.Indent(&prettyJSON, body, "", "  ")
 		if err != nil {
-			fmt.Printf("Error formatting JSON: %v\n", err)
+			errorf("Error formatting JSON: %v\n", err)
 			return
 		}
-		fmt.Println("Available model IDs:")
+		infof("Available model IDs:\n")
 		var responseData map[string]interface{}
 		if err := json.Unmarshal(body, &responseData); err != nil {
-			fmt.Printf("Error parsing JSON: %v\n", err)
+			errorf("Error parsing JSON: %v\n", err)
 			return
 		}
 		if data, ok := responseData["data"].([]interface{}); ok {
+			var ids []string
+			width := 0
 			for _, item := range data {
 				if model, ok := item.(map[string]interface{}); ok {
-					fmt.Println(model["id"])
+					width = max(width, len(fmt.Sprint(model["id"])))
 				}
 			}
-		}
-	} else {
-		fmt.Printf("Response: %s\n", string(body))
-	}
-}
-
-func removeChats(criteria string) {
-	mutex.Lock()
-	defer mutex.Unlock()
-
-	// Try to parse as duration
-	duration, err := time.ParseDuration(criteria)
-	if err == nil {
-		cutoff := time.Now().Add(-duration)
-		fmt.Printf("Removing chats older than: %s\n", cutoff)
-
-		// Remove chats older than the cutoff
-		removed := false
-		for chatID, chat := range chatHistory {
-			if chat.CreatedAt.Before(cutoff) {
-				delete(chatHistory, chatID)
-				fmt.Printf("Chat ID: %s removed due to age.\n", chatID)
-				removed = true
+			for _, item := range data {
+				if model, ok := item.(map[string]interface{}); ok {
+					ids = append(ids, fmt.Sprint(model["id"]))
+					// Catalogs such as OpenRouter's also give the context
+					// size and the price
+					if details := modelDetails(model); details != "" {
+						fmt.Printf("%-*s  %s\n", width, model["id"], details)
+					} else {
+						fmt.Println(model["id"])
+					}
+				}
 			}
+			cacheModels(ids)
 		}
-		if !removed {
-			fmt.Println("No chats were removed. All chats are within the specified duration.")
-		}
-		return
-	}
-
-	// Try to remove by ID
-	if _, exists := chatHistory[criteria]; exists {
-		delete(chatHistory, criteria)
-		fmt.Printf("Chat ID: %s removed.\n", criteria)
 	} else {
-		fmt.Println("Invalid input: not a valid duration or chat ID.")
+		fail(&apiError{resp.StatusCode, resp.Status, string(body)})
 	}
 }
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	BRIDGE_QUESTION = "Summarize what we discussed so far before we continue."
+	BRIDGE_PROMPT   = "Summarize the conversation above in a few sentences for someone who will continue it: the topic, what was decided and any open questions. Reply with the summary only."
+)
+
+func init() {
+	registerCommand(command{
+		name:  "merge",
+		usage: "<id1> <id2>... [-no-summary]  join chats, oldest first, into a new chat",
+		run:   runMerge,
+	})
+}
+
+func runMerge(args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	noSummary := fs.Bool("no-summary", false, "Do not ask the model for a summary between the chats")
+	ids, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(ids) < 2 {
+		return errors.New("usage: deepseek merge <id1> <id2>... [-no-summary]")
+	}
+	chats := make([]namedChat, 0, len(ids))
+	for _, id := range ids {
+		id = resolveChatID(id)
+		chat, exists, err := loadChat(id)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("chat %s not found", id)
+		}
+		chats = append(chats, namedChat{id, chat})
+	}
+	sort.SliceStable(chats, func(i, j int) bool { return chats[i].chat.CreatedAt.Before(chats[j].chat.CreatedAt) })
+
+	apiKey := ""
+	if !*noSummary {
+		if apiKey, err = loadAPIKey(); err != nil {
+			return err
+		}
+	}
+
+	// Keep the persona of the oldest chat and drop the other system messages
+	merged := Chat{CreatedAt: time.Now(), Role: chats[0].chat.Role}
+	for i, c := range chats {
+		if i > 0 && !*noSummary {
+			infof("Summarizing chat %s...\n", chats[i-1].id)
+			bridge, err := bridgeSummary(apiKey, merged.Messages)
+			if err != nil {
+				return fmt.Errorf("summarizing: %w (use -no-summary to skip)", err)
+			}
+			merged.Messages = append(merged.Messages, Message{Role: "user", Content: BRIDGE_QUESTION, Time: now()}, bridge)
+		}
+		for _, msg := range c.chat.Messages {
+			if msg.Role == "system" && (i > 0 || len(merged.Messages) > 0) {
+				continue
+			}
+			merged.Messages = append(merged.Messages, msg)
+		}
+	}
+
+	mergedID := generateChatID()
+	err = withHistoryLock(func() error {
+		if err := writeChatFile(mergedID, merged); err != nil {
+			return err
+		}
+		chatIndex[mergedID] = metaFor(merged)
+		lastChatID = mergedID
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println(mergedID)
+	names := make([]string, len(chats))
+	for i, c := range chats {
+		names[i] = c.id
+	}
+	infof("Merged %s into %s; the original chats were kept.\n", strings.Join(names, ", "), mergedID)
+	return nil
+}
+
+// Ask the model to summarize the conversation so far, returning its answer
+func bridgeSummary(apiKey string, messages []Message) (Message, error) {
+	request := chatRequest{
+		apiKey:   apiKey,
+		model:    *model,
+		messages: append(append([]Message(nil), messages...), Message{Role: "user", Content: BRIDGE_PROMPT}),
+		debug:    *debug,
+	}
+	response, err := chatWithFallback(request)
+	if err != nil {
+		return Message{}, err
+	}
+	return response.message(*model), nil
+}
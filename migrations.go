@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Current version of the history layout. Bump it together with a new
+// entry in migrations whenever the stored format changes.
+const SCHEMA_VERSION = 2
+
+// A migration upgrades the history from version-1 to version
+type migration struct {
+	version     int
+	description string
+	run         func() error
+}
+
+var migrations = []migration{
+	{1, "split the single history file into one file per chat", migrateLegacyHistory},
+	{2, "record the model and token usage of each chat in the index", migrateIndexUsage},
+}
+
+// Upgrade the loaded history to SCHEMA_VERSION. The caller holds the
+// history lock.
+func migrateHistory() error {
+	if schemaVersion >= SCHEMA_VERSION {
+		return nil
+	}
+	for _, m := range migrations {
+		if m.version <= schemaVersion {
+			continue
+		}
+		if err := m.run(); err != nil {
+			return fmt.Errorf("migration to version %d (%s): %w", m.version, m.description, err)
+		}
+		schemaVersion = m.version
+		if err := writeIndex(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Split the legacy ~/DEEPSEEK_HISTORY file into one file per chat of the
+// default history; one set with -history-file starts empty
+func migrateLegacyHistory() error {
+	if path, err := dataPath(INDEX_FILE); err != nil || path != historyFile {
+		return nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	legacyFile := filepath.Join(homeDir, HISTORY)
+	data, err := os.ReadFile(legacyFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("parsing %s: %w", legacyFile, err)
+	}
+	for id, chat := range config.History {
+		if err := writeChatFile(id, chat); err != nil {
+			return err
+		}
+		meta := metaFor(chat)
+		meta.UpdatedAt = chat.CreatedAt
+		chatIndex[id] = meta
+	}
+	lastChatID = config.LastChatID
+	infof("Migrated %d chats from %s to %s\n", len(config.History), legacyFile, historyDir)
+	return os.Rename(legacyFile, legacyFile+".migrated")
+}
+
+// Describe every chat again so the index carries its model and tokens
+func migrateIndexUsage() error {
+	for id, old := range chatIndex {
+		chat, exists, err := loadChat(id)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		meta := metaFor(chat)
+		meta.UpdatedAt = old.UpdatedAt
+		chatIndex[id] = meta
+	}
+	return nil
+}
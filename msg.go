@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const MSG_USAGE = "usage: deepseek msg edit|rm <chat-id> <index> [-replay]"
+
+func init() {
+	registerCommand(command{
+		name:  "msg",
+		usage: "edit|rm <chat-id> <index> [-replay]  change a message, dropping the turns after it",
+		run:   runMsg,
+	})
+}
+
+func runMsg(args []string) error {
+	fs := flag.NewFlagSet("msg", flag.ContinueOnError)
+	replay := fs.Bool("replay", false, "Send the conversation again from the changed message")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 3 || args[0] != "edit" && args[0] != "rm" {
+		return errors.New(MSG_USAGE)
+	}
+	chatID, chat, err := chatFromArgs(args[1:2], MSG_USAGE)
+	if err != nil {
+		return err
+	}
+	index, err := strconv.Atoi(args[2])
+	if err != nil || index < 0 || index >= len(chat.Messages) {
+		return fmt.Errorf("chat %s has no message %s (see: deepseek show %s)", chatID, args[2], chatID)
+	}
+	original := chat.Messages[index]
+
+	var messages []Message
+	switch args[0] {
+	case "edit":
+		content, err := editText(original.Content, ".md")
+		if err != nil {
+			return err
+		}
+		content = strings.TrimRight(content, "\n")
+		if strings.TrimSpace(content) == "" {
+			return errors.New("message is empty, nothing changed")
+		}
+		edited := original
+		edited.Content = content
+		edited.Time = now()
+		messages = append(append(messages, chat.Messages[:index]...), edited)
+	case "rm":
+		if original.Role == "system" {
+			return errors.New("the system message can't be removed, change the persona with -role")
+		}
+		messages = append(messages, chat.Messages[:index]...)
+	}
+
+	if dropped := len(chat.Messages) - index - 1; dropped > 0 {
+		if !*assumeYes && !confirm(fmt.Sprintf("This drops the %d message(s) after message %d. Continue?", dropped, index)) {
+			return nil
+		}
+	}
+	err = updateChat(chatID, func(stored *Chat, _ bool) {
+		stored.Messages = messages
+	})
+	if err != nil {
+		return err
+	}
+	infof("Chat %s now has %d messages.\n", chatID, len(messages))
+
+	if !*replay {
+		return nil
+	}
+	if len(messages) == 0 || messages[len(messages)-1].Role != "user" {
+		return errors.New("nothing to replay: the conversation doesn't end with a user message")
+	}
+	request := chatRequest{model: *model, messages: messages, debug: *debug}
+	if i := lastAnswer(messages); i >= 0 && messages[i].Model != "" {
+		request.model = messages[i].Model
+	}
+	if request.apiKey, err = loadAPIKey(); err != nil {
+		return err
+	}
+	response, err := streamToStdout(request)
+	if err != nil {
+		return err
+	}
+	return updateChat(chatID, func(stored *Chat, _ bool) {
+		stored.Messages = append(stored.Messages, response.message(request.model))
+	})
+}
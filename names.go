@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// Words of generated chat ids, docker style ("brave-turing")
+var (
+	idAdjectives = []string{
+		"agile", "amber", "ancient", "bold", "brave", "bright", "brisk", "calm", "clever", "cosmic",
+		"crisp", "curious", "daring", "dazzling", "eager", "elated", "epic", "fancy", "fearless", "festive",
+		"fierce", "fluffy", "focused", "frosty", "gentle", "giddy", "golden", "happy", "hardy", "hidden",
+		"humble", "icy", "jolly", "jovial", "keen", "kind", "lively", "loyal", "lucid", "lucky",
+		"magic", "mellow", "merry", "mighty", "misty", "modest", "nimble", "noble", "nifty", "odd",
+		"patient", "peaceful", "plucky", "polite", "proud", "quick", "quiet", "quirky", "rapid", "rare",
+		"relaxed", "rustic", "serene", "sharp", "shiny", "silent", "silly", "sleek", "smooth", "snappy",
+		"solid", "sonic", "spicy", "stoic", "sturdy", "sunny", "swift", "tender", "tidy", "trusty",
+		"upbeat", "vast", "vibrant", "vivid", "wary", "warm", "wild", "wise", "witty", "zany",
+		"zealous", "zen",
+	}
+	idNouns = []string{
+		"babbage", "bardeen", "bohr", "boole", "carson", "cerf", "church", "curie", "darwin", "dijkstra",
+		"einstein", "euclid", "euler", "faraday", "fermat", "fermi", "feynman", "gauss", "goodall", "hamilton",
+		"hawking", "hopper", "hypatia", "johnson", "joule", "kepler", "knuth", "lamarr", "lamport", "leakey",
+		"liskov", "lovelace", "maxwell", "mccarthy", "meitner", "mendel", "minsky", "morse", "napier", "nash",
+		"newton", "nobel", "noether", "pascal", "pasteur", "pike", "planck", "poincare", "ramanujan", "raman",
+		"ritchie", "sagan", "shannon", "shaw", "stallman", "tesla", "thompson", "torvalds", "turing", "volta",
+		"wiles", "wozniak", "wright", "yalow", "yonath", "zuse",
+	}
+)
+
+func randomWord(words []string) string {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(words))))
+	if err != nil {
+		panic(err)
+	}
+	return words[n.Int64()]
+}
+
+// Generate an unused chat id such as "brave-turing". After a few
+// collisions a number is appended, as in "brave-turing-42".
+func generateChatID() string {
+	for attempt := 0; ; attempt++ {
+		id := randomWord(idAdjectives) + "-" + randomWord(idNouns)
+		if attempt >= 10 {
+			n, _ := rand.Int(rand.Reader, big.NewInt(1000))
+			id = fmt.Sprintf("%s-%d", id, n.Int64())
+		}
+		if !chatIDTaken(id) {
+			return id
+		}
+	}
+}
+
+// Whether id is already used as the id or name of a chat
+func chatIDTaken(id string) bool {
+	if _, ok := chatIndex[id]; ok {
+		return true
+	}
+	if resolveChatID(id) != id {
+		return true
+	}
+	_, err := os.Stat(chatPath(id))
+	return err == nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Show a desktop notification using the platform's native tool
+func notify(title, body string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := "display notification " + strconv.Quote(body) + " with title " + strconv.Quote(title)
+		cmd = exec.Command("osascript", "-e", script)
+	case "windows":
+		quote := func(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+		script := "Add-Type -AssemblyName System.Windows.Forms;" +
+			"$n = New-Object System.Windows.Forms.NotifyIcon;" +
+			"$n.Icon = [System.Drawing.SystemIcons]::Information;" +
+			"$n.Visible = $true;" +
+			"$n.ShowBalloonTip(5000, " + quote(title) + ", " + quote(body) + ", 'Info');" +
+			"Start-Sleep -Seconds 5; $n.Dispose()"
+		cmd = exec.Command("powershell.exe", "-NoProfile", "-Command", script)
+	default:
+		if _, err := exec.LookPath("notify-send"); err != nil {
+			return errors.New("notify-send not found")
+		}
+		cmd = exec.Command("notify-send", "--app-name=deepseek", title, body)
+	}
+	return cmd.Run()
+}
+
+// Shorten text to a single line of at most n runes for notification bodies
+func summarize(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) > n {
+		return string(runes[:n-1]) + "…"
+	}
+	return text
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// Provider APIs: OpenAI's chat completions, or Ollama's own
+	API_OPENAI = "openai"
+	API_OLLAMA = "ollama"
+
+	OLLAMA_URL = "http://localhost:11434"
+	// Address of the Ollama server, as read by the ollama CLI
+	OLLAMA_HOST = "OLLAMA_HOST"
+)
+
+// A request to Ollama's /api/chat
+type ollamaRequest struct {
+	Model    string         `json:"model"`
+	Messages []apiMessage   `json:"messages"`
+	Stream   bool           `json:"stream"`
+	Options  map[string]any `json:"options,omitempty"`
+}
+
+// One line of the newline-delimited JSON Ollama streams, the last one
+// with done set and the token counts
+type ollamaChunk struct {
+	Message struct {
+		Content  string `json:"content"`
+		Thinking string `json:"thinking"`
+	} `json:"message"`
+	Done            bool   `json:"done"`
+	DoneReason      string `json:"done_reason"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+	Error           string `json:"error"`
+}
+
+// The Ollama server: OLLAMA_HOST, which may lack the scheme, or the default
+func ollamaURL() string {
+	host := os.Getenv(OLLAMA_HOST)
+	if host == "" {
+		return OLLAMA_URL
+	}
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	return strings.TrimSuffix(host, "/")
+}
+
+// Send the messages to Ollama's /api/chat, reporting the answer to r as
+// streamChat does
+func streamOllama(r chatRequest) (chatResponse, error) {
+	var result chatResponse
+	start := time.Now()
+	emit := func(event streamEvent) {
+		if r.onEvent != nil {
+			r.onEvent(event)
+		}
+	}
+	p, baseURL := r.target()
+
+	messages := toAPIMessages(r.messages)
+	if r.prefix {
+		messages = continueMessages(p, messages)
+	}
+	body := ollamaRequest{
+		Model:    r.model,
+		Messages: messages,
+		Stream:   noStream == nil || !*noStream,
+	}
+	if r.temperature != nil {
+		body.Options = map[string]any{"temperature": *r.temperature}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return result, fmt.Errorf("marshaling request body: %w", err)
+	}
+	if r.debug {
+		log.Printf("Request body: %s\n", data)
+	}
+	req, err := http.NewRequestWithContext(r.context(), "POST", endpointURL(baseURL, "api/chat"), bytes.NewReader(data))
+	if err != nil {
+		return result, fmt.Errorf("creating request: %w", err)
+	}
+	rateID, err := waitRateLimit(r.context(), estimateTokens(messages))
+	if err != nil {
+		return result, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// A server behind a proxy may want a key
+	if r.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.apiKey)
+	}
+	prepareRequestFor(req, p)
+	resp, err := sendChatRequest(req, body.Stream)
+	if err != nil {
+		if r.context().Err() == nil && backoff(r.context(), r.retries+1, "Request failed: "+err.Error(), nil) {
+			r.retries++
+			return streamOllama(r)
+		}
+		return result, fmt.Errorf("making request (is `ollama serve` running?): %w", timeoutError(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		if r.onRaw != nil {
+			r.onRaw(string(msg))
+		}
+		if retryableStatus(resp.StatusCode) && backoff(r.context(), r.retries+1, "API error "+resp.Status, resp.Header) {
+			r.retries++
+			return streamOllama(r)
+		}
+		var chunk ollamaChunk
+		if json.Unmarshal(msg, &chunk) == nil && chunk.Error != "" {
+			return result, fmt.Errorf("ollama: %s", chunk.Error)
+		}
+		return result, &apiError{resp.StatusCode, resp.Status, string(msg)}
+	}
+
+	var content strings.Builder
+	stallBody := watchStall(resp.Body)
+	defer stallBody.Close()
+	lines := bufio.NewReader(stallBody)
+	var streamErr error
+	for {
+		line, err := readLine(lines)
+		if err != nil && (err != io.EOF || line == "") {
+			if err != io.EOF {
+				streamErr = err
+			}
+			break
+		}
+		if r.onRaw != nil {
+			r.onRaw(line)
+		}
+		if r.debug {
+			log.Printf("== Raw line received: %s\n", line)
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var chunk ollamaChunk
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			if r.debug {
+				log.Printf("Error unmarshaling JSON: %v\n", err)
+			}
+			continue
+		}
+		if chunk.Error != "" {
+			return result, errors.New("ollama: " + chunk.Error)
+		}
+		if result.firstToken == 0 && (chunk.Message.Content != "" || chunk.Message.Thinking != "") {
+			result.firstToken = time.Since(start)
+		}
+		if chunk.Message.Thinking != "" {
+			result.reasoning += chunk.Message.Thinking
+			emit(streamEvent{Type: "reasoning", Content: chunk.Message.Thinking})
+		}
+		if text := chunk.Message.Content; text != "" {
+			if r.out != nil {
+				fmt.Fprint(r.out, text)
+			}
+			content.WriteString(text)
+			emit(streamEvent{Type: "delta", Content: text})
+		}
+		if chunk.Done {
+			result.finishReason = chunk.DoneReason
+			result.usage = &Usage{
+				PromptTokens:     chunk.PromptEvalCount,
+				CompletionTokens: chunk.EvalCount,
+				TotalTokens:      chunk.PromptEvalCount + chunk.EvalCount,
+			}
+			emit(streamEvent{Type: "usage", Usage: result.usage})
+			break
+		}
+	}
+	result.content = content.String()
+	result.latency = time.Since(start)
+	result.apiKey = r.apiKey
+	result.interrupted = r.context().Err() != nil || streamErr != nil
+	recordUsage(rateID, result.usage)
+	if err := streamErr; err != nil {
+		if errors.Is(err, errStalled) && result.content == "" && result.reasoning == "" && backoff(r.context(), r.retries+1, err.Error(), nil) {
+			r.retries++
+			return streamOllama(r)
+		}
+		return result, fmt.Errorf("reading stream: %w", timeoutError(err))
+	}
+	return result, nil
+}
+
+// The models pulled into the Ollama server
+func ollamaModels() ([]string, error) {
+	req, err := http.NewRequest("GET", apiURL("api/tags"), nil)
+	if err != nil {
+		return nil, err
+	}
+	prepareRequest(req)
+	resp, err := sendRequest(req, API_TIMEOUT, 0)
+	if err != nil {
+		return nil, fmt.Errorf("listing models (is `ollama serve` running?): %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing models: %s", resp.Status)
+	}
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("parsing models: %w", err)
+	}
+	names := make([]string, len(tags.Models))
+	for i, m := range tags.Models {
+		names[i] = m.Name
+	}
+	return names, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Set by -q to suppress informational messages
+var quiet bool
+
+// Print an informational message to stderr unless -q is set, keeping
+// stdout for the model answer
+func infof(format string, args ...interface{}) {
+	if !quiet {
+		fmt.Fprintf(os.Stderr, format, args...)
+	}
+}
+
+// Print an error message to stderr
+func errorf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format, args...)
+}
+
+// Open the destination of the streamed answer: stdout by default, the file
+// given with -o, or both when -tee is set. The returned function closes the
+// file once the answer is complete.
+func openOutput(path string, tee, appendMode bool) (io.Writer, func() error, error) {
+	if path == "" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if appendMode {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening output file: %w", err)
+	}
+	if tee {
+		return io.MultiWriter(os.Stdout, file), file.Close, nil
+	}
+	return file, file.Close, nil
+}
+
+// Start a shell command that receives the streamed answer on stdin and
+// writes to out. The returned wait function closes its stdin and waits for it.
+func startPipe(cmdline string, out io.Writer) (io.Writer, func() error, error) {
+	cmd := shellCommand(cmdline)
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("starting pipe command: %w", err)
+	}
+	wait := func() error {
+		stdin.Close()
+		if err := cmd.Wait(); err != nil {
+			return fmt.Errorf("pipe command: %w", err)
+		}
+		return nil
+	}
+	return stdin, wait, nil
+}
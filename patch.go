@@ -0,0 +1,341 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const APPLY_PROMPT = `You are a coding assistant that edits files in the user's working tree.
+Answer ONLY with a unified diff (as produced by "git diff") implementing the requested change.
+Use paths relative to the working directory with a/ and b/ prefixes, include 3 lines of context
+and use /dev/null as the old path for new files. Do not add explanations.`
+
+func init() {
+	registerCommand(command{
+		name:  "apply",
+		usage: "[-f file]... [-dry-run] <prompt>  ask for a unified diff and apply it",
+		run:   runApply,
+	})
+}
+
+// A unified diff for a single file
+type filePatch struct {
+	oldPath string
+	newPath string
+	hunks   []hunk
+}
+
+type hunk struct {
+	header   string
+	oldStart int
+	lines    []string
+}
+
+// Lines the hunk expects to find in the original file
+func (h hunk) oldLines() []string {
+	var lines []string
+	for _, line := range h.lines {
+		if !strings.HasPrefix(line, "+") {
+			lines = append(lines, line[1:])
+		}
+	}
+	return lines
+}
+
+// Lines the hunk leaves in place of oldLines
+func (h hunk) newLines() []string {
+	var lines []string
+	for _, line := range h.lines {
+		if !strings.HasPrefix(line, "-") {
+			lines = append(lines, line[1:])
+		}
+	}
+	return lines
+}
+
+// Parse a unified diff. Fenced diff blocks are used when present, so the
+// model may wrap its answer in markdown.
+func parseUnifiedDiff(text string) ([]filePatch, error) {
+	var diffs []string
+	for _, block := range parseCodeBlocks(text) {
+		if block.lang == "diff" || block.lang == "patch" {
+			diffs = append(diffs, block.content)
+		}
+	}
+	if len(diffs) > 0 {
+		text = strings.Join(diffs, "\n")
+	}
+
+	var patches []filePatch
+	var current *filePatch
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			patches = append(patches, filePatch{
+				oldPath: diffPath(line[4:]),
+				newPath: diffPath(lines[i+1][4:]),
+			})
+			current = &patches[len(patches)-1]
+			i++
+
+		case strings.HasPrefix(line, "@@"):
+			if current == nil {
+				return nil, fmt.Errorf("hunk without file header: %s", line)
+			}
+			oldStart, err := parseHunkHeader(line)
+			if err != nil {
+				return nil, err
+			}
+			h := hunk{header: line, oldStart: oldStart}
+			for i+1 < len(lines) {
+				next := lines[i+1]
+				if next == "" {
+					// Models often strip the space of blank context lines
+					next = " "
+				}
+				if next[0] != ' ' && next[0] != '+' && next[0] != '-' {
+					break
+				}
+				if strings.HasPrefix(next, "--- ") && i+2 < len(lines) && strings.HasPrefix(lines[i+2], "+++ ") {
+					break
+				}
+				h.lines = append(h.lines, next)
+				i++
+			}
+			// Drop trailing blank context produced by the split
+			for len(h.lines) > 0 && h.lines[len(h.lines)-1] == " " {
+				h.lines = h.lines[:len(h.lines)-1]
+			}
+			current.hunks = append(current.hunks, h)
+		}
+	}
+	if len(patches) == 0 {
+		return nil, errors.New("no unified diff found in the response")
+	}
+	return patches, nil
+}
+
+func diffPath(path string) string {
+	if i := strings.IndexByte(path, '\t'); i >= 0 {
+		path = path[:i]
+	}
+	path = strings.TrimSpace(path)
+	if path == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(path, "a/") || strings.HasPrefix(path, "b/") {
+		path = path[2:]
+	}
+	return path
+}
+
+// Parse the old start line of "@@ -l,s +l,s @@"
+func parseHunkHeader(header string) (int, error) {
+	fields := strings.Fields(header)
+	if len(fields) < 3 || !strings.HasPrefix(fields[1], "-") {
+		return 0, fmt.Errorf("malformed hunk header: %s", header)
+	}
+	start, _, _ := strings.Cut(fields[1][1:], ",")
+	n, err := strconv.Atoi(start)
+	if err != nil {
+		return 0, fmt.Errorf("malformed hunk header: %s", header)
+	}
+	return n, nil
+}
+
+// Find where the hunk applies, searching outwards from its stated position
+// so that offsets introduced by earlier hunks or model miscounts are tolerated
+func findHunk(lines []string, h hunk, expected int) int {
+	old := h.oldLines()
+	matches := func(pos int) bool {
+		if pos < 0 || pos+len(old) > len(lines) {
+			return false
+		}
+		for i, line := range old {
+			if strings.TrimRight(lines[pos+i], " \t") != strings.TrimRight(line, " \t") {
+				return false
+			}
+		}
+		return true
+	}
+	for delta := 0; delta <= len(lines); delta++ {
+		if matches(expected - delta) {
+			return expected - delta
+		}
+		if matches(expected + delta) {
+			return expected + delta
+		}
+	}
+	return -1
+}
+
+// Apply hunks to lines in order. accept is called for every hunk with the
+// position where it applies (or -1) and decides whether it is applied.
+func applyHunks(lines []string, hunks []hunk, accept func(h hunk, pos int) bool) ([]string, int) {
+	offset, applied := 0, 0
+	for _, h := range hunks {
+		expected := h.oldStart - 1 + offset
+		if h.oldStart == 0 {
+			expected = 0
+		}
+		pos := findHunk(lines, h, expected)
+		if !accept(h, pos) || pos < 0 {
+			continue
+		}
+		old, repl := h.oldLines(), h.newLines()
+		lines = append(lines[:pos], append(repl, lines[pos+len(old):]...)...)
+		offset += len(repl) - len(old)
+		applied++
+	}
+	return lines, applied
+}
+
+// Print a hunk with added lines in green and removed lines in red
+func printHunk(w io.Writer, h hunk) {
+	fmt.Fprintln(w, colorize(h.header, "36"))
+	for _, line := range h.lines {
+		switch line[0] {
+		case '+':
+			fmt.Fprintln(w, colorize(line, "32"))
+		case '-':
+			fmt.Fprintln(w, colorize(line, "31"))
+		default:
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+func colorize(text, code string) string {
+	return "\033[" + code + "m" + text + "\033[0m"
+}
+
+// Apply a file patch to the working tree. Each hunk is confirmed unless
+// assumeYes is set; with dryRun nothing is written.
+func applyFilePatch(p filePatch, dryRun, assumeYes bool) error {
+	path := p.newPath
+	if path == "" {
+		path = p.oldPath
+	}
+	target, err := safeJoin(".", path)
+	if err != nil {
+		return err
+	}
+
+	// A new file of the diff would replace one that exists
+	if p.oldPath == "" {
+		if _, err := os.Stat(target); err == nil {
+			switch {
+			case dryRun:
+				infof("%s exists, the new file of the diff would replace it.\n", target)
+			case !assumeYes && !confirm(target+" exists, replace it with the new file of the diff?"):
+				return fmt.Errorf("%s exists, not replaced", target)
+			}
+		}
+	}
+
+	var lines []string
+	trailingNewline := true
+	if p.oldPath != "" {
+		data, err := os.ReadFile(target)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", target, err)
+		}
+		content := string(data)
+		trailingNewline = strings.HasSuffix(content, "\n")
+		lines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+		if content == "" {
+			lines = nil
+		}
+	}
+
+	infof("%s %s\n", colorize("==>", "1"), target)
+	lines, applied := applyHunks(lines, p.hunks, func(h hunk, pos int) bool {
+		printHunk(os.Stderr, h)
+		if pos < 0 {
+			errorf("Hunk does not apply, skipping.\n")
+			return false
+		}
+		if dryRun {
+			infof("Hunk applies at line %d.\n", pos+1)
+			return false
+		}
+		return assumeYes || confirm("Apply this hunk?")
+	})
+
+	if dryRun || applied == 0 {
+		return nil
+	}
+	if p.newPath == "" && len(lines) == 0 {
+		if err := os.Remove(target); err != nil {
+			return fmt.Errorf("removing %s: %w", target, err)
+		}
+		infof("Removed %s\n", target)
+		return nil
+	}
+	content := strings.Join(lines, "\n")
+	if trailingNewline {
+		content += "\n"
+	}
+	if err := os.WriteFile(target, []byte(content), 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", target, err)
+	}
+	infof("Applied %d/%d hunks to %s\n", applied, len(p.hunks), target)
+	return nil
+}
+
+func runApply(args []string) error {
+	fs := flag.NewFlagSet("apply", flag.ContinueOnError)
+	var files stringList
+	fs.Var(&files, "f", "File to send as context (repeatable)")
+	dryRun := fs.Bool("dry-run", false, "Show the hunks and where they apply without writing")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errors.New("usage: deepseek apply [-f file]... [-dry-run] <prompt>")
+	}
+
+	apiKey, err := loadAPIKey()
+	if err != nil {
+		return err
+	}
+
+	var prompt strings.Builder
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", file, err)
+		}
+		fmt.Fprintf(&prompt, "File: %s\n```\n%s\n```\n\n", file, data)
+	}
+	prompt.WriteString(strings.Join(args, " "))
+
+	messages := []Message{
+		{Role: "system", Content: APPLY_PROMPT},
+		{Role: "user", Content: prompt.String()},
+	}
+	resp, err := chatWithFallback(chatRequest{apiKey: apiKey, model: *model, messages: messages, out: os.Stdout, debug: *debug})
+	fmt.Println()
+	if err != nil {
+		return err
+	}
+
+	patches, err := parseUnifiedDiff(resp.content)
+	if err != nil {
+		return err
+	}
+	for _, p := range patches {
+		if err := applyFilePatch(p, *dryRun, *assumeYes); err != nil {
+			errorf("Error: %v\n", err)
+		}
+	}
+	return nil
+}
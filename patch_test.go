@@ -0,0 +1,101 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseUnifiedDiff(t *testing.T) {
+	text := "Here it is:\n```diff\n" +
+		"--- a/main.go\n+++ b/main.go\n" +
+		"@@ -1,3 +1,3 @@\n package main\n-var x = 1\n+var x = 2\n\n" +
+		"--- /dev/null\n+++ b/new.txt\n" +
+		"@@ -0,0 +1,2 @@\n+one\n+two\n" +
+		"```\n"
+	patches, err := parseUnifiedDiff(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []filePatch{
+		{oldPath: "main.go", newPath: "main.go", hunks: []hunk{
+			{header: "@@ -1,3 +1,3 @@", oldStart: 1, lines: []string{" package main", "-var x = 1", "+var x = 2"}},
+		}},
+		{oldPath: "", newPath: "new.txt", hunks: []hunk{
+			{header: "@@ -0,0 +1,2 @@", oldStart: 0, lines: []string{"+one", "+two"}},
+		}},
+	}
+	if !reflect.DeepEqual(patches, want) {
+		t.Errorf("parseUnifiedDiff = %#v, want %#v", patches, want)
+	}
+
+	for _, bad := range []string{"no diff here", "@@ -1 +1 @@\n-a\n+b\n", "--- a/x\n+++ b/x\n@@ nonsense @@\n"} {
+		if _, err := parseUnifiedDiff(bad); err == nil {
+			t.Errorf("parseUnifiedDiff(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestApplyHunks(t *testing.T) {
+	lines := strings.Split("a\nb\nc\nd\ne\nf", "\n")
+	tests := []struct {
+		name    string
+		hunks   []hunk
+		want    string
+		applied int
+	}{
+		{
+			name:    "at its position",
+			hunks:   []hunk{{oldStart: 2, lines: []string{" b", "-c", "+C", " d"}}},
+			want:    "a\nb\nC\nd\ne\nf",
+			applied: 1,
+		},
+		{
+			name:    "miscounted position",
+			hunks:   []hunk{{oldStart: 5, lines: []string{" a", "+x", " b"}}},
+			want:    "a\nx\nb\nc\nd\ne\nf",
+			applied: 1,
+		},
+		{
+			name: "offset of an earlier hunk",
+			hunks: []hunk{
+				{oldStart: 1, lines: []string{" a", "+a2", "+a3"}},
+				{oldStart: 5, lines: []string{" e", "-f"}},
+			},
+			want:    "a\na2\na3\nb\nc\nd\ne",
+			applied: 2,
+		},
+		{
+			name:    "context not found",
+			hunks:   []hunk{{oldStart: 1, lines: []string{" z", "-a"}}},
+			want:    "a\nb\nc\nd\ne\nf",
+			applied: 0,
+		},
+	}
+	for _, tt := range tests {
+		got, applied := applyHunks(append([]string(nil), lines...), tt.hunks, func(hunk, int) bool { return true })
+		if strings.Join(got, "\n") != tt.want || applied != tt.applied {
+			t.Errorf("%s: applyHunks = %q (%d applied), want %q (%d)", tt.name, strings.Join(got, "\n"), applied, tt.want, tt.applied)
+		}
+	}
+}
+
+func TestPatchNames(t *testing.T) {
+	tests := []struct {
+		patch filePatch
+		file  string
+		want  bool
+	}{
+		{filePatch{oldPath: "main.go", newPath: "main.go"}, "main.go", true},
+		{filePatch{oldPath: "main.go", newPath: "main.go"}, "./main.go", true},
+		{filePatch{oldPath: "cmd/main.go", newPath: "cmd/main.go"}, "/src/app/cmd/main.go", true},
+		{filePatch{oldPath: "other.go", newPath: "other.go"}, "main.go", false},
+		{filePatch{oldPath: "in.go", newPath: "main.go"}, "xmain.go", false},
+		{filePatch{oldPath: "main.go"}, "main.go", true},
+	}
+	for _, tt := range tests {
+		if got := patchNames(tt.patch, tt.file); got != tt.want {
+			t.Errorf("patchNames(%+v, %q) = %v, want %v", tt.patch, tt.file, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+const (
+	APP_DIR = "deepseek"
+	// Data directory of older versions, moved to the XDG location
+	LEGACY_DATA_DIR = ".deepseek"
+	HISTORY_FILE    = "DEEPSEEK_HISTORY_FILE"
+)
+
+var (
+	// Index file given by -history-file, overriding DEEPSEEK_HISTORY_FILE
+	historyFileFlag string
+	migrateDirOnce  sync.Once
+)
+
+// The base directory named by an XDG variable, or its default under the
+// home directory. Windows uses the roaming application data directory.
+func xdgDir(variable, fallback string) (string, error) {
+	if dir := os.Getenv(variable); filepath.IsAbs(dir) {
+		return filepath.Join(dir, APP_DIR), nil
+	}
+	if runtime.GOOS == "windows" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, APP_DIR), nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("getting home directory: %w", err)
+	}
+	return filepath.Join(homeDir, fallback, APP_DIR), nil
+}
+
+// The history index file: -history-file, DEEPSEEK_HISTORY_FILE, or
+// index.json in the data directory. Chats are stored next to it.
+func historyFilePath() (string, error) {
+	if historyFileFlag != "" {
+		return filepath.Abs(historyFileFlag)
+	}
+	if path := os.Getenv(HISTORY_FILE); path != "" {
+		return filepath.Abs(path)
+	}
+	return dataPath(INDEX_FILE)
+}
+
+// $XDG_DATA_HOME/deepseek, holding the history. The first call moves the
+// data directory of older versions there.
+func dataDir() (string, error) {
+	dir, err := xdgDir("XDG_DATA_HOME", filepath.Join(".local", "share"))
+	if err != nil {
+		return "", err
+	}
+	migrateDirOnce.Do(func() { migrateDataDir(dir) })
+	return dir, nil
+}
+
+// $XDG_CONFIG_HOME/deepseek, holding roles and snippets
+func configDir() (string, error) {
+	// Settle the move of an older data directory first
+	if _, err := dataDir(); err != nil {
+		return "", err
+	}
+	return xdgDir("XDG_CONFIG_HOME", ".config")
+}
+
+// Move ~/.deepseek to the XDG data directory unless that already exists,
+// then move the roles and snippets to the config directory
+func migrateDataDir(dir string) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return
+	}
+	legacy := filepath.Join(homeDir, LEGACY_DATA_DIR)
+	if info, err := os.Stat(legacy); err != nil || !info.IsDir() {
+		return
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0700); err != nil {
+		errorf("Warning: moving %s: %v\n", legacy, err)
+		return
+	}
+	if err := os.Rename(legacy, dir); err != nil {
+		errorf("Warning: moving %s to %s: %v\n", legacy, dir, err)
+		return
+	}
+	config, err := xdgDir("XDG_CONFIG_HOME", ".config")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(config, 0700); err != nil {
+		return
+	}
+	for _, name := range configFiles {
+		to := filepath.Join(config, name)
+		if _, err := os.Stat(to); err == nil {
+			continue
+		}
+		os.Rename(filepath.Join(dir, name), to)
+		os.Rename(filepath.Join(dir, name+".bak"), to+".bak")
+	}
+	infof("Moved %s to %s (roles and snippets to %s)\n", legacy, dir, config)
+}
+
+// Files kept in the config directory
+var configFiles = []string{ROLES_FILE, SNIPPETS_FILE, CONFIG_FILE}
+
+// Return the path of a file inside the config directory, creating the directory if needed
+func configPath(name string) (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("creating config directory: %w", err)
+	}
+	return filepath.Join(dir, name), nil
+}
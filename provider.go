@@ -0,0 +1,279 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const DEFAULT_PROVIDER = "deepseek"
+
+// A service speaking the OpenAI chat completions schema
+type provider struct {
+	name    string
+	baseURL string
+	// keyEnv names the environment variable holding its API keys
+	keyEnv string
+	// model is used when -model isn't given
+	model  string
+	models []string
+	// keys and keyCmd are api_keys and api_key_cmd of its config table;
+	// for deepseek the top-level settings
+	keys   []string
+	keyCmd string
+	// api is API_OPENAI, or API_OLLAMA for Ollama's own, which needs no key
+	api string
+	// headers and query are the HTTP headers and URL query parameters of
+	// every request to it, e.g. for gateways wanting a tenant
+	headers map[string]string
+	query   map[string]string
+}
+
+// Providers known without configuration; [providers.<name>] tables of the
+// config file change them or add others
+var builtinProviders = map[string]provider{
+	"deepseek": {
+		name:    "deepseek",
+		baseURL: DEFAULT_BASE_URL,
+		keyEnv:  API_KEY,
+		model:   "deepseek-chat",
+		models:  []string{"deepseek-chat", "deepseek-reasoner"},
+	},
+	"openai": {
+		name:    "openai",
+		baseURL: "https://api.openai.com/v1",
+		keyEnv:  "OPENAI_API_KEY",
+		model:   "gpt-4o-mini",
+		models:  []string{"gpt-4o-mini", "gpt-4o", "o3-mini"},
+	},
+	"groq": {
+		name:    "groq",
+		baseURL: "https://api.groq.com/openai/v1",
+		keyEnv:  "GROQ_API_KEY",
+		model:   "llama-3.3-70b-versatile",
+		models:  []string{"llama-3.3-70b-versatile", "llama-3.1-8b-instant"},
+	},
+	"together": {
+		name:    "together",
+		baseURL: "https://api.together.xyz/v1",
+		keyEnv:  "TOGETHER_API_KEY",
+		model:   "meta-llama/Llama-3.3-70B-Instruct-Turbo",
+		models:  []string{"meta-llama/Llama-3.3-70B-Instruct-Turbo", "deepseek-ai/DeepSeek-V3"},
+	},
+	"openrouter": {
+		name:    "openrouter",
+		baseURL: "https://openrouter.ai/api/v1",
+		keyEnv:  "OPENROUTER_API_KEY",
+		model:   "deepseek/deepseek-chat",
+		models:  []string{"deepseek/deepseek-chat", "deepseek/deepseek-r1", "openrouter/auto"},
+		// Attribution OpenRouter shows in its rankings
+		headers: map[string]string{
+			"HTTP-Referer": "https://github.com/asdf8601/deepseek",
+			"X-Title":      "deepseek",
+		},
+	},
+	"ollama": {
+		name:    "ollama",
+		baseURL: OLLAMA_URL,
+		keyEnv:  "OLLAMA_API_KEY",
+		model:   "llama3.2",
+		models:  []string{"llama3.2", "qwen2.5", "deepseek-r1"},
+		api:     API_OLLAMA,
+	},
+}
+
+// The provider of this invocation, chosen by -provider
+var currentProvider = builtinProviders[DEFAULT_PROVIDER]
+
+// -header: "Name: value" headers of every request, over the providers' own
+var extraHeaders stringList
+
+func init() {
+	registerCommand(command{
+		name:  "providers",
+		usage: "list the providers -provider accepts",
+		run:   runProviders,
+	})
+}
+
+// Every provider: the built-in ones with the config file's tables applied
+func allProviders() map[string]provider {
+	providers := make(map[string]provider, len(builtinProviders))
+	for name, p := range builtinProviders {
+		providers[name] = p
+	}
+	deepseek := providers[DEFAULT_PROVIDER]
+	deepseek.keys, deepseek.keyCmd = configuredKeys, apiKeyCmd
+	providers[DEFAULT_PROVIDER] = deepseek
+	ollama := providers["ollama"]
+	ollama.baseURL = ollamaURL()
+	providers["ollama"] = ollama
+	for key, value := range configValues {
+		rest, ok := strings.CutPrefix(key, "providers.")
+		if !ok {
+			continue
+		}
+		name, field, ok := strings.Cut(rest, ".")
+		if !ok {
+			continue
+		}
+		p := providers[name]
+		p.name = name
+		if table, param, ok := strings.Cut(field, "."); ok {
+			switch table {
+			case "headers":
+				p.headers = withEntry(p.headers, param, configString(value))
+			case "query":
+				p.query = withEntry(p.query, param, configString(value))
+			}
+			providers[name] = p
+			continue
+		}
+		switch field {
+		case "base_url":
+			p.baseURL = configString(value)
+		case "key_env":
+			p.keyEnv = configString(value)
+		case "model":
+			p.model = configString(value)
+		case "models":
+			p.models = strings.Split(configString(value), ",")
+		case "api_keys":
+			p.keys = splitKeys(configString(value))
+		case "api_key_cmd":
+			p.keyCmd = configString(value)
+		case "api":
+			p.api = configString(value)
+		}
+		providers[name] = p
+	}
+	for name, p := range providers {
+		if p.keyEnv == "" {
+			p.keyEnv = strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_API_KEY"
+		}
+		// The top-level [headers] and [query] tables apply to every provider,
+		// under its own
+		for key, value := range configValues {
+			if header, ok := strings.CutPrefix(key, "headers."); ok && p.headers[header] == "" {
+				p.headers = withEntry(p.headers, header, configString(value))
+			}
+			if param, ok := strings.CutPrefix(key, "query."); ok && p.query[param] == "" {
+				p.query = withEntry(p.query, param, configString(value))
+			}
+		}
+		providers[name] = p
+	}
+	return providers
+}
+
+// A copy of m with key set, so that the built-in providers' maps are never
+// written to
+func withEntry(m map[string]string, key, value string) map[string]string {
+	out := make(map[string]string, len(m)+1)
+	for k, v := range m {
+		out[k] = v
+	}
+	out[key] = value
+	return out
+}
+
+// Split a -header value into its name and value
+func parseHeader(header string) (string, string, error) {
+	name, value, ok := strings.Cut(header, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || strings.ContainsAny(name, " \t") {
+		return "", "", fmt.Errorf("-header %q is not of the form 'Name: value'", header)
+	}
+	return name, strings.TrimSpace(value), nil
+}
+
+// Check the -header values
+func checkHeaders() error {
+	for _, header := range extraHeaders {
+		if _, _, err := parseHeader(header); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Make the named provider current. Its base URL and model apply unless
+// -base-url and -model changed them from the defaults.
+func selectProvider(name string) error {
+	providers := allProviders()
+	p, ok := providers[name]
+	if !ok {
+		names := make([]string, 0, len(providers))
+		for n := range providers {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown provider %q, use one of %s or add [providers.%s] to the config file", name, strings.Join(names, ", "), name)
+	}
+	if p.baseURL == "" {
+		return fmt.Errorf("provider %s has no base_url", name)
+	}
+	if p.api != "" && p.api != API_OPENAI && p.api != API_OLLAMA {
+		return fmt.Errorf("provider %s: unknown api %q, use %s or %s", name, p.api, API_OPENAI, API_OLLAMA)
+	}
+	currentProvider = p
+	if name == DEFAULT_PROVIDER {
+		return nil
+	}
+	if apiBaseURL == DEFAULT_BASE_URL {
+		apiBaseURL = p.baseURL
+	}
+	if *model == builtinProviders[DEFAULT_PROVIDER].model && p.model != "" {
+		*model = p.model
+	}
+	return nil
+}
+
+// Add the headers and query parameters of the current provider and
+// -header to req
+func prepareRequest(req *http.Request) {
+	prepareRequestFor(req, currentProvider)
+}
+
+// Add the headers and query parameters of p and -header to req
+func prepareRequestFor(req *http.Request, p provider) {
+	for key, value := range p.headers {
+		req.Header.Set(key, value)
+	}
+	for _, header := range extraHeaders {
+		if name, value, err := parseHeader(header); err == nil {
+			req.Header.Set(name, value)
+		}
+	}
+	if len(p.query) > 0 {
+		query := req.URL.Query()
+		for key, value := range p.query {
+			query.Set(key, value)
+		}
+		req.URL.RawQuery = query.Encode()
+	}
+}
+
+func runProviders(args []string) error {
+	if len(args) > 0 {
+		return errors.New("usage: deepseek providers")
+	}
+	providers := allProviders()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Printf("%-2s %-12s %-36s %-18s %s\n", "", "PROVIDER", "BASE URL", "KEY", "MODELS")
+	for _, name := range names {
+		p := providers[name]
+		marker := ""
+		if name == currentProvider.name {
+			marker = "*"
+		}
+		fmt.Printf("%-2s %-12s %-36s %-18s %s\n", marker, name, p.baseURL, p.keyEnv, strings.Join(p.models, ", "))
+	}
+	return nil
+}
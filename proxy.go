@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Header naming the chat a proxied request is recorded to; the response
+	// carries it too
+	CHAT_HEADER = "X-Deepseek-Chat"
+	// Largest request body the proxy reads
+	MAX_PROXY_BODY = 32 << 20
+)
+
+// Headers that concern one connection only, not to be passed on
+var hopHeaders = []string{"Connection", "Keep-Alive", "Proxy-Connection", "Transfer-Encoding", "Upgrade", "Content-Length"}
+
+// The parts of an OpenAI chat completions request the proxy reads; the
+// request is forwarded whole
+type proxyRequest struct {
+	Model    string `json:"model"`
+	Messages []struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	} `json:"messages"`
+	Stream bool `json:"stream"`
+}
+
+// The chats of the proxy, by the key of their conversation so far, so
+// that a client sending the conversation again with a new prompt continues
+// its chat
+type proxyChats struct {
+	mu    sync.Mutex
+	chats map[string]string
+}
+
+// An error in the shape OpenAI clients read
+func writeOpenAIError(w http.ResponseWriter, status int, errType string, err error) {
+	writeJSON(w, status, map[string]any{"error": map[string]string{"message": err.Error(), "type": errType}})
+}
+
+// The current provider's URL of an endpoint of the OpenAI API; Ollama's
+// own API is elsewhere
+func openAIURL(endpoint string) string {
+	if currentProvider.api == API_OLLAMA {
+		return ollamaURL() + "/v1/" + endpoint
+	}
+	return apiURL(endpoint)
+}
+
+// Send r on to the endpoint of the current provider with its key, and
+// copy the status and headers of the response to w
+func (s *apiServer) forward(w http.ResponseWriter, r *http.Request, endpoint string, body []byte, stream bool) (*http.Response, error) {
+	apiKey, err := loadAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, openAIURL(endpoint), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"Content-Type", "Accept"} {
+		if value := r.Header.Get(name); value != "" {
+			req.Header.Set(name, value)
+		}
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	prepareRequest(req)
+	logAPIKey(apiKey)
+	resp, err := sendChatRequest(req, stream)
+	if err != nil {
+		return nil, timeoutError(err)
+	}
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	for _, name := range hopHeaders {
+		w.Header().Del(name)
+	}
+	return resp, nil
+}
+
+// GET /v1/models, passed on as is
+func (s *apiServer) handleModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, "GET")
+		return
+	}
+	resp, err := s.forward(w, r, "models", nil, false)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadGateway, "api_error", err)
+		return
+	}
+	defer resp.Body.Close()
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// POST /v1/chat/completions: the request goes as is to the current
+// provider, with its key, and the answer comes back as is, streamed or
+// not, while both are recorded to history: in the chat named by the
+// X-Deepseek-Chat header, else in the chat of the conversation so far, or
+// a new one.
+func (s *apiServer) handleCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, "POST")
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MAX_PROXY_BODY))
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", err)
+		return
+	}
+	var req proxyRequest
+	if err := json.Unmarshal(body, &req); err != nil || len(req.Messages) == 0 {
+		if err == nil {
+			err = errors.New("messages is empty")
+		}
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", err)
+		return
+	}
+	messages := make([]Message, len(req.Messages))
+	for i, msg := range req.Messages {
+		messages[i] = Message{Role: msg.Role, Content: contentText(msg.Content)}
+	}
+	if err := checkBudget(); err != nil {
+		writeOpenAIError(w, http.StatusPaymentRequired, "insufficient_quota", err)
+		return
+	}
+	chatID, err := s.proxyChat(r.Header.Get(CHAT_HEADER), messages[:len(messages)-1])
+	if err != nil {
+		writeOpenAIError(w, http.StatusNotFound, "invalid_request_error", err)
+		return
+	}
+	w.Header().Set(CHAT_HEADER, chatID)
+
+	rateID, err := waitRateLimit(r.Context(), estimateTokens(toAPIMessages(messages)))
+	if err != nil {
+		writeOpenAIError(w, http.StatusServiceUnavailable, "api_error", err)
+		return
+	}
+	start := time.Now()
+	resp, err := s.forward(w, r, "chat/completions", body, req.Stream)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadGateway, "api_error", err)
+		return
+	}
+	defer resp.Body.Close()
+	w.WriteHeader(resp.StatusCode)
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(w, resp.Body)
+		return
+	}
+
+	// The answer is read as the client gets it
+	flusher, _ := w.(http.Flusher)
+	tee := io.TeeReader(resp.Body, flushWriter{w, flusher})
+	request := chatRequest{model: req.Model}
+	var response chatResponse
+	if req.Stream {
+		response, err = readProxiedStream(tee, start)
+		io.Copy(io.Discard, tee)
+	} else {
+		response, err = readCompletion(request, tee, start)
+	}
+	if r.Context().Err() != nil {
+		response.interrupted, err = true, nil
+	}
+	recordUsage(rateID, response.usage)
+	recordSpend(req.Model, response.usage)
+	if err != nil || (response.content == "" && response.reasoning == "") {
+		return
+	}
+	if err := s.recordProxied(chatID, messages, response.message(req.Model)); err != nil {
+		errorf("Error saving chat %s: %v\n", chatID, err)
+	}
+}
+
+// A writer flushing each write to the client
+type flushWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if f.flusher != nil {
+		f.flusher.Flush()
+	}
+	return n, err
+}
+
+// Read a streamed completion for the answer, the usage and the model
+func readProxiedStream(body io.Reader, start time.Time) (chatResponse, error) {
+	var result chatResponse
+	var content strings.Builder
+	events := newSSEReader(body, nil)
+	for {
+		line, err := events.next()
+		if err == io.EOF || line == "[DONE]" {
+			break
+		}
+		if err != nil {
+			result.interrupted = true
+			break
+		}
+		var chunk StreamResponse
+		if json.Unmarshal([]byte(line), &chunk) != nil {
+			continue
+		}
+		if chunk.Model != "" {
+			result.model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			result.usage = chunk.Usage
+		}
+		if len(chunk.Choices) > 0 {
+			choice := chunk.Choices[0]
+			if result.firstToken == 0 && (choice.Delta.Content != "" || choice.Delta.ReasoningContent != "") {
+				result.firstToken = time.Since(start)
+			}
+			content.WriteString(choice.Delta.Content)
+			result.reasoning += choice.Delta.ReasoningContent
+			if choice.FinishReason != "" {
+				result.finishReason = choice.FinishReason
+			}
+		}
+	}
+	result.content = content.String()
+	result.latency = time.Since(start)
+	return result, nil
+}
+
+// The chat to record a request to: the one named, else the one whose
+// conversation so far is prior, else a new one
+func (s *apiServer) proxyChat(named string, prior []Message) (string, error) {
+	if named != "" {
+		return lookupChat(named)
+	}
+	s.proxied.mu.Lock()
+	defer s.proxied.mu.Unlock()
+	if chatID, ok := s.proxied.chats[conversationKey(prior)]; ok && len(prior) > 0 {
+		if _, err := lookupChat(chatID); err == nil {
+			return chatID, nil
+		}
+	}
+	return generateChatID(), nil
+}
+
+// Save the exchange: the new messages to a chat that exists, the whole
+// conversation to a new one
+func (s *apiServer) recordProxied(chatID string, messages []Message, answer Message) error {
+	messages[len(messages)-1].Time = now()
+	first := false
+	err := updateChat(chatID, func(chat *Chat, exists bool) {
+		if exists {
+			chat.Messages = append(chat.Messages, messages[len(messages)-1], answer)
+			return
+		}
+		first = true
+		*chat = Chat{CreatedAt: time.Now(), Messages: append(append([]Message(nil), messages...), answer)}
+	})
+	if err != nil {
+		return err
+	}
+	if first {
+		titleInBackground(chatID)
+	}
+	s.proxied.mu.Lock()
+	defer s.proxied.mu.Unlock()
+	if s.proxied.chats == nil {
+		s.proxied.chats = map[string]string{}
+	}
+	s.proxied.chats[conversationKey(append(messages, answer))] = chatID
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"time"
+)
+
+func init() {
+	registerCommand(command{
+		name:  "prune",
+		usage: "[-keep N] [-keep-days D | -keep-within 2w] [-tag t] [-dry-run]  remove all but the recently used chats",
+		run:   runPrune,
+	})
+}
+
+func runPrune(args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	keep := fs.Int("keep", -1, "Keep the N most recently used chats")
+	keepDays := fs.Int("keep-days", -1, "Keep chats used in the last D days")
+	keepWithin := fs.String("keep-within", "", "Keep chats used within a duration such as 2w or 3mo")
+	tag := fs.String("tag", "", "Only prune chats with this tag")
+	dryRun := fs.Bool("dry-run", false, "List the chats that would be removed without removing them")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 || *keep < 0 && *keepDays < 0 && *keepWithin == "" {
+		return errors.New("usage: deepseek prune [-keep N] [-keep-days D | -keep-within 2w] [-tag t] [-dry-run]")
+	}
+	within := time.Duration(-1)
+	if *keepDays >= 0 {
+		within = time.Duration(*keepDays) * 24 * time.Hour
+	}
+	if *keepWithin != "" {
+		if within, err = parseDuration(*keepWithin); err != nil {
+			return err
+		}
+	}
+
+	doomed := pruneCandidates(*keep, within, *tag)
+	if len(doomed) == 0 {
+		infof("Nothing to prune.\n")
+		return nil
+	}
+	for _, id := range doomed {
+		meta := chatIndex[id]
+		fmt.Printf("%-22s %s  %s\n", id, meta.UpdatedAt.Local().Format(time.DateTime), summarize(meta.LastUserMessage, 50))
+	}
+	if *dryRun {
+		infof("%d chat(s) would be removed.\n", len(doomed))
+		return nil
+	}
+	if !*assumeYes && !confirm(fmt.Sprintf("Remove these %d chat(s)?", len(doomed))) {
+		return nil
+	}
+
+	listed := make(map[string]ChatMeta, len(doomed))
+	for _, id := range doomed {
+		listed[id] = chatIndex[id]
+	}
+	return withHistoryLock(func() error {
+		autoBackup("prune")
+		removed := 0
+		for id, meta := range listed {
+			// Spare chats used since they were listed
+			if current, ok := chatIndex[id]; !ok || !current.UpdatedAt.Equal(meta.UpdatedAt) {
+				continue
+			}
+			if err := deleteChat(id); err != nil {
+				return err
+			}
+			removed++
+		}
+		infof("Removed %d chat(s).\n", removed)
+		return nil
+	})
+}
+
+// The chats outside the keep rules, a chat being kept when any rule keeps
+// it. Pinned and archived chats are never pruned.
+func pruneCandidates(keep int, within time.Duration, tag string) []string {
+	var ids []string
+	for id, meta := range chatIndex {
+		if meta.Pinned || meta.Archived || tag != "" && !hasTag(meta.Tags, tag) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return chatIndex[ids[i]].UpdatedAt.After(chatIndex[ids[j]].UpdatedAt) })
+
+	cutoff := time.Now().Add(-within)
+	var doomed []string
+	for i, id := range ids {
+		if keep >= 0 && i < keep || within >= 0 && chatIndex[id].UpdatedAt.After(cutoff) {
+			continue
+		}
+		doomed = append(doomed, id)
+	}
+	return doomed
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Where -queue keeps the prompts that failed to send for lack of network
+const QUEUE_FILE = "queue.json"
+
+// -queue: keep prompts that can't be sent for `deepseek flush`
+var queueOffline bool
+
+// A prompt waiting for the network, with what is needed to send it as it
+// would have been
+type queuedPrompt struct {
+	ID          int64     `json:"id"`
+	Time        time.Time `json:"time"`
+	ChatID      string    `json:"chat_id"`
+	Prompt      string    `json:"prompt"`
+	Provider    string    `json:"provider"`
+	BaseURL     string    `json:"base_url"`
+	Model       string    `json:"model"`
+	Temperature *float64  `json:"temperature,omitempty"`
+	Memory      int       `json:"memory"`
+	// The persona and system message of a chat that doesn't exist yet
+	Role   string `json:"role,omitempty"`
+	System string `json:"system,omitempty"`
+}
+
+func init() {
+	registerCommand(command{
+		name:  "flush",
+		usage: "[-dry-run]  send the prompts queued with -queue while offline into their chats",
+		run:   runFlush,
+	})
+}
+
+// Update the queue under its lock
+func updateQueue(fn func(queue []queuedPrompt) []queuedPrompt) ([]queuedPrompt, error) {
+	path, err := dataPath(QUEUE_FILE)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := lockPath(path+".lock", "queue")
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	var queue []queuedPrompt
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &queue); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	}
+	if fn == nil {
+		return queue, nil
+	}
+	queue = fn(queue)
+	data, err := json.MarshalIndent(queue, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return queue, writeFileAtomic(path, data, 0600)
+}
+
+// Add a prompt to the end of the queue
+func queuePrompt(p queuedPrompt) error {
+	p.ID, p.Time = time.Now().UnixNano(), time.Now()
+	_, err := updateQueue(func(queue []queuedPrompt) []queuedPrompt {
+		return append(queue, p)
+	})
+	return err
+}
+
+// The messages of chat to send with a new prompt: the system message and
+// the last limit messages
+func memoryContext(chat Chat, limit int) []Message {
+	var system []Message
+	for _, msg := range chat.Messages {
+		if msg.Role == "system" {
+			system = []Message{msg}
+			break
+		}
+	}
+	context := append([]Message(nil), chat.Messages...)
+	// A chat recorded by the proxy may have no system message
+	if len(context) > limit+len(system) {
+		context = append(system, context[len(context)-limit:]...)
+	}
+	return context
+}
+
+func runFlush(args []string) error {
+	fs := flag.NewFlagSet("flush", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "Only list the queued prompts")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return errors.New("usage: deepseek flush [-dry-run]")
+	}
+	queue, err := updateQueue(nil)
+	if err != nil {
+		return err
+	}
+	if len(queue) == 0 {
+		infof("No queued prompts\n")
+		return nil
+	}
+	if *dryRun {
+		for _, p := range queue {
+			fmt.Printf("%s  %s  %s\n", p.Time.Local().Format("2006-01-02 15:04"), p.ChatID, summarize(p.Prompt, 60))
+		}
+		return nil
+	}
+	failed := 0
+	for i, p := range queue {
+		infof("== [%d/%d] chat %s: %s\n", i+1, len(queue), p.ChatID, summarize(p.Prompt, 60))
+		err := sendQueued(p)
+		if exitCode(err) == EXIT_NETWORK || exitCode(err) == EXIT_INTERRUPTED {
+			return fmt.Errorf("%w; %d prompt(s) stay queued", err, len(queue)-i)
+		}
+		if err != nil {
+			errorf("Error: %v\n", err)
+			setExitStatus(exitCode(err))
+			failed++
+			continue
+		}
+		_, err = updateQueue(func(queue []queuedPrompt) []queuedPrompt {
+			for j := range queue {
+				if queue[j].ID == p.ID {
+					return append(queue[:j], queue[j+1:]...)
+				}
+			}
+			return queue
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d prompt(s) failed and stay queued", failed)
+	}
+	return nil
+}
+
+// Send a queued prompt and add it and its answer to its chat
+func sendQueued(p queuedPrompt) error {
+	provider, ok := allProviders()[p.Provider]
+	if !ok {
+		return fmt.Errorf("provider %s no longer exists", p.Provider)
+	}
+	chat, exists, err := loadChat(p.ChatID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		chat = Chat{CreatedAt: p.Time, Role: p.Role, Messages: []Message{{Role: "system", Content: p.System}}}
+	}
+	// Dated when it was written
+	userMessage := Message{Role: "user", Content: p.Prompt, Time: &p.Time}
+	request := chatRequest{
+		provider:    provider,
+		baseURL:     p.BaseURL,
+		model:       p.Model,
+		messages:    append(memoryContext(chat, p.Memory), userMessage),
+		temperature: p.Temperature,
+		debug:       *debug,
+	}
+	if request.apiKey, err = providerAPIKey(provider); err != nil {
+		return err
+	}
+	response, err := streamToStdout(request)
+	if err != nil {
+		return err
+	}
+	err = updateChat(p.ChatID, func(stored *Chat, exists bool) {
+		if !exists {
+			*stored = chat
+		}
+		stored.Messages = append(stored.Messages, userMessage, response.message(p.Model))
+	})
+	if err == nil && !exists {
+		titleInBackground(p.ChatID)
+	}
+	return err
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+)
+
+const (
+	// Where the requests of the last minute are kept, for every invocation
+	// to see
+	RATE_STATE_FILE = "ratelimit.json"
+	RATE_WINDOW     = time.Minute
+)
+
+var (
+	// -rpm and -tpm: requests and tokens per minute not to exceed, 0 for
+	// no limit
+	requestsPerMinute int
+	tokensPerMinute   int
+)
+
+// A request of the window, with the tokens it was estimated to take and
+// then took
+type rateEntry struct {
+	Time   int64 `json:"time"`
+	Tokens int   `json:"tokens"`
+}
+
+// The requests of the window per provider
+type rateState map[string][]rateEntry
+
+// Update the rate limit state under its lock, dropping requests that left
+// the window
+func updateRateState(fn func(entries []rateEntry) []rateEntry) error {
+	path, err := dataPath(RATE_STATE_FILE)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockPath(path+".lock", "rate limit state")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	state := rateState{}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &state)
+	}
+	cutoff := time.Now().Add(-RATE_WINDOW).UnixMilli()
+	var recent []rateEntry
+	for _, e := range state[currentProvider.name] {
+		if e.Time > cutoff {
+			recent = append(recent, e)
+		}
+	}
+	state[currentProvider.name] = fn(recent)
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0600)
+}
+
+// Wait until a request of about tokens fits in -rpm and -tpm, and count
+// it. The returned id is for recordTokens; 0 when no limit is set.
+func waitRateLimit(ctx context.Context, tokens int) (int64, error) {
+	if requestsPerMinute <= 0 && tokensPerMinute <= 0 {
+		return 0, nil
+	}
+	// A request larger than the whole budget waits for an empty window
+	tokens = min(tokens, max(tokensPerMinute, 1))
+	for {
+		var id int64
+		var wait time.Duration
+		err := updateRateState(func(entries []rateEntry) []rateEntry {
+			now := time.Now()
+			wait = 0
+			if requestsPerMinute > 0 && len(entries) >= requestsPerMinute {
+				oldest := entries[len(entries)-requestsPerMinute]
+				wait = time.UnixMilli(oldest.Time).Add(RATE_WINDOW).Sub(now)
+			}
+			if tokensPerMinute > 0 {
+				used := 0
+				for _, e := range entries {
+					used += e.Tokens
+				}
+				// Until enough of the oldest requests leave the window
+				for _, e := range entries {
+					if used+tokens <= tokensPerMinute {
+						break
+					}
+					used -= e.Tokens
+					wait = max(wait, time.UnixMilli(e.Time).Add(RATE_WINDOW).Sub(now))
+				}
+			}
+			if wait > 0 {
+				return entries
+			}
+			id = now.UnixMilli()
+			return append(entries, rateEntry{Time: id, Tokens: tokens})
+		})
+		if err != nil {
+			return 0, err
+		}
+		if wait <= 0 {
+			return id, nil
+		}
+		infof("Rate limit reached (-rpm %d, -tpm %d), waiting %.1fs\n", requestsPerMinute, tokensPerMinute, wait.Seconds())
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+// Replace the estimate of the request id with the tokens it took
+func recordUsage(id int64, usage *Usage) {
+	if id == 0 || usage == nil {
+		return
+	}
+	tokens := usage.TotalTokens
+	err := updateRateState(func(entries []rateEntry) []rateEntry {
+		for i := range entries {
+			if entries[i].Time == id {
+				entries[i].Tokens = tokens
+			}
+		}
+		return entries
+	})
+	if err != nil && debug != nil && *debug {
+		errorf("Recording tokens: %v\n", err)
+	}
+}
+
+// A rough count of the tokens of messages, about four characters each
+func estimateTokens(messages []apiMessage) int {
+	chars := 0
+	for _, m := range messages {
+		chars += len(m.Content)
+	}
+	return chars/4 + 1
+}
+
+// Check -rpm and -tpm
+func checkRateLimit() error {
+	if requestsPerMinute < 0 || tokensPerMinute < 0 {
+		return errors.New("-rpm and -tpm take a positive number, or 0 for no limit")
+	}
+	return nil
+}
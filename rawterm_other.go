@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// Raw terminal mode is not available on this platform
+func makeRaw(f *os.File) (func(), error) {
+	return nil, errors.New("full-screen mode is not supported on this platform")
+}
@@ -0,0 +1,565 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	REMOTE_HISTORY    = "DEEPSEEK_REMOTE"
+	S3_ENDPOINT       = "DEEPSEEK_S3_ENDPOINT"
+	WEBDAV_USER       = "DEEPSEEK_WEBDAV_USER"
+	WEBDAV_PASSWORD   = "DEEPSEEK_WEBDAV_PASSWORD"
+	REMOTE_STATE_FILE = "remote.json"
+)
+
+var errNotModified = errors.New("not modified")
+
+// Storage for the history outside this machine. Names are slash
+// separated paths relative to the configured location.
+type remoteBackend interface {
+	// get fails with os.ErrNotExist for missing objects and with
+	// errNotModified when the object still has the given etag
+	get(name, etag string) (data []byte, newEtag string, err error)
+	put(name string, data []byte) (etag string, err error)
+	remove(name string) error
+}
+
+// What this machine knows of the remote: the remote index as of the last
+// sync and the chats changed locally that still have to be uploaded
+type remoteState struct {
+	Etag    string              `json:"etag,omitempty"`
+	Chats   map[string]ChatMeta `json:"chats"`
+	Pending []string            `json:"pending,omitempty"`
+}
+
+var (
+	remote      remoteBackend
+	remoteDirty = make(map[string]bool)
+)
+
+// Set up the backend named by DEEPSEEK_REMOTE: s3://bucket/prefix for S3
+// and compatible stores, or an http(s) URL of a WebDAV collection
+func openRemote() (remoteBackend, error) {
+	value := os.Getenv(REMOTE_HISTORY)
+	if value == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", REMOTE_HISTORY, err)
+	}
+	switch u.Scheme {
+	case "s3":
+		region := os.Getenv("AWS_REGION")
+		if region == "" {
+			region = os.Getenv("AWS_DEFAULT_REGION")
+		}
+		if region == "" {
+			region = "us-east-1"
+		}
+		b := &s3Backend{
+			bucket:       u.Host,
+			prefix:       strings.Trim(u.Path, "/"),
+			region:       region,
+			accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+			secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+			endpoint:     strings.TrimSuffix(os.Getenv(S3_ENDPOINT), "/"),
+		}
+		if b.bucket == "" || b.accessKey == "" || b.secretKey == "" {
+			return nil, fmt.Errorf("%s=s3://bucket/prefix needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY", REMOTE_HISTORY)
+		}
+		return b, nil
+	case "http", "https":
+		b := &webdavBackend{user: os.Getenv(WEBDAV_USER), password: os.Getenv(WEBDAV_PASSWORD)}
+		if u.User != nil {
+			b.user = u.User.Username()
+			if password, ok := u.User.Password(); ok {
+				b.password = password
+			}
+			u.User = nil
+		}
+		b.base = strings.TrimSuffix(u.String(), "/")
+		return b, nil
+	}
+	return nil, fmt.Errorf("%s must be an s3:// or http(s):// URL, got %q", REMOTE_HISTORY, value)
+}
+
+// An unexpected response status of the remote
+type remoteError struct {
+	status int
+	msg    string
+}
+
+func (e *remoteError) Error() string { return e.msg }
+
+// Whether err is a response with the given status
+func isRemoteStatus(err error, status int) bool {
+	var re *remoteError
+	return errors.As(err, &re) && re.status == status
+}
+
+// Send a request and map the status codes shared by both backends
+func doRemote(req *http.Request) ([]byte, string, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("remote history: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("remote history: reading response: %w", err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return nil, "", errNotModified
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, "", os.ErrNotExist
+	case resp.StatusCode >= 300:
+		return nil, "", &remoteError{
+			status: resp.StatusCode,
+			msg:    fmt.Sprintf("remote history: %s %s: %s: %s", req.Method, req.URL.Redacted(), resp.Status, summarize(string(body), 200)),
+		}
+	}
+	return body, resp.Header.Get("ETag"), nil
+}
+
+// A bucket of Amazon S3 or of a compatible store such as MinIO or R2, with
+// requests signed with AWS Signature Version 4
+type s3Backend struct {
+	bucket, prefix, region string
+	accessKey, secretKey   string
+	sessionToken           string
+	// endpoint, when set, is used with path-style addressing
+	endpoint string
+}
+
+func (b *s3Backend) url(name string) string {
+	key := name
+	if b.prefix != "" {
+		key = b.prefix + "/" + name
+	}
+	var segments []string
+	for _, s := range strings.Split(key, "/") {
+		segments = append(segments, awsEscape(s))
+	}
+	if b.endpoint != "" {
+		return b.endpoint + "/" + awsEscape(b.bucket) + "/" + strings.Join(segments, "/")
+	}
+	return "https://" + b.bucket + ".s3." + b.region + ".amazonaws.com/" + strings.Join(segments, "/")
+}
+
+func (b *s3Backend) do(method, name string, body []byte, headers map[string]string) ([]byte, string, error) {
+	req, err := http.NewRequest(method, b.url(name), bytes.NewReader(body))
+	if err != nil {
+		return nil, "", err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	b.sign(req, body, time.Now().UTC())
+	return doRemote(req)
+}
+
+func (b *s3Backend) get(name, etag string) ([]byte, string, error) {
+	headers := map[string]string{}
+	if etag != "" {
+		headers["If-None-Match"] = etag
+	}
+	return b.do("GET", name, nil, headers)
+}
+
+func (b *s3Backend) put(name string, data []byte) (string, error) {
+	_, etag, err := b.do("PUT", name, data, map[string]string{"Content-Type": "application/json"})
+	return etag, err
+}
+
+func (b *s3Backend) remove(name string) error {
+	_, _, err := b.do("DELETE", name, nil, nil)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Add the AWS Signature Version 4 headers to req
+func (b *s3Backend) sign(req *http.Request, body []byte, t time.Time) {
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if b.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", b.sessionToken)
+	}
+
+	signed := []string{"host"}
+	for key := range req.Header {
+		if lower := strings.ToLower(key); strings.HasPrefix(lower, "x-amz-") || lower == "content-type" {
+			signed = append(signed, lower)
+		}
+	}
+	sort.Strings(signed)
+	var canonicalHeaders strings.Builder
+	for _, key := range signed {
+		value := req.URL.Host
+		if key != "host" {
+			value = strings.TrimSpace(req.Header.Get(key))
+		}
+		canonicalHeaders.WriteString(key + ":" + value + "\n")
+	}
+	signedHeaders := strings.Join(signed, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + b.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+	key := hmacSHA256([]byte("AWS4"+b.secretKey), date)
+	for _, part := range []string{b.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", b.accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// Percent-encode everything but the unreserved characters, as AWS expects
+func awsEscape(s string) string {
+	var out strings.Builder
+	for _, c := range []byte(s) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~", c) >= 0 {
+			out.WriteByte(c)
+		} else {
+			fmt.Fprintf(&out, "%%%02X", c)
+		}
+	}
+	return out.String()
+}
+
+// A WebDAV collection, such as Nextcloud or an Apache mod_dav share
+type webdavBackend struct {
+	base           string
+	user, password string
+}
+
+func (b *webdavBackend) do(method, name string, body []byte, headers map[string]string) ([]byte, string, error) {
+	target := b.base
+	if name != "" {
+		target += "/" + name
+	}
+	req, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, "", err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	if b.user != "" {
+		req.SetBasicAuth(b.user, b.password)
+	}
+	return doRemote(req)
+}
+
+func (b *webdavBackend) get(name, etag string) ([]byte, string, error) {
+	headers := map[string]string{}
+	if etag != "" {
+		headers["If-None-Match"] = etag
+	}
+	return b.do("GET", name, nil, headers)
+}
+
+func (b *webdavBackend) put(name string, data []byte) (string, error) {
+	_, etag, err := b.do("PUT", name, data, map[string]string{"Content-Type": "application/json"})
+	if isRemoteStatus(err, http.StatusConflict) {
+		// The parent collections don't exist yet; MKCOL answers 405 for
+		// the ones that do
+		for _, dir := range []string{"", remoteDir(name)} {
+			if _, _, err := b.do("MKCOL", dir, nil, nil); err != nil && !isRemoteStatus(err, http.StatusMethodNotAllowed) {
+				return "", err
+			}
+		}
+		_, etag, err = b.do("PUT", name, data, map[string]string{"Content-Type": "application/json"})
+	}
+	return etag, err
+}
+
+func (b *webdavBackend) remove(name string) error {
+	_, _, err := b.do("DELETE", name, nil, nil)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// The collection holding a slash separated name, empty at the top
+func remoteDir(name string) string {
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		return name[:i]
+	}
+	return ""
+}
+
+func remoteChatName(chatID string) string {
+	return CHATS_DIR + "/" + chatID + ".json"
+}
+
+// Remember that a chat changed locally and has to be uploaded
+func markRemoteDirty(chatID string) {
+	if remote != nil {
+		remoteDirty[chatID] = true
+	}
+}
+
+func loadRemoteState() remoteState {
+	state := remoteState{Chats: make(map[string]ChatMeta)}
+	if data, err := os.ReadFile(filepath.Join(historyDir, REMOTE_STATE_FILE)); err == nil {
+		json.Unmarshal(data, &state)
+	}
+	if state.Chats == nil {
+		state.Chats = make(map[string]ChatMeta)
+	}
+	return state
+}
+
+func saveRemoteState(state remoteState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(historyDir, REMOTE_STATE_FILE), data, 0600)
+}
+
+// Bring the local copy up to date with the remote history: chats changed
+// elsewhere are downloaded and chats removed elsewhere are removed here.
+// Chats only known locally are queued for upload.
+func pullRemote() {
+	backend, err := openRemote()
+	if err != nil {
+		errorf("Warning: %v\n", err)
+		return
+	}
+	if backend == nil {
+		return
+	}
+	remote = backend
+
+	err = withHistoryLock(func() error {
+		state := loadRemoteState()
+		pending := make(map[string]bool)
+		for _, id := range state.Pending {
+			pending[id] = true
+		}
+
+		data, etag, err := remote.get(INDEX_FILE, state.Etag)
+		var remoteIndex Config
+		switch {
+		case errors.Is(err, errNotModified):
+			remoteIndex.Chats = state.Chats
+			etag = state.Etag
+		case errors.Is(err, os.ErrNotExist):
+			// A new remote: everything here is uploaded
+		case err != nil:
+			return err
+		default:
+			if err := json.Unmarshal(data, &remoteIndex); err != nil {
+				return fmt.Errorf("parsing remote index: %w", err)
+			}
+		}
+		if remoteIndex.Chats == nil {
+			remoteIndex.Chats = make(map[string]ChatMeta)
+		}
+
+		for id, meta := range remoteIndex.Chats {
+			// A tampered index can't place files outside the chats directory
+			if err := validChatID(id); err != nil {
+				errorf("Warning: skipping remote chat: %v\n", err)
+				continue
+			}
+			local, ok := chatIndex[id]
+			known, wasKnown := state.Chats[id]
+			if wasKnown && meta.UpdatedAt.Equal(known.UpdatedAt) || !wasKnown && ok && !meta.UpdatedAt.After(local.UpdatedAt) {
+				continue
+			}
+			data, _, err := remote.get(remoteChatName(id), "")
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if ok && pending[id] {
+				// Changed on both sides since the last sync
+				if err := mergeRemoteChat(id, data); err != nil {
+					return err
+				}
+				continue
+			}
+			// A change elsewhere wins over removing the chat here
+			delete(pending, id)
+			if err := writeFileAtomic(chatPath(id), data, 0600); err != nil {
+				return err
+			}
+			chatIndex[id] = meta
+		}
+		for id := range chatIndex {
+			_, onRemote := remoteIndex.Chats[id]
+			_, known := state.Chats[id]
+			switch {
+			case onRemote || pending[id]:
+			case known:
+				// Removed on another machine since the last sync
+				if err := deleteChat(id); err != nil {
+					return err
+				}
+				delete(remoteDirty, id)
+			default:
+				pending[id] = true
+			}
+		}
+
+		state.Etag = etag
+		state.Chats = remoteIndex.Chats
+		state.Pending = state.Pending[:0]
+		for id := range pending {
+			remoteDirty[id] = true
+			state.Pending = append(state.Pending, id)
+		}
+		return saveRemoteState(state)
+	})
+	if err != nil {
+		errorf("Warning: syncing remote history: %v\n", err)
+	}
+}
+
+// Upload the chats changed locally and the updated remote index. Chats
+// that fail to upload stay queued for the next run. The caller holds the
+// history lock.
+func pushRemote() error {
+	if remote == nil || len(remoteDirty) == 0 {
+		return nil
+	}
+	state := loadRemoteState()
+	for _, id := range state.Pending {
+		remoteDirty[id] = true
+	}
+	var ids []string
+	for id := range remoteDirty {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var remoteIndex Config
+	data, _, err := remote.get(INDEX_FILE, "")
+	if err == nil {
+		err = json.Unmarshal(data, &remoteIndex)
+	} else if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	if remoteIndex.Chats == nil {
+		remoteIndex.Chats = make(map[string]ChatMeta)
+	}
+	if err == nil {
+		for _, id := range ids {
+			meta, ok := chatIndex[id]
+			if !ok {
+				if err = remote.remove(remoteChatName(id)); err != nil {
+					break
+				}
+				delete(remoteIndex.Chats, id)
+				continue
+			}
+			// Another machine uploaded the chat since this one last synced
+			if current, onRemote := remoteIndex.Chats[id]; onRemote && !current.UpdatedAt.Equal(state.Chats[id].UpdatedAt) {
+				var data []byte
+				if data, _, err = remote.get(remoteChatName(id), ""); err == nil {
+					err = mergeRemoteChat(id, data)
+				} else if errors.Is(err, os.ErrNotExist) {
+					err = nil
+				}
+				if err != nil {
+					break
+				}
+				meta = chatIndex[id]
+			}
+			var chat []byte
+			if chat, err = os.ReadFile(chatPath(id)); err != nil {
+				break
+			}
+			if _, err = remote.put(remoteChatName(id), chat); err != nil {
+				break
+			}
+			remoteIndex.Chats[id] = meta
+		}
+	}
+	if err == nil {
+		remoteIndex.SchemaVersion = schemaVersion
+		var index []byte
+		if index, err = json.MarshalIndent(remoteIndex, "", "  "); err == nil {
+			if state.Etag, err = remote.put(INDEX_FILE, index); err == nil {
+				state.Chats = remoteIndex.Chats
+				state.Pending = nil
+				clear(remoteDirty)
+			}
+		}
+	}
+	if err != nil {
+		state.Pending = ids
+	}
+	if saveErr := saveRemoteState(state); err == nil {
+		err = saveErr
+	}
+	return err
+}
+
+// Merge the remote version of a chat into the local one, which both
+// changed since the last sync. The caller holds the history lock.
+func mergeRemoteChat(chatID string, data []byte) error {
+	var theirs Chat
+	if err := json.Unmarshal(data, &theirs); err != nil {
+		return fmt.Errorf("parsing remote chat %s: %w", chatID, err)
+	}
+	ours, _, err := loadChat(chatID)
+	if err != nil {
+		return err
+	}
+	merged, forked := mergeChatVersions(chatID, ours, theirs)
+	if err := writeChatFile(chatID, merged); err != nil {
+		return err
+	}
+	chatIndex[chatID] = metaFor(merged)
+	if forked != nil {
+		return saveForkedChat(chatID, *forked)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+func init() {
+	registerCommand(command{
+		name:  "rename",
+		usage: "<chat-id> <name>  name a chat (an empty name removes it)",
+		run:   runRename,
+	})
+}
+
+func validChatName(name string) error {
+	if strings.ContainsAny(name, " \t\n/\\") {
+		return fmt.Errorf("invalid name %q: use letters, digits, - or _", name)
+	}
+	return nil
+}
+
+func runRename(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: deepseek rename <chat-id> <name>")
+	}
+	name := args[1]
+	if err := validChatName(name); err != nil {
+		return err
+	}
+
+	return withHistoryLock(func() error {
+		chatID := resolveChatID(args[0])
+		if _, ok := chatIndex[chatID]; !ok {
+			return fmt.Errorf("chat %s not found", args[0])
+		}
+		if name != "" {
+			if _, ok := chatIndex[name]; ok && name != chatID {
+				return fmt.Errorf("%s is already the id of another chat", name)
+			}
+			if other := resolveChatID(name); other != name && other != chatID {
+				return fmt.Errorf("chat %s is already named %s", other, name)
+			}
+		}
+		chat, _, err := loadChat(chatID)
+		if err != nil {
+			return err
+		}
+		chat.Name = name
+		if err := writeChatFile(chatID, chat); err != nil {
+			return err
+		}
+		indexChat(chatID, chat, false)
+		if name == "" {
+			infof("Chat %s is no longer named.\n", chatID)
+		} else {
+			infof("Chat %s is now named %s.\n", chatID, name)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerCommand(command{
+		name:  "repl",
+		usage: "[chat-id] [-new] [-memory n] [-temperature t]  chat interactively, with /help for the slash commands",
+		run:   runREPL,
+	})
+	// Assigned here, as /help lists them
+	replCommands = map[string]replCommand{
+		"help":   {"  list the commands", replHelp},
+		"model":  {"[name]  show or switch the model", replModel},
+		"new":    {"  start a new chat", replNew},
+		"chat":   {"<id|name>  switch to another chat", replChat},
+		"system": {"[text]  show or replace the system message", replSystem},
+		"role":   {"<name>  use a persona as the system message", replRole},
+		"save":   {"<file>  export the chat as Markdown", replSave},
+		"retry":  {"  regenerate the last answer with the current model", replRetry},
+		"tokens": {"  tokens and estimated cost of the chat so far", replTokens},
+		"show":   {"[n]  print the last n turns, all by default", replShow},
+		"quit":   {"  leave, as Ctrl-D does", nil},
+	}
+}
+
+// The state of an interactive session, changed by slash commands
+type replSession struct {
+	chatID      string
+	model       string
+	temperature *float64
+	memory      int
+	editor      *lineEditor
+	// Persona and system message of a chat not saved yet
+	role   string
+	system string
+}
+
+// A slash command of the REPL
+type replCommand struct {
+	usage string
+	run   func(s *replSession, arg string) error
+}
+
+var replCommands map[string]replCommand
+
+// Ends the session
+var errQuit = errors.New("quit")
+
+func runREPL(args []string) error {
+	fs := flag.NewFlagSet("repl", flag.ContinueOnError)
+	newChat := fs.Bool("new", false, "Start a new chat instead of continuing the last one")
+	memory := fs.Int("memory", 10, "Number of messages to include in the memory")
+	temperature := fs.Float64("temperature", -1, "Sampling temperature, 0 to 2")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 1 || (*newChat && len(args) == 1) {
+		return errors.New("usage: deepseek repl [chat-id] [-new] [-memory n] [-temperature t]")
+	}
+	s := &replSession{model: *model, memory: *memory, editor: newLineEditor()}
+	s.editor.complete = s.complete
+	if *temperature >= 0 {
+		s.temperature = temperature
+	}
+	switch {
+	case len(args) == 1:
+		err = replChat(s, args[0])
+	case *newChat || lastChatID == "":
+		err = replNew(s, "")
+	default:
+		err = replChat(s, lastChatID)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := loadAPIKey(); err != nil {
+		return err
+	}
+	infof("Chatting in %s with %s, /help lists the commands, Ctrl-D leaves\n", s.chatID, s.model)
+
+	for {
+		line, err := s.read()
+		if err == io.EOF {
+			fmt.Fprintln(os.Stderr)
+			return nil
+		}
+		// Ctrl-C only clears the line
+		if err == errInterrupted {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "/") {
+			err = s.command(line)
+		} else {
+			err = s.ask(line)
+		}
+		if err == errQuit {
+			return nil
+		}
+		if err != nil {
+			errorf("Error: %v\n", err)
+		}
+	}
+}
+
+// Read the next line of input
+func (s *replSession) read() (string, error) {
+	return s.editor.readLine(s.chatID + "> ")
+}
+
+// Run a slash command such as "/model deepseek-reasoner"
+func (s *replSession) command(line string) error {
+	name, arg, _ := strings.Cut(strings.TrimPrefix(line, "/"), " ")
+	if name == "exit" || name == "q" {
+		name = "quit"
+	}
+	cmd, ok := replCommands[name]
+	if !ok {
+		return fmt.Errorf("unknown command /%s, see /help", name)
+	}
+	if cmd.run == nil {
+		return errQuit
+	}
+	return cmd.run(s, strings.TrimSpace(arg))
+}
+
+// Send a prompt in the chat and store the turn. Ctrl-C stops the answer,
+// keeping what arrived, and not the session.
+func (s *replSession) ask(prompt string) error {
+	chat, exists, err := loadChat(s.chatID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		chat = Chat{CreatedAt: time.Now(), Role: s.role, Messages: []Message{{Role: "system", Content: s.system}}}
+	}
+	if prompt, err = attachFiles(prompt); err != nil {
+		return err
+	}
+	userMessage := Message{Role: "user", Content: prompt, Time: now()}
+	request := chatRequest{
+		model:       s.model,
+		messages:    append(memoryContext(chat, s.memory), userMessage),
+		temperature: s.temperature,
+		debug:       *debug,
+	}
+	if request.apiKey, err = loadAPIKey(); err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(request.context(), os.Interrupt)
+	request.ctx = ctx
+	response, err := streamToStdout(request)
+	canceled := ctx.Err() != nil
+	stop()
+	if err != nil && !(response.interrupted && (response.content != "" || response.reasoning != "")) {
+		if canceled {
+			return errInterrupted
+		}
+		return err
+	}
+	if response.interrupted {
+		infof("Interrupted, the partial answer is kept, `deepseek resume` continues it\n")
+	}
+	err = updateChat(s.chatID, func(stored *Chat, exists bool) {
+		if !exists {
+			*stored = chat
+		}
+		stored.Messages = append(stored.Messages, userMessage, response.message(s.model))
+		lastChatID = s.chatID
+	})
+	if err == nil && !exists {
+		titleInBackground(s.chatID)
+	}
+	return err
+}
+
+func replHelp(s *replSession, _ string) error {
+	names := make([]string, 0, len(replCommands))
+	for name := range replCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		usage, summary, _ := strings.Cut(replCommands[name].usage, "  ")
+		fmt.Fprintf(os.Stderr, "  %-18s %s\n", strings.TrimSpace("/"+name+" "+usage), summary)
+	}
+	return nil
+}
+
+func replModel(s *replSession, arg string) error {
+	if arg != "" {
+		s.model = arg
+	}
+	fmt.Fprintln(os.Stderr, s.model)
+	return nil
+}
+
+func replNew(s *replSession, _ string) error {
+	role, system, err := resolveRole("")
+	if err != nil {
+		return err
+	}
+	s.chatID, s.role, s.system = generateChatID(), role, system
+	infof("New chat %s\n", s.chatID)
+	return nil
+}
+
+func replChat(s *replSession, arg string) error {
+	if arg == "" {
+		return errors.New("usage: /chat <id|name>")
+	}
+	chatID := resolveChatID(arg)
+	if _, ok := chatIndex[chatID]; !ok {
+		return fmt.Errorf("chat %s not found", arg)
+	}
+	s.chatID = chatID
+	chat, _, err := loadChat(chatID)
+	if err != nil {
+		return err
+	}
+	if i := lastAnswer(chat.Messages); i >= 0 && chat.Messages[i].Model != "" {
+		s.model = chat.Messages[i].Model
+	}
+	return nil
+}
+
+func replSystem(s *replSession, arg string) error {
+	chat, exists, err := loadChat(s.chatID)
+	if err != nil {
+		return err
+	}
+	if arg == "" {
+		for _, msg := range chat.Messages {
+			if msg.Role == "system" {
+				fmt.Fprintln(os.Stderr, msg.Content)
+				return nil
+			}
+		}
+		fmt.Fprintln(os.Stderr, s.system)
+		return nil
+	}
+	return s.setSystem("", arg, exists)
+}
+
+func replRole(s *replSession, arg string) error {
+	if arg == "" {
+		return errors.New("usage: /role <name>")
+	}
+	name, content, err := resolveRole(arg)
+	if err != nil {
+		return err
+	}
+	_, exists, err := loadChat(s.chatID)
+	if err != nil {
+		return err
+	}
+	return s.setSystem(name, content, exists)
+}
+
+// Replace the system message of the chat, or of the chat to be
+func (s *replSession) setSystem(role, content string, exists bool) error {
+	if !exists {
+		s.role, s.system = role, content
+		return nil
+	}
+	return updateChat(s.chatID, func(stored *Chat, _ bool) {
+		setSystemMessage(stored, content)
+		stored.Role = role
+	})
+}
+
+func replSave(s *replSession, arg string) error {
+	if arg == "" {
+		return errors.New("usage: /save <file>")
+	}
+	chat, exists, err := loadChat(s.chatID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New("nothing to save yet")
+	}
+	if filepath.Ext(arg) == "" {
+		arg += ".md"
+	}
+	f, err := os.Create(arg)
+	if err != nil {
+		return err
+	}
+	if err := exportMarkdown(f, []namedChat{{s.chatID, chat}}); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	infof("Saved %s\n", arg)
+	return nil
+}
+
+func replRetry(s *replSession, _ string) error {
+	return runRetry([]string{s.chatID, "-model", s.model})
+}
+
+func replTokens(s *replSession, _ string) error {
+	chat, _, err := loadChat(s.chatID)
+	if err != nil {
+		return err
+	}
+	var prompt, completion int
+	var cost float64
+	for _, msg := range chat.Messages {
+		if msg.Usage != nil {
+			prompt += msg.Usage.PromptTokens
+			completion += msg.Usage.CompletionTokens
+			cost += estimateCost(msg.Model, msg.Usage)
+		}
+	}
+	context := estimateTokens(toAPIMessages(memoryContext(chat, s.memory)))
+	fmt.Fprintf(os.Stderr, "%d prompt and %d completion tokens so far, about $%.4f; the next prompt sends about %d tokens of memory\n", prompt, completion, cost, context)
+	return nil
+}
+
+func replShow(s *replSession, arg string) error {
+	if _, ok := chatIndex[s.chatID]; !ok {
+		return errors.New("nothing to show yet")
+	}
+	args := []string{s.chatID}
+	if arg != "" {
+		args = append(args, "-n", arg)
+	}
+	return runShow(args)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+// Asks providers without prefix completion to go on with a partial answer
+const RESUME_PROMPT = "Your previous answer was cut off. Continue it exactly where it stopped, without repeating anything."
+
+func init() {
+	registerCommand(command{
+		name:  "resume",
+		usage: "[chat-id]  continue an answer cut short by Ctrl-C or a dropped connection",
+		run:   runResume,
+	})
+}
+
+// The messages asking to continue the last one, a partial assistant
+// message: DeepSeek completes it as a prefix, other providers are asked to
+// go on
+func continueMessages(p provider, messages []apiMessage) []apiMessage {
+	if p.name == DEFAULT_PROVIDER {
+		messages[len(messages)-1].Prefix = true
+		return messages
+	}
+	return append(messages, apiMessage{Role: "user", Content: RESUME_PROMPT})
+}
+
+// DeepSeek's prefix completion is only served by its beta endpoint, next
+// to /v1
+func prefixCompletionURL(baseURL string) string {
+	base := strings.TrimSuffix(strings.TrimSuffix(baseURL, "/"), "/v1")
+	return base + "/beta/chat/completions"
+}
+
+func runResume(args []string) error {
+	chatID, chat, err := chatFromArgs(args, "usage: deepseek resume [chat-id]")
+	if err != nil {
+		return err
+	}
+	index := len(chat.Messages) - 1
+	if index < 0 || chat.Messages[index].Role != "assistant" || !chat.Messages[index].Interrupted {
+		return fmt.Errorf("the last answer of chat %s wasn't interrupted, see `deepseek retry`", chatID)
+	}
+	partial := chat.Messages[index]
+
+	request := chatRequest{
+		model:    *model,
+		messages: chat.Messages,
+		debug:    *debug,
+		prefix:   true,
+	}
+	if partial.Model != "" {
+		request.model = partial.Model
+	}
+	if request.apiKey, err = loadAPIKey(); err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(request.context(), os.Interrupt)
+	defer stop()
+	request.ctx = ctx
+
+	// Show the whole answer, the part kept first
+	fmt.Print(partial.Content)
+	response, err := streamToStdout(request)
+	if err != nil && !(response.interrupted && response.content != "") {
+		if ctx.Err() != nil {
+			err = errInterrupted
+		}
+		return err
+	}
+	if response.interrupted {
+		infof("Interrupted again, `deepseek resume` continues from here\n")
+		if ctx.Err() != nil {
+			err = errInterrupted
+		}
+		setExitStatus(exitCode(err))
+	}
+
+	// Extend the partial answer in the stored chat, unless another
+	// invocation changed it meanwhile
+	return updateChat(chatID, func(stored *Chat, _ bool) {
+		i := len(stored.Messages) - 1
+		answer := response.message(request.model)
+		answer.Content = partial.Content + answer.Content
+		answer.Reasoning = partial.Reasoning + answer.Reasoning
+		if i != index || stored.Messages[i].Content != partial.Content {
+			errorf("Warning: chat %s changed meanwhile, appending the continued answer\n", chatID)
+			stored.Messages = append(stored.Messages, answer)
+			return
+		}
+		stored.Messages[i] = answer
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func init() {
+	registerCommand(command{
+		name:  "retry",
+		usage: "[chat-id] [-model m] [-temperature t]  regenerate the last answer",
+		run:   runRetry,
+	})
+}
+
+// Stream the answer to stdout, soft-wrapped on a terminal
+func streamToStdout(request chatRequest) (chatResponse, error) {
+	request.out = os.Stdout
+	var wrapper *wrapWriter
+	if isTerminal(os.Stdout) {
+		width, _, _ := terminalSize(os.Stdout)
+		wrapper = newWrapWriter(os.Stdout, width)
+		stopResize := watchResize(os.Stdout, wrapper.setWidth)
+		defer stopResize()
+		request.out = wrapper
+	}
+	response, err := chatWithFallback(request)
+	if wrapper != nil {
+		wrapper.Flush()
+	}
+	fmt.Println()
+	return response, err
+}
+
+// Index of the last assistant message, or -1
+func lastAnswer(messages []Message) int {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "assistant" {
+			return i
+		}
+	}
+	return -1
+}
+
+func runRetry(args []string) error {
+	fs := flag.NewFlagSet("retry", flag.ContinueOnError)
+	retryModel := fs.String("model", "", "Model to use instead of the one that gave the answer")
+	temperature := fs.Float64("temperature", -1, "Sampling temperature, 0 to 2")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	chatID, chat, err := chatFromArgs(args, "usage: deepseek retry [chat-id] [-model m] [-temperature t]")
+	if err != nil {
+		return err
+	}
+	index := lastAnswer(chat.Messages)
+	if index < 0 {
+		return fmt.Errorf("chat %s has no answer to retry", chatID)
+	}
+	old := chat.Messages[index]
+
+	request := chatRequest{
+		model:    *model,
+		messages: chat.Messages[:index],
+		debug:    *debug,
+	}
+	if old.Model != "" {
+		request.model = old.Model
+	}
+	if *retryModel != "" {
+		request.model = *retryModel
+	}
+	if *temperature >= 0 {
+		request.temperature = temperature
+	}
+	if request.apiKey, err = loadAPIKey(); err != nil {
+		return err
+	}
+
+	response, err := streamToStdout(request)
+	if err != nil {
+		return err
+	}
+
+	// Replace the answer in the stored chat, unless another invocation
+	// changed it meanwhile
+	return updateChat(chatID, func(stored *Chat, _ bool) {
+		i := lastAnswer(stored.Messages)
+		answer := response.message(request.model)
+		if i != index || stored.Messages[i].Content != old.Content {
+			errorf("Warning: chat %s changed meanwhile, appending the new answer\n", chatID)
+			stored.Messages = append(stored.Messages, answer)
+			return
+		}
+		stored.Messages[i] = answer
+	})
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Select the chats matched by one -rm criterion: a duration (chats created
+// before now minus it), a chat ID or name, a /regexp/ or a glob over ids,
+// names and titles. Pinned and archived chats only match by ID or name.
+func matchChats(criterion, tag string) ([]string, error) {
+	protected := func(meta ChatMeta) bool {
+		return meta.Pinned || meta.Archived || tag != "" && !hasTag(meta.Tags, tag)
+	}
+
+	if d, err := parseDuration(criterion); err == nil {
+		// An age of 0 would take every chat
+		if d <= 0 {
+			return nil, fmt.Errorf("invalid age %s: use a duration above zero", criterion)
+		}
+		cutoff := time.Now().Add(-d)
+		var ids []string
+		for id, meta := range chatIndex {
+			if !protected(meta) && meta.CreatedAt.Before(cutoff) {
+				ids = append(ids, id)
+			}
+		}
+		return ids, nil
+	}
+	if id := resolveChatID(criterion); id != "" {
+		if _, ok := chatIndex[id]; ok {
+			return []string{id}, nil
+		}
+	}
+
+	var match func(string) bool
+	switch {
+	case len(criterion) > 2 && strings.HasPrefix(criterion, "/") && strings.HasSuffix(criterion, "/"):
+		re, err := regexp.Compile(criterion[1 : len(criterion)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", criterion, err)
+		}
+		match = re.MatchString
+	case strings.ContainsAny(criterion, "*?["):
+		if _, err := path.Match(criterion, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", criterion, err)
+		}
+		match = func(s string) bool {
+			ok, _ := path.Match(criterion, s)
+			return ok
+		}
+	default:
+		return nil, fmt.Errorf("%s is not a duration, chat ID or pattern", criterion)
+	}
+	var ids []string
+	for id, meta := range chatIndex {
+		if protected(meta) {
+			continue
+		}
+		if match(id) || meta.Name != "" && match(meta.Name) || meta.Title != "" && match(meta.Title) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// Remove the chats matched by any of the criteria after listing them and
+// asking for confirmation. With dryRun they are only listed.
+func removeChats(criteria []string, tag string, dryRun bool) error {
+	selected := make(map[string]ChatMeta)
+	for _, criterion := range criteria {
+		if criterion = strings.TrimSpace(criterion); criterion == "" {
+			continue
+		}
+		ids, err := matchChats(criterion, tag)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			selected[id] = chatIndex[id]
+		}
+	}
+	if len(selected) == 0 {
+		infof("No chats match.\n")
+		return nil
+	}
+
+	ids := make([]string, 0, len(selected))
+	for id := range selected {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return selected[ids[i]].CreatedAt.After(selected[ids[j]].CreatedAt) })
+	for _, id := range ids {
+		meta := selected[id]
+		label := meta.Title
+		if label == "" {
+			label = meta.LastUserMessage
+		}
+		fmt.Printf("%-22s %s  %s\n", id, meta.CreatedAt.Local().Format(time.DateTime), summarize(label, 50))
+	}
+	if dryRun {
+		infof("%d chat(s) would be removed.\n", len(ids))
+		return nil
+	}
+	if !*assumeYes && !confirm(fmt.Sprintf("Remove these %d chat(s)?", len(ids))) {
+		return nil
+	}
+
+	return withHistoryLock(func() error {
+		autoBackup("rm")
+		removed := 0
+		for _, id := range ids {
+			if _, ok := chatIndex[id]; !ok {
+				continue
+			}
+			if err := deleteChat(id); err != nil {
+				return err
+			}
+			removed++
+		}
+		infof("Removed %d chat(s).\n", removed)
+		return nil
+	})
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	ROLES_FILE   = "roles.json"
+	DEFAULT_ROLE = "You are a helpful assistant. Be concise."
+)
+
+func init() {
+	registerCommand(command{
+		name:  "role",
+		usage: "add <name> [prompt] | list | show <name> | rm <name>",
+		run:   runRole,
+	})
+}
+
+func loadRoles() (map[string]string, error) {
+	return loadStore(ROLES_FILE)
+}
+
+func saveRoles(roles map[string]string) error {
+	return saveStore(ROLES_FILE, roles)
+}
+
+// Resolve the persona to use for a new chat. An explicit -role must exist in
+// the registry; DEEPSEEK_ROLE may name a persona or hold a literal system prompt.
+func resolveRole(name string) (string, string, error) {
+	roles, err := loadRoles()
+	if err != nil {
+		return "", "", err
+	}
+	if name != "" {
+		content, ok := roles[name]
+		if !ok {
+			return "", "", fmt.Errorf("role %q not found", name)
+		}
+		return name, content, nil
+	}
+
+	env := os.Getenv(ROLE)
+	if env == "" {
+		return "", DEFAULT_ROLE, nil
+	}
+	if content, ok := roles[env]; ok {
+		return env, content, nil
+	}
+	return "", env, nil
+}
+
+func runRole(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: deepseek role add|list|show|rm")
+	}
+
+	switch args[0] {
+	case "add":
+		if len(args) < 2 {
+			return errors.New("usage: deepseek role add <name> [prompt]")
+		}
+		content := strings.Join(args[2:], " ")
+		if content == "" {
+			// Read the system prompt from stdin when none is given
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return fmt.Errorf("reading stdin: %w", err)
+			}
+			content = strings.TrimSpace(string(data))
+		}
+		if content == "" {
+			return errors.New("role prompt is empty")
+		}
+		roles, err := loadRoles()
+		if err != nil {
+			return err
+		}
+		roles[args[1]] = content
+		if err := saveRoles(roles); err != nil {
+			return err
+		}
+		infof("Role %s saved.\n", args[1])
+
+	case "list", "ls":
+		roles, err := loadRoles()
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(roles))
+		for name := range roles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			preview := truncateWidth(strings.ReplaceAll(roles[name], "\n", " "), 60)
+			fmt.Printf("%-20s %s\n", name, preview)
+		}
+
+	case "show":
+		if len(args) < 2 {
+			return errors.New("usage: deepseek role show <name>")
+		}
+		roles, err := loadRoles()
+		if err != nil {
+			return err
+		}
+		content, ok := roles[args[1]]
+		if !ok {
+			return fmt.Errorf("role %q not found", args[1])
+		}
+		fmt.Println(content)
+
+	case "rm":
+		if len(args) < 2 {
+			return errors.New("usage: deepseek role rm <name>")
+		}
+		roles, err := loadRoles()
+		if err != nil {
+			return err
+		}
+		for _, name := range args[1:] {
+			if _, ok := roles[name]; !ok {
+				return fmt.Errorf("role %q not found", name)
+			}
+			delete(roles, name)
+			infof("Role %s removed.\n", name)
+		}
+		return saveRoles(roles)
+
+	default:
+		return fmt.Errorf("unknown role command: %s", args[0])
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	MAX_HISTORY_SIZE = "DEEPSEEK_MAX_HISTORY_SIZE"
+	MAX_CHATS        = "DEEPSEEK_MAX_CHATS"
+	ROTATED_DIR      = "rotated"
+)
+
+// A chat as stored in a rotated archive, one per line
+type rotatedChat struct {
+	ID   string `json:"id"`
+	Chat Chat   `json:"chat"`
+}
+
+// Parse a size such as 500000, 512k, 50MB or 1G
+func parseSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	multiplier := int64(1)
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			s = s[:len(s)-1]
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q: use bytes or a K, M or G suffix", value)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// Move the least recently used chats out of the history into a dated
+// archive while it holds more than DEEPSEEK_MAX_CHATS chats or more than
+// DEEPSEEK_MAX_HISTORY_SIZE bytes. Pinned and archived chats stay.
+func rotateHistory() {
+	maxChats, maxSize := -1, int64(-1)
+	if v := os.Getenv(MAX_CHATS); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			errorf("Warning: ignoring invalid %s=%q\n", MAX_CHATS, v)
+		} else {
+			maxChats = n
+		}
+	}
+	if v := os.Getenv(MAX_HISTORY_SIZE); v != "" {
+		n, err := parseSize(v)
+		if err != nil {
+			errorf("Warning: ignoring %s: %v\n", MAX_HISTORY_SIZE, err)
+		} else {
+			maxSize = n
+		}
+	}
+	if maxChats < 0 && maxSize < 0 || maxChats >= 0 && len(chatIndex) <= maxChats && maxSize < 0 {
+		return
+	}
+
+	err := withHistoryLock(func() error {
+		sizes := make(map[string]int64, len(chatIndex))
+		var total int64
+		var candidates []string
+		for id, meta := range chatIndex {
+			if maxSize >= 0 {
+				if info, err := os.Stat(chatPath(id)); err == nil {
+					sizes[id] = info.Size()
+					total += info.Size()
+				}
+			}
+			if !meta.Pinned && !meta.Archived && id != lastChatID {
+				candidates = append(candidates, id)
+			}
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			return chatIndex[candidates[i]].UpdatedAt.Before(chatIndex[candidates[j]].UpdatedAt)
+		})
+
+		count := len(chatIndex)
+		var rotate []string
+		for _, id := range candidates {
+			if (maxChats < 0 || count <= maxChats) && (maxSize < 0 || total <= maxSize) {
+				break
+			}
+			rotate = append(rotate, id)
+			count--
+			total -= sizes[id]
+		}
+		if len(rotate) == 0 {
+			return nil
+		}
+
+		path, err := writeRotated(rotate)
+		if err != nil {
+			return err
+		}
+		for _, id := range rotate {
+			if err := deleteChat(id); err != nil {
+				return err
+			}
+		}
+		infof("History over its limit: moved %d chat(s) to %s\n", len(rotate), path)
+		return nil
+	})
+	if err != nil {
+		errorf("Error rotating history: %v\n", err)
+	}
+}
+
+// Append the chats to today's gzipped JSONL archive in the rotated directory.
+// Each run adds a gzip member, which readers see as one stream.
+func writeRotated(ids []string) (string, error) {
+	dir := filepath.Join(historyDir, ROTATED_DIR)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "chats-"+time.Now().Format("2006-01-02")+".jsonl.gz")
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(gz)
+	for _, id := range ids {
+		chat, exists, err := loadChat(id)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			continue
+		}
+		if err := enc.Encode(rotatedChat{ID: id, Chat: chat}); err != nil {
+			return "", err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
+
+// Read chats back from a rotated archive
+func importRotated(path string) ([]Chat, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	var chats []Chat
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var rc rotatedChat
+		if err := json.Unmarshal(scanner.Bytes(), &rc); err != nil {
+			return nil, err
+		}
+		chats = append(chats, rc.Chat)
+	}
+	return chats, scanner.Err()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Interpreters used to run a code block, by fence language
+var runners = map[string][]string{
+	"bash":       {"bash"},
+	"sh":         {"sh"},
+	"shell":      {"sh"},
+	"zsh":        {"zsh"},
+	"python":     {"python3"},
+	"py":         {"python3"},
+	"go":         {"go", "run"},
+	"javascript": {"node"},
+	"js":         {"node"},
+	"ruby":       {"ruby"},
+}
+
+// Run a code block from a temporary file, echoing and returning its combined output
+func runCodeBlock(block codeBlock) (string, error) {
+	runner, ok := runners[block.lang]
+	if !ok {
+		return "", fmt.Errorf("don't know how to run %q code blocks", block.lang)
+	}
+
+	dir, err := os.MkdirTemp("", "deepseek-run-")
+	if err != nil {
+		return "", fmt.Errorf("creating temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ext := langExtensions[block.lang]
+	file := filepath.Join(dir, "main."+ext)
+	if err := os.WriteFile(file, []byte(block.content), 0600); err != nil {
+		return "", fmt.Errorf("writing temp file: %w", err)
+	}
+
+	var output bytes.Buffer
+	cmd := exec.Command(runner[0], append(runner[1:], file)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = io.MultiWriter(os.Stderr, &output)
+	cmd.Stderr = io.MultiWriter(os.Stderr, &output)
+	err = cmd.Run()
+	return output.String(), err
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Characters of context shown on each side of a match
+const SNIPPET_CONTEXT = 60
+
+func init() {
+	registerCommand(command{
+		name:  "search",
+		usage: "[-semantic] [-role r] [-since t] [-until t] [-case] <query...>  search all messages",
+		run:   runSearch,
+	})
+}
+
+// Parse a time filter: a duration back from now (such as 72h) or a date
+func parseTimeFilter(value string) (time.Time, error) {
+	if d, err := parseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateTime, time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: use a duration such as 3d or a date such as 2024-05-01", value)
+}
+
+// When a message was written, falling back to the creation of its chat
+func messageTime(msg Message, chat Chat) time.Time {
+	if msg.Time != nil {
+		return *msg.Time
+	}
+	return chat.CreatedAt
+}
+
+// Compile the search expression. A single argument is a regular expression;
+// several are words that must all appear, in any order.
+func searchPatterns(args []string, caseSensitive bool) ([]*regexp.Regexp, error) {
+	prefix := "(?i)"
+	if caseSensitive {
+		prefix = ""
+	}
+	if len(args) == 1 {
+		re, err := regexp.Compile(prefix + args[0])
+		if err != nil {
+			// Not a valid expression, search for the text as typed
+			re = regexp.MustCompile(prefix + regexp.QuoteMeta(args[0]))
+		}
+		return []*regexp.Regexp{re}, nil
+	}
+	patterns := make([]*regexp.Regexp, 0, len(args))
+	for _, word := range args {
+		patterns = append(patterns, regexp.MustCompile(prefix+regexp.QuoteMeta(word)))
+	}
+	return patterns, nil
+}
+
+// Cut a single-line excerpt of text around the match at loc, highlighting it
+// when color is set
+func snippet(text string, loc []int, color bool) string {
+	start := max(loc[0]-SNIPPET_CONTEXT, 0)
+	end := min(loc[1]+SNIPPET_CONTEXT, len(text))
+	// Avoid cutting through a multi-byte character
+	for start > 0 && !isRuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !isRuneStart(text[end]) {
+		end++
+	}
+	match := text[loc[0]:loc[1]]
+	if color {
+		match = colorize(match, "1;31")
+	}
+	s := text[start:loc[0]] + match + text[loc[1]:end]
+	s = strings.Join(strings.Fields(s), " ")
+	if start > 0 {
+		s = "…" + s
+	}
+	if end < len(text) {
+		s += "…"
+	}
+	return s
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// Role and date restrictions of a search
+type messageFilter struct {
+	role          string
+	after, before time.Time
+}
+
+func (f messageFilter) match(msg Message, chat Chat) bool {
+	if f.role != "" && msg.Role != f.role {
+		return false
+	}
+	t := messageTime(msg, chat)
+	return (f.after.IsZero() || !t.Before(f.after)) && (f.before.IsZero() || !t.After(f.before))
+}
+
+func runSearch(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	role := fs.String("role", "", "Only search messages of this role (user, assistant or system)")
+	since := fs.String("since", "", "Only messages newer than a duration (72h) or date (2024-05-01)")
+	until := fs.String("until", "", "Only messages older than a duration or date")
+	caseSensitive := fs.Bool("case", false, "Match case")
+	semantic := fs.Bool("semantic", false, "Rank chats by meaning using an embeddings endpoint")
+	limit := fs.Int("n", 10, "Number of results of a semantic search")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errors.New("usage: deepseek search [-semantic] [-role r] [-since t] [-until t] [-case] <regexp or words...>")
+	}
+	filter := messageFilter{role: *role}
+	if *since != "" {
+		if filter.after, err = parseTimeFilter(*since); err != nil {
+			return err
+		}
+	}
+	if *until != "" {
+		if filter.before, err = parseTimeFilter(*until); err != nil {
+			return err
+		}
+	}
+	if *semantic {
+		return semanticSearch(strings.Join(args, " "), filter, *limit)
+	}
+	patterns, err := searchPatterns(args, *caseSensitive)
+	if err != nil {
+		return err
+	}
+	color := isTerminal(os.Stdout)
+
+	found := 0
+	for _, chatID := range sortedChatIDs() {
+		chat, exists, err := loadChat(chatID)
+		if err != nil {
+			errorf("Error: %v\n", err)
+			continue
+		}
+		if !exists {
+			continue
+		}
+		header := false
+		for i, msg := range chat.Messages {
+			if !filter.match(msg, chat) {
+				continue
+			}
+			var loc []int
+			for _, re := range patterns {
+				if l := re.FindStringIndex(msg.Content); l == nil {
+					loc = nil
+					break
+				} else if loc == nil {
+					loc = l
+				}
+			}
+			if loc == nil {
+				continue
+			}
+			if !header {
+				printSearchHeader(chatID, chat, color)
+				header = true
+			}
+			fmt.Printf("  [%d] %-9s %s  %s\n", i, msg.Role, messageTime(msg, chat).Local().Format(time.DateTime), snippet(msg.Content, loc, color))
+			found++
+		}
+	}
+	if found == 0 {
+		infof("No matches.\n")
+	}
+	return nil
+}
+
+func printSearchHeader(chatID string, chat Chat, color bool) {
+	title := chatID
+	if color {
+		title = colorize(title, "1")
+	}
+	fmt.Printf("%s  %s\n", title, chat.CreatedAt.Local().Format(time.DateTime))
+}
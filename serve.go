@@ -0,0 +1,521 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func init() {
+	registerCommand(command{
+		name:  "serve",
+		usage: "[-listen addr] [-token t]  serve the chats over a local REST API, for editors and other tools",
+		run:   runServe,
+	})
+}
+
+// The REST API of serve
+type apiServer struct {
+	token string
+	// localHost only takes requests addressed to this machine: without a
+	// token, a web page could otherwise reach a local server through DNS
+	// rebinding
+	localHost   bool
+	proxied     proxyChats
+	generations generations
+}
+
+// A chat as listed by GET /api/chats
+type chatSummary struct {
+	ID string `json:"id"`
+	ChatMeta
+}
+
+// A chat as returned by GET /api/chats/<id>
+type chatDetail struct {
+	ID string `json:"id"`
+	Chat
+}
+
+// The body of POST /api/chats
+type newChatRequest struct {
+	Name   string `json:"name"`
+	Role   string `json:"role"`
+	System string `json:"system"`
+}
+
+// The body of POST /api/chats/<id>/messages
+type newMessageRequest struct {
+	Content     string   `json:"content"`
+	Model       string   `json:"model"`
+	Temperature *float64 `json:"temperature"`
+	// Messages of the chat sent along, 10 by default
+	Memory *int `json:"memory"`
+	// SSE unless false
+	Stream *bool `json:"stream"`
+}
+
+// The body of POST /api/prompt
+type promptRequest struct {
+	// The chat, else the last one, as the CLI's -chat and -new pick it
+	Chat string `json:"chat"`
+	New  bool   `json:"new"`
+	// The role of a new chat, or to switch the chat to
+	Role string `json:"role"`
+	newMessageRequest
+}
+
+// An error with the HTTP status to answer it with
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string { return e.err.Error() }
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	listen := fs.String("listen", "localhost:8080", "Address to listen on")
+	token := fs.String("token", "", "Bearer token every request must send")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return errors.New("usage: deepseek serve [-listen addr] [-token t]")
+	}
+	if _, err := loadAPIKey(); err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	host, _, _ := net.SplitHostPort(*listen)
+	if *token == "" && !isLoopback(host) {
+		errorf("Warning: serving %s beyond this machine without -token, anyone reaching it can use the API key\n", *listen)
+	}
+	s := &apiServer{token: *token, localHost: *token == "" && isLoopback(host)}
+	mux := http.NewServeMux()
+	s.routes(mux)
+	server := &http.Server{Handler: s.authorize(mux), ReadHeaderTimeout: 10 * time.Second}
+	infof("Serving on http://%s, Ctrl-C stops\n", listener.Addr())
+	return serveUntilDone(context.Background(), server, listener)
+}
+
+// Serve until SIGINT, SIGTERM or the end of ctx
+func serveUntilDone(ctx context.Context, server *http.Server, listener net.Listener) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		// Answers still streaming get a moment to finish and be saved
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+	err := server.Serve(listener)
+	stop()
+	<-done
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// The endpoints of the server
+func (s *apiServer) routes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/chats", s.handleChats)
+	mux.HandleFunc("/api/chats/", s.handleChat)
+	mux.HandleFunc("/api/prompt", s.handlePrompt)
+	mux.HandleFunc("/v1/chat/completions", s.handleCompletions)
+	mux.HandleFunc("/v1/models", s.handleModels)
+}
+
+// Whether host names this machine only
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Check the token, or the Host, of every request. Requests with a body
+// must be JSON, which a web page can't send to another origin without a
+// CORS preflight the server never answers.
+func (s *apiServer) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" && r.Header.Get("Authorization") != "Bearer "+s.token {
+			writeError(w, &httpError{http.StatusUnauthorized, errors.New("missing or wrong bearer token")})
+			return
+		}
+		if s.localHost {
+			host, _, err := net.SplitHostPort(r.Host)
+			if err != nil {
+				host = r.Host
+			}
+			if !isLoopback(strings.Trim(host, "[]")) {
+				writeError(w, &httpError{http.StatusForbidden, fmt.Errorf("host %s is not this machine, use localhost or -token", r.Host)})
+				return
+			}
+		}
+		if r.Method == http.MethodPost {
+			if media, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); media != "application/json" {
+				writeError(w, &httpError{http.StatusUnsupportedMediaType, errors.New("send the body as application/json")})
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Answer with {"error": ...}, a 500 unless err is an httpError
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var he *httpError
+	if errors.As(err, &he) {
+		status = he.status
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// Decode the JSON body of r into v, leaving it as is without a body
+func decodeBody(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && err != io.EOF {
+		return &httpError{http.StatusBadRequest, fmt.Errorf("parsing the body: %w", err)}
+	}
+	return nil
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	writeError(w, &httpError{http.StatusMethodNotAllowed, errors.New("use " + allowed)})
+}
+
+// The chat index as it is on disk, other invocations writing to it too
+func indexSnapshot() (map[string]ChatMeta, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if err := readIndex(); err != nil {
+		return nil, err
+	}
+	return maps.Clone(chatIndex), nil
+}
+
+// The id of the chat named by idOrName, or a 404
+func lookupChat(idOrName string) (string, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if err := readIndex(); err != nil {
+		return "", err
+	}
+	chatID := resolveChatID(idOrName)
+	if _, ok := chatIndex[chatID]; !ok {
+		return "", &httpError{http.StatusNotFound, fmt.Errorf("chat %s not found", idOrName)}
+	}
+	return chatID, nil
+}
+
+// GET lists the chats, the newest first (archived ones with ?all=1); POST
+// creates one
+func (s *apiServer) handleChats(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		index, err := indexSnapshot()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		chats := []chatSummary{}
+		for id, meta := range index {
+			if !meta.Archived || r.URL.Query().Get("all") != "" {
+				chats = append(chats, chatSummary{id, meta})
+			}
+		}
+		sort.Slice(chats, func(i, j int) bool {
+			return chats[i].UpdatedAt.After(chats[j].UpdatedAt)
+		})
+		writeJSON(w, http.StatusOK, chats)
+	case http.MethodPost:
+		var req newChatRequest
+		if err := decodeBody(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		chatID, chat, err := createChat(generateChatID(), req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, chatDetail{chatID, chat})
+	default:
+		methodNotAllowed(w, "GET, POST")
+	}
+}
+
+// Save a new chat with its system message: the role's, unless given
+func createChat(chatID string, req newChatRequest) (string, Chat, error) {
+	if err := validChatID(chatID); err != nil {
+		return "", Chat{}, &httpError{http.StatusBadRequest, err}
+	}
+	if err := validChatName(req.Name); err != nil {
+		return "", Chat{}, &httpError{http.StatusBadRequest, err}
+	}
+	role, system, err := resolveRole(req.Role)
+	if err != nil {
+		return "", Chat{}, &httpError{http.StatusBadRequest, err}
+	}
+	if req.System != "" {
+		system = req.System
+	}
+	chat := Chat{CreatedAt: time.Now(), Name: req.Name, Role: role, Messages: []Message{{Role: "system", Content: system}}}
+	err = withHistoryLock(func() error {
+		if req.Name != "" && resolveChatID(req.Name) != req.Name {
+			return &httpError{http.StatusConflict, fmt.Errorf("a chat is already named %s", req.Name)}
+		}
+		if err := writeChatFile(chatID, chat); err != nil {
+			return err
+		}
+		chatIndex[chatID] = metaFor(chat)
+		return nil
+	})
+	return chatID, chat, err
+}
+
+// GET and DELETE /api/chats/<id>, POST /api/chats/<id>/messages and GET
+// /api/chats/<id>/stream
+func (s *apiServer) handleChat(w http.ResponseWriter, r *http.Request) {
+	idOrName, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/chats/"), "/")
+	chatID, err := lookupChat(idOrName)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	switch {
+	case rest == "stream":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, "GET")
+			return
+		}
+		s.streamGeneration(w, r, chatID)
+	case rest == "messages":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, "POST")
+			return
+		}
+		var req newMessageRequest
+		if err := decodeBody(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		s.sendMessage(w, r, chatID, req, false)
+	case rest != "":
+		writeError(w, &httpError{http.StatusNotFound, fmt.Errorf("no endpoint %s", r.URL.Path)})
+	case r.Method == http.MethodGet:
+		chat, _, err := loadChat(chatID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, chatDetail{chatID, chat})
+	case r.Method == http.MethodDelete:
+		err := withHistoryLock(func() error {
+			return deleteChat(chatID)
+		})
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, "GET, DELETE")
+	}
+}
+
+// Send a prompt in the chat, streaming the answer as server-sent events
+// of -output jsonl, or answering with the stored message when stream is
+// false. The turn is saved as the CLI saves it, making the chat the last
+// one when last is set; a client going away keeps the partial answer.
+func (s *apiServer) sendMessage(w http.ResponseWriter, r *http.Request, chatID string, req newMessageRequest, last bool) {
+	if strings.TrimSpace(req.Content) == "" {
+		writeError(w, &httpError{http.StatusBadRequest, errors.New("content is empty")})
+		return
+	}
+	chat, _, err := loadChat(chatID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	memory := 10
+	if req.Memory != nil {
+		memory = *req.Memory
+	}
+	request := chatRequest{
+		ctx:         r.Context(),
+		model:       req.Model,
+		temperature: req.Temperature,
+		debug:       *debug,
+	}
+	if request.model == "" {
+		request.model = *model
+		if i := lastAnswer(chat.Messages); i >= 0 && chat.Messages[i].Model != "" {
+			request.model = chat.Messages[i].Model
+		}
+	}
+	userMessage := Message{Role: "user", Content: req.Content, Time: now()}
+	request.messages = append(memoryContext(chat, memory), userMessage)
+	if request.apiKey, err = loadAPIKey(); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	stream := req.Stream == nil || *req.Stream
+	flusher, _ := w.(http.Flusher)
+	// Clients attached to the chat follow the answer too
+	gen := s.generations.start(chatID)
+	defer s.generations.end(chatID, gen)
+	request.onEvent = gen.publish
+	finish := gen.publish
+	if stream {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		request.onEvent = func(event streamEvent) {
+			gen.publish(event)
+			writeEvent(w, flusher, event)
+		}
+		finish = request.onEvent
+	}
+	response, err := chatWithFallback(request)
+	answeredBy := request.model
+	if response.model != "" {
+		answeredBy = response.model
+	}
+	if err != nil && !(response.interrupted && (response.content != "" || response.reasoning != "")) {
+		go postWebhook(webhookSummary{ChatID: chatID, Prompt: req.Content, Model: answeredBy, Error: err.Error()})
+		finish(streamEvent{Type: "error", ChatID: chatID, Model: answeredBy, Error: err.Error(), Code: exitCode(err)})
+		if !stream {
+			writeError(w, &httpError{http.StatusBadGateway, err})
+		}
+		return
+	}
+	answer := response.message(request.model)
+	firstTurn := lastAnswer(chat.Messages) < 0
+	err = updateChat(chatID, func(stored *Chat, exists bool) {
+		if !exists {
+			*stored = chat
+		}
+		stored.Messages = append(stored.Messages, userMessage, answer)
+		if last {
+			lastChatID = chatID
+		}
+	})
+	if err != nil {
+		errorf("Error saving chat %s: %v\n", chatID, err)
+	} else if firstTurn {
+		titleInBackground(chatID)
+	}
+	go postWebhook(webhookSummary{ChatID: chatID, Prompt: req.Content, Answer: response.content, Model: answeredBy, Usage: response.usage})
+	if err != nil {
+		finish(streamEvent{Type: "error", ChatID: chatID, Model: answeredBy, Error: err.Error(), Code: exitCode(err)})
+	} else {
+		finish(streamEvent{Type: "done", ChatID: chatID, Model: answeredBy, Finish: response.finishReason})
+	}
+	switch {
+	case !stream && err != nil:
+		writeError(w, err)
+	case !stream:
+		writeJSON(w, http.StatusOK, map[string]any{"chat_id": chatID, "message": answer})
+	}
+}
+
+// POST /api/prompt: send a prompt as the CLI does, to the chat it would
+// pick, which becomes the last chat
+func (s *apiServer) handlePrompt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, "POST")
+		return
+	}
+	var req promptRequest
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		writeError(w, &httpError{http.StatusBadRequest, errors.New("content is empty")})
+		return
+	}
+	chatID, err := promptChat(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.sendMessage(w, r, chatID, req.newMessageRequest, true)
+}
+
+// The chat of a prompt: the one named, else the last one unless new, else
+// a new one, with the role given
+func promptChat(req promptRequest) (string, error) {
+	mutex.Lock()
+	err := readIndex()
+	chatID := lastChatID
+	if chatIndex[chatID].Archived || req.New {
+		chatID = ""
+	}
+	if req.Chat != "" && !req.New {
+		chatID = resolveChatID(req.Chat)
+	}
+	mutex.Unlock()
+	if err != nil {
+		return "", err
+	}
+	if chatID == "" {
+		chatID = generateChatID()
+	}
+	if err := validChatID(chatID); err != nil {
+		return "", &httpError{http.StatusBadRequest, err}
+	}
+	_, exists, err := loadChat(chatID)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		chatID, _, err = createChat(chatID, newChatRequest{Role: req.Role})
+		return chatID, err
+	}
+	if req.Role == "" {
+		return chatID, nil
+	}
+	role, system, err := resolveRole(req.Role)
+	if err != nil {
+		return "", &httpError{http.StatusBadRequest, err}
+	}
+	return chatID, updateChat(chatID, func(stored *Chat, _ bool) {
+		if stored.Role != role {
+			setSystemMessage(stored, system)
+			stored.Role = role
+		}
+	})
+}
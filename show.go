@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func init() {
+	registerCommand(command{
+		name:  "show",
+		usage: "[chat-id] [-n turns]  print a conversation",
+		run:   runShow,
+	})
+	registerCommand(command{
+		name:  "last",
+		usage: "[chat-id] [-copy]  print the latest answer again",
+		run:   runLast,
+	})
+}
+
+// Load the chat named by the only argument, or the last chat without one
+func chatFromArgs(args []string, usage string) (string, Chat, error) {
+	if len(args) > 1 {
+		return "", Chat{}, errors.New(usage)
+	}
+	chatID := lastChatID
+	if len(args) == 1 {
+		chatID = resolveChatID(args[0])
+	}
+	if chatID == "" {
+		return "", Chat{}, errors.New("no chat yet")
+	}
+	chat, exists, err := loadChat(chatID)
+	if err != nil {
+		return "", Chat{}, err
+	}
+	if !exists {
+		return "", Chat{}, fmt.Errorf("chat %s not found", chatID)
+	}
+	return chatID, chat, nil
+}
+
+// The messages of the last n turns, a turn starting at each user message
+func lastTurns(messages []Message, n int) []Message {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			if n--; n == 0 {
+				return messages[i:]
+			}
+		}
+	}
+	return messages
+}
+
+func runShow(args []string) error {
+	fs := flag.NewFlagSet("show", flag.ContinueOnError)
+	turns := fs.Int("n", 0, "Only show the last N turns")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	chatID, chat, err := chatFromArgs(args, "usage: deepseek show [chat-id] [-n turns]")
+	if err != nil {
+		return err
+	}
+	messages := chat.Messages
+	if *turns > 0 {
+		messages = lastTurns(messages, *turns)
+	}
+
+	color := isTerminal(os.Stdout)
+	var b strings.Builder
+	fmt.Fprintf(&b, "Chat %s", chatID)
+	if chat.Name != "" {
+		fmt.Fprintf(&b, " %q", chat.Name)
+	}
+	if chat.Role != "" {
+		fmt.Fprintf(&b, " (role %s)", chat.Role)
+	}
+	b.WriteString("\n")
+	offset := len(chat.Messages) - len(messages)
+	for i, msg := range messages {
+		if msg.Role == "" {
+			continue
+		}
+		title := fmt.Sprintf("── [%d] %s ──", offset+i, messageTitle(msg))
+		content := strings.TrimRight(msg.Content, "\n")
+		if color {
+			title = colorize(title, colors.role(msg.Role))
+			content = colorizeCode(content, colors.code)
+		}
+		fmt.Fprintf(&b, "\n%s\n%s\n", title, content)
+	}
+	text := b.String()
+
+	if color {
+		width, height, _ := terminalSize(os.Stdout)
+		if displayRows(text, width) > height {
+			return page(text)
+		}
+	}
+	fmt.Print(text)
+	return nil
+}
+
+func runLast(args []string) error {
+	fs := flag.NewFlagSet("last", flag.ContinueOnError)
+	copyAnswer := fs.Bool("copy", false, "Also copy the answer to the clipboard")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	chatID, chat, err := chatFromArgs(args, "usage: deepseek last [chat-id] [-copy]")
+	if err != nil {
+		return err
+	}
+	for i := len(chat.Messages) - 1; i >= 0; i-- {
+		msg := chat.Messages[i]
+		if msg.Role != "assistant" {
+			continue
+		}
+		fmt.Println(strings.TrimRight(msg.Content, "\n"))
+		if *copyAnswer {
+			if err := copyToClipboard(msg.Content); err != nil {
+				return fmt.Errorf("copying to clipboard: %w", err)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("chat %s has no answer yet", chatID)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const SNIPPETS_FILE = "snippets.json"
+
+func init() {
+	registerCommand(command{
+		name:  "snippets",
+		usage: "add <name> [text] | list | rm <name> | use <name>...",
+		run:   runSnippets,
+	})
+}
+
+func loadSnippets() (map[string]string, error) {
+	return loadStore(SNIPPETS_FILE)
+}
+
+func saveSnippets(snippets map[string]string) error {
+	return saveStore(SNIPPETS_FILE, snippets)
+}
+
+// Join the named snippets, in order, into a single block of text
+func expandSnippets(names []string) (string, error) {
+	snippets, err := loadSnippets()
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		text, ok := snippets[name]
+		if !ok {
+			return "", fmt.Errorf("snippet %q not found", name)
+		}
+		parts = append(parts, text)
+	}
+	return strings.Join(parts, "\n"), nil
+}
+
+func runSnippets(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: deepseek snippets add|list|rm|use")
+	}
+
+	switch args[0] {
+	case "add":
+		if len(args) < 2 {
+			return errors.New("usage: deepseek snippets add <name> [text]")
+		}
+		text := strings.Join(args[2:], " ")
+		if text == "" {
+			// Read the snippet from stdin when no text is given
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return fmt.Errorf("reading stdin: %w", err)
+			}
+			text = strings.TrimSpace(string(data))
+		}
+		if text == "" {
+			return errors.New("snippet text is empty")
+		}
+		snippets, err := loadSnippets()
+		if err != nil {
+			return err
+		}
+		snippets[args[1]] = text
+		if err := saveSnippets(snippets); err != nil {
+			return err
+		}
+		infof("Snippet %s saved.\n", args[1])
+
+	case "list", "ls":
+		snippets, err := loadSnippets()
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(snippets))
+		for name := range snippets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			preview := truncateWidth(strings.ReplaceAll(snippets[name], "\n", " "), 60)
+			fmt.Printf("%-20s %s\n", name, preview)
+		}
+
+	case "rm":
+		if len(args) < 2 {
+			return errors.New("usage: deepseek snippets rm <name>")
+		}
+		snippets, err := loadSnippets()
+		if err != nil {
+			return err
+		}
+		for _, name := range args[1:] {
+			if _, ok := snippets[name]; !ok {
+				return fmt.Errorf("snippet %q not found", name)
+			}
+			delete(snippets, name)
+			infof("Snippet %s removed.\n", name)
+		}
+		return saveSnippets(snippets)
+
+	case "use":
+		if len(args) < 2 {
+			return errors.New("usage: deepseek snippets use <name>...")
+		}
+		text, err := expandSnippets(args[1:])
+		if err != nil {
+			return err
+		}
+		fmt.Println(text)
+
+	default:
+		return fmt.Errorf("unknown snippets command: %s", args[0])
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Longest line of a stream, far above any answer chunk or tool call, to
+// keep a broken server from exhausting memory
+const MAX_LINE = 64 << 20
+
+// Reads the events of a server-sent event stream, where each line may be
+// as long as MAX_LINE, unlike with bufio.Scanner
+type sseReader struct {
+	r *bufio.Reader
+	// onLine, when set, receives every line as read
+	onLine func(line string)
+}
+
+func newSSEReader(r io.Reader, onLine func(string)) *sseReader {
+	return &sseReader{r: bufio.NewReaderSize(r, 64*1024), onLine: onLine}
+}
+
+// The data of the next event, the data lines of a multi-line event joined
+// by newlines; io.EOF at the end of the stream
+func (s *sseReader) next() (string, error) {
+	var data []string
+	for {
+		line, err := readLine(s.r)
+		if err == io.EOF && line == "" {
+			if len(data) > 0 {
+				return strings.Join(data, "\n"), nil
+			}
+			return "", io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		if s.onLine != nil {
+			s.onLine(line)
+		}
+		switch {
+		case line == "":
+			// A blank line ends the event
+			if len(data) > 0 {
+				return strings.Join(data, "\n"), nil
+			}
+		case strings.HasPrefix(line, ":"):
+			// A comment, such as a keep-alive
+		default:
+			field, value, _ := strings.Cut(line, ":")
+			if field == "data" {
+				data = append(data, strings.TrimPrefix(value, " "))
+			}
+		}
+		if err == io.EOF {
+			return strings.Join(data, "\n"), nil
+		}
+	}
+}
+
+// Read a line of any length up to MAX_LINE, without its line ending. At the
+// end of the stream it returns the last, unterminated line with io.EOF.
+func readLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > MAX_LINE {
+			return "", fmt.Errorf("line longer than %d MB", MAX_LINE>>20)
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		return strings.TrimRight(string(line), "\r\n"), err
+	}
+}
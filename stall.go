@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// -stall-timeout: how long a stream may go without any data, keep-alive
+// comments included, before it is given up; 0 for no limit
+var stallTimeout = time.Minute
+
+var errStalled = errors.New("stream stalled")
+
+// A response body failing with errStalled once no data arrived for a while
+type stallReader struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	stalled atomic.Bool
+}
+
+// Watch body for stalls of -stall-timeout, unless it is 0
+func watchStall(body io.ReadCloser) io.ReadCloser {
+	if stallTimeout <= 0 {
+		return body
+	}
+	s := &stallReader{body: body, timeout: stallTimeout}
+	// Closing the body unblocks the pending Read
+	s.timer = time.AfterFunc(stallTimeout, func() {
+		s.stalled.Store(true)
+		body.Close()
+	})
+	return s
+}
+
+func (s *stallReader) Read(p []byte) (int, error) {
+	n, err := s.body.Read(p)
+	if s.stalled.Load() {
+		return n, fmt.Errorf("%w: no data for %s (-stall-timeout, 0 to wait forever)", errStalled, s.timeout)
+	}
+	if n > 0 {
+		s.timer.Reset(s.timeout)
+	}
+	return n, err
+}
+
+func (s *stallReader) Close() error {
+	s.timer.Stop()
+	return s.body.Close()
+}
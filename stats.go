@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// USD per million tokens, from the DeepSeek pricing page
+type modelPrice struct {
+	cacheHit  float64
+	cacheMiss float64
+	output    float64
+}
+
+var prices = map[string]modelPrice{
+	"deepseek-chat":     {cacheHit: 0.028, cacheMiss: 0.28, output: 0.42},
+	"deepseek-reasoner": {cacheHit: 0.028, cacheMiss: 0.28, output: 0.42},
+}
+
+// The estimated cost of one answer in USD, zero for models without a known price
+func estimateCost(model string, usage *Usage) float64 {
+	price, ok := prices[model]
+	if !ok || usage == nil {
+		return 0
+	}
+	miss := usage.PromptTokens - usage.PromptCacheHitTokens
+	return (float64(usage.PromptCacheHitTokens)*price.cacheHit +
+		float64(miss)*price.cacheMiss +
+		float64(usage.CompletionTokens)*price.output) / 1e6
+}
+
+func init() {
+	registerCommand(command{
+		name:  "stats",
+		usage: "[-days N] [-n N] [-json]  message counts, token usage, estimated cost and daily activity",
+		run:   runStats,
+	})
+}
+
+// Counters aggregated over a set of messages
+type usageTotals struct {
+	Messages         int     `json:"messages"`
+	Answers          int     `json:"answers"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Cost             float64 `json:"estimated_cost_usd"`
+}
+
+func (t *usageTotals) add(msg Message) {
+	t.Messages++
+	if msg.Role != "assistant" {
+		return
+	}
+	t.Answers++
+	if msg.Usage != nil {
+		t.PromptTokens += msg.Usage.PromptTokens
+		t.CompletionTokens += msg.Usage.CompletionTokens
+		t.Cost += estimateCost(msg.Model, msg.Usage)
+	}
+}
+
+type chatStats struct {
+	ID    string `json:"id"`
+	Title string `json:"title,omitempty"`
+	usageTotals
+}
+
+type dayStats struct {
+	Date     string `json:"date"`
+	Messages int    `json:"messages"`
+	Tokens   int    `json:"tokens"`
+}
+
+type statsReport struct {
+	Chats  int                     `json:"chats"`
+	Totals usageTotals             `json:"totals"`
+	Models map[string]*usageTotals `json:"models"`
+	Top    []chatStats             `json:"top_chats"`
+	Daily  []dayStats              `json:"daily"`
+}
+
+func runStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	days := fs.Int("days", 30, "Number of days in the activity histogram")
+	top := fs.Int("n", 10, "Number of chats in the per-chat table")
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 || *days < 0 || *top < 0 {
+		return errors.New("usage: deepseek stats [-days N] [-n N] [-json]")
+	}
+
+	report, err := collectStats(*days, *top)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	printStatsReport(report)
+	return nil
+}
+
+// Aggregate every user and assistant message of the history. Messages
+// without a timestamp count on the day their chat was created.
+func collectStats(days, top int) (statsReport, error) {
+	report := statsReport{Models: make(map[string]*usageTotals)}
+	start := time.Now().Local().AddDate(0, 0, -days+1)
+	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.Local)
+	daily := make([]dayStats, days)
+	dayIndex := make(map[string]int, days)
+	for i := range daily {
+		daily[i].Date = start.AddDate(0, 0, i).Format(time.DateOnly)
+		dayIndex[daily[i].Date] = i
+	}
+
+	var chats []chatStats
+	for id, meta := range chatIndex {
+		chat, exists, err := loadChat(id)
+		if err != nil {
+			return report, err
+		}
+		if !exists {
+			continue
+		}
+		report.Chats++
+		cs := chatStats{ID: id, Title: meta.Title}
+		for _, msg := range chat.Messages {
+			if msg.Role == "system" {
+				continue
+			}
+			cs.add(msg)
+			report.Totals.add(msg)
+			if msg.Role == "assistant" {
+				model := msg.Model
+				if model == "" {
+					model = "unknown"
+				}
+				if report.Models[model] == nil {
+					report.Models[model] = &usageTotals{}
+				}
+				report.Models[model].add(msg)
+			}
+			if day, ok := dayIndex[messageTime(msg, chat).Local().Format(time.DateOnly)]; ok {
+				daily[day].Messages++
+				if msg.Usage != nil {
+					daily[day].Tokens += msg.Usage.TotalTokens
+				}
+			}
+		}
+		chats = append(chats, cs)
+	}
+
+	sort.Slice(chats, func(i, j int) bool {
+		a, b := chats[i], chats[j]
+		if ta, tb := a.PromptTokens+a.CompletionTokens, b.PromptTokens+b.CompletionTokens; ta != tb {
+			return ta > tb
+		}
+		return a.Messages > b.Messages
+	})
+	if len(chats) > top {
+		chats = chats[:top]
+	}
+	report.Top = chats
+	report.Daily = daily
+	return report, nil
+}
+
+func printStatsReport(r statsReport) {
+	row := func(name string, t usageTotals) {
+		fmt.Printf("%-24s %8d %8d %12d %12d %10s\n", name, t.Messages, t.Answers, t.PromptTokens, t.CompletionTokens, fmt.Sprintf("$%.4f", t.Cost))
+	}
+	header := func(name string) {
+		fmt.Printf("%-24s %8s %8s %12s %12s %10s\n", name, "MESSAGES", "ANSWERS", "PROMPT", "COMPLETION", "COST")
+	}
+
+	fmt.Printf("%d chat(s)\n\n", r.Chats)
+	header("MODEL")
+	models := make([]string, 0, len(r.Models))
+	for model := range r.Models {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	for _, model := range models {
+		row(model, *r.Models[model])
+	}
+	row("total", r.Totals)
+
+	if len(r.Top) > 0 {
+		fmt.Println()
+		header("CHAT")
+		for _, c := range r.Top {
+			name := c.ID
+			if c.Title != "" {
+				name = summarize(c.Title, 24)
+			}
+			row(name, c.usageTotals)
+		}
+	}
+
+	if len(r.Daily) > 0 {
+		fmt.Println()
+		most := 0
+		for _, d := range r.Daily {
+			most = max(most, d.Messages)
+		}
+		for _, d := range r.Daily {
+			bar := 0
+			if most > 0 {
+				bar = (d.Messages*40 + most - 1) / most
+			}
+			fmt.Printf("%s %5d %s\n", d.Date, d.Messages, strings.Repeat("█", bar))
+		}
+	}
+	infof("\nCosts are estimates from list prices and ignore discounts.\n")
+}
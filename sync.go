@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Files of the data directory that are not synced: the index is rebuilt
+// from the chat files and keeps the per-machine last chat
+const SYNC_GITIGNORE = `index.json
+index.json.bak
+lock
+embeddings.json
+remote.json
+keys.json
+keys.json.lock
+ratelimit.json
+ratelimit.json.lock
+balance.json
+spend.json
+spend.json.lock
+queue.json
+queue.json.lock
+jobs/
+prompt_history
+daemon.log
+daemon.sock
+models.json
+backups/
+rotated/
+*.bak
+*.tmp
+`
+
+func init() {
+	registerCommand(command{
+		name:  "sync",
+		usage: "[init [remote-url] | -pull | -push]  version the history with git and sync it with a remote",
+		run:   runSync,
+	})
+}
+
+// Whether the history directory is a git repository set up by `sync init`
+func syncEnabled() bool {
+	if historyDir == "" {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(historyDir, ".git"))
+	return err == nil
+}
+
+// Run git in the history directory, returning its output without the
+// final newline
+func gitHistory(args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", historyDir}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = strings.TrimSpace(stdout.String())
+		}
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, msg)
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
+
+// Commit every pending change of the history, naming the chats touched.
+// The caller holds the history lock.
+func commitHistory() error {
+	status, err := gitHistory("status", "--porcelain", "-uall")
+	if err != nil || status == "" {
+		return err
+	}
+	var chats []string
+	for _, line := range strings.Split(status, "\n") {
+		name := strings.Trim(strings.TrimSpace(line[min(3, len(line)):]), `"`)
+		if dir, file := filepath.Split(filepath.FromSlash(name)); filepath.Clean(dir) == CHATS_DIR && file != "" {
+			chats = append(chats, strings.TrimSuffix(file, ".json"))
+		}
+	}
+	message := "Update history"
+	switch {
+	case len(chats) > 3:
+		message = fmt.Sprintf("Update %d chats", len(chats))
+	case len(chats) > 0:
+		message = "Update " + strings.Join(chats, ", ")
+	}
+	if _, err := gitHistory("add", "-A"); err != nil {
+		return err
+	}
+	_, err = gitHistory("commit", "-q", "--no-verify", "-m", message)
+	return err
+}
+
+func runSync(args []string) error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return errors.New("sync needs git in PATH")
+	}
+	if len(args) > 0 && args[0] == "init" {
+		if len(args) > 2 {
+			return errors.New("usage: deepseek sync init [remote-url]")
+		}
+		remote := ""
+		if len(args) == 2 {
+			remote = args[1]
+		}
+		return syncInit(remote)
+	}
+
+	pull, push := true, true
+	switch {
+	case len(args) == 1 && args[0] == "-pull":
+		push = false
+	case len(args) == 1 && args[0] == "-push":
+		pull = false
+	case len(args) > 0:
+		return errors.New("usage: deepseek sync [init [remote-url] | -pull | -push]")
+	}
+	if !syncEnabled() {
+		return errors.New("history is not versioned, run `deepseek sync init [remote-url]` first")
+	}
+	remote, _ := gitHistory("remote")
+	if remote == "" {
+		return errors.New("no remote configured, add one with `git -C " + historyDir + " remote add origin <url>`")
+	}
+
+	branch, err := gitHistory("symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		return err
+	}
+	// Nothing to pull before the first push
+	if heads, err := gitHistory("ls-remote", "--heads", "origin", branch); err != nil {
+		return err
+	} else if heads == "" {
+		pull = false
+	}
+	if pull {
+		err := withHistoryLock(func() error {
+			if err := commitHistory(); err != nil {
+				return err
+			}
+			if _, err := gitHistory("pull", "--no-rebase", "--no-edit", "-q", "origin", branch); err != nil {
+				conflicts, _ := gitHistory("diff", "--name-only", "--diff-filter=U")
+				if conflicts == "" {
+					return err
+				}
+				if err := mergeGitConflicts(strings.Split(conflicts, "\n")); err != nil {
+					gitHistory("merge", "--abort")
+					return fmt.Errorf("%w; nothing was merged, resolve it with git in %s", err, historyDir)
+				}
+			}
+			return reindexChats()
+		})
+		if err != nil {
+			return err
+		}
+		infof("Pulled history from %s.\n", remote)
+	}
+	if push {
+		if _, err := gitHistory("push", "-q", "-u", "origin", branch); err != nil {
+			return err
+		}
+		infof("Pushed history to %s.\n", remote)
+	}
+	return nil
+}
+
+// Make the history directory a git repository, committing the current
+// history, and add the remote when given
+func syncInit(remote string) error {
+	if !syncEnabled() {
+		if _, err := gitHistory("init", "-q"); err != nil {
+			return err
+		}
+	}
+	if err := writeFileAtomic(filepath.Join(historyDir, ".gitignore"), []byte(SYNC_GITIGNORE), 0600); err != nil {
+		return err
+	}
+	if remote != "" {
+		if _, err := gitHistory("remote", "add", "origin", remote); err != nil {
+			return err
+		}
+	}
+	if err := withHistoryLock(commitHistory); err != nil {
+		return err
+	}
+	infof("History in %s is now versioned with git; every change is committed.\n", historyDir)
+	if remote != "" {
+		infof("Run `deepseek sync` to pull and push it.\n")
+	}
+	return nil
+}
+
+// Bring the index in line with the chat files after they changed behind
+// its back: entries of removed chats go, new and modified chats are
+// described again. The caller holds the history lock.
+func reindexChats() error {
+	entries, err := os.ReadDir(filepath.Join(historyDir, CHATS_DIR))
+	if err != nil {
+		return err
+	}
+	present := make(map[string]bool)
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		present[id] = true
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if meta, ok := chatIndex[id]; ok && !info.ModTime().After(meta.UpdatedAt) {
+			continue
+		}
+		chat, _, err := loadChat(id)
+		if err != nil {
+			return err
+		}
+		// Order pulled chats by when they were last used, not by when
+		// they reached this machine
+		meta := metaFor(chat)
+		meta.UpdatedAt = chat.CreatedAt
+		for _, msg := range chat.Messages {
+			if msg.Time != nil && msg.Time.After(meta.UpdatedAt) {
+				meta.UpdatedAt = *msg.Time
+			}
+		}
+		chatIndex[id] = meta
+	}
+	for id := range chatIndex {
+		if !present[id] {
+			delete(chatIndex, id)
+		}
+	}
+	if _, ok := chatIndex[lastChatID]; !ok {
+		lastChatID = latestActiveChat()
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Combine two versions of a chat changed on different machines. Messages
+// both versions share are kept once; when only one version added messages
+// after them, those are appended. When both did, the conversation forked
+// and resolveConflict decides. The second result, when not nil, is a copy
+// to store as a new chat.
+func mergeChatVersions(chatID string, local, remote Chat) (Chat, *Chat) {
+	merged := local
+	merged.Tags = append([]string(nil), local.Tags...)
+	for _, tag := range remote.Tags {
+		if !hasTag(merged.Tags, tag) {
+			merged.Tags = append(merged.Tags, tag)
+		}
+	}
+	if merged.Name == "" {
+		merged.Name = remote.Name
+	}
+	if merged.Title == "" {
+		merged.Title = remote.Title
+	}
+	merged.Pinned = local.Pinned || remote.Pinned
+	if remote.CreatedAt.Before(merged.CreatedAt) && !remote.CreatedAt.IsZero() {
+		merged.CreatedAt = remote.CreatedAt
+	}
+
+	common := 0
+	for common < len(local.Messages) && common < len(remote.Messages) && sameMessage(local.Messages[common], remote.Messages[common]) {
+		common++
+	}
+	localTail, remoteTail := local.Messages[common:], remote.Messages[common:]
+	switch {
+	case len(remoteTail) == 0:
+		return merged, nil
+	case len(localTail) == 0:
+		merged.Messages = remote.Messages
+		return merged, nil
+	}
+	return resolveConflict(chatID, merged, common, remote)
+}
+
+// Whether two messages are the same message of a conversation, ignoring
+// the bookkeeping that may differ between machines
+func sameMessage(a, b Message) bool {
+	return a.Role == b.Role && a.Content == b.Content
+}
+
+// Settle a chat that gained different messages on each machine after its
+// first common messages. On a terminal the user picks; otherwise, and with
+// -yes, the remote continuation is kept as a new chat so nothing is lost.
+func resolveConflict(chatID string, local Chat, common int, remote Chat) (Chat, *Chat) {
+	fork := func() (Chat, *Chat) {
+		copied := remote
+		copied.Name = ""
+		copied.Archived = false
+		if copied.Title != "" {
+			copied.Title += " (other machine)"
+		}
+		return local, &copied
+	}
+	interactive := isTerminal(os.Stdin) && isTerminal(os.Stderr) && (assumeYes == nil || !*assumeYes)
+	if !interactive {
+		return fork()
+	}
+
+	errorf("\nChat %s was continued differently on two machines after message %d.\n", chatID, common-1)
+	for _, side := range []struct {
+		label    string
+		messages []Message
+	}{{"This machine", local.Messages[common:]}, {"Other machine", remote.Messages[common:]}} {
+		errorf("── %s ──\n", side.label)
+		for i, msg := range side.messages {
+			errorf("  [%d] %s: %s\n", common+i, msg.Role, summarize(msg.Content, 70))
+		}
+	}
+	for {
+		errorf("Keep [l]ocal, [r]emote, [b]oth interleaved by time, or [f]ork the remote one into a new chat? [f] ")
+		answer, err := stdinReader.ReadString('\n')
+		if err != nil {
+			errorf("\n")
+			return fork()
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "l", "local":
+			return local, nil
+		case "r", "remote":
+			local.Messages = remote.Messages
+			return local, nil
+		case "b", "both":
+			tail := append(append([]Message(nil), local.Messages[common:]...), remote.Messages[common:]...)
+			sort.SliceStable(tail, func(i, j int) bool {
+				return messageTime(tail[i], local).Before(messageTime(tail[j], local))
+			})
+			local.Messages = append(local.Messages[:common:common], tail...)
+			return local, nil
+		case "", "f", "fork":
+			return fork()
+		}
+	}
+}
+
+// Store a chat split off by a conflict under a new ID. The caller holds
+// the history lock.
+func saveForkedChat(chatID string, chat Chat) error {
+	id := generateChatID()
+	if err := writeChatFile(id, chat); err != nil {
+		return err
+	}
+	chatIndex[id] = metaFor(chat)
+	infof("Kept the other machine's version of %s as %s\n", chatID, id)
+	return nil
+}
+
+// Settle the conflicts of an interrupted git pull by merging each
+// conflicting chat, then conclude the merge. Files other than chats can't
+// be merged. The caller holds the history lock, which stays held while the
+// user resolves conflicts since the merge is in progress in the directory.
+func mergeGitConflicts(conflicts []string) error {
+	for _, file := range conflicts {
+		if !strings.HasPrefix(file, CHATS_DIR+"/") || !strings.HasSuffix(file, ".json") {
+			return fmt.Errorf("conflicting changes to %s", file)
+		}
+	}
+	for _, file := range conflicts {
+		chatID := strings.TrimSuffix(strings.TrimPrefix(file, CHATS_DIR+"/"), ".json")
+		ours, oursErr := gitHistory("show", ":2:"+file)
+		theirs, theirsErr := gitHistory("show", ":3:"+file)
+		var merged Chat
+		var forked *Chat
+		switch {
+		case oursErr != nil && theirsErr != nil:
+			return fmt.Errorf("reading both versions of %s: %v", file, oursErr)
+		case oursErr != nil || theirsErr != nil:
+			// Removed on one side and changed on the other: keep the change
+			data := ours
+			if oursErr != nil {
+				data = theirs
+			}
+			if err := json.Unmarshal([]byte(data), &merged); err != nil {
+				return fmt.Errorf("parsing %s: %w", file, err)
+			}
+		default:
+			var local, remote Chat
+			if err := json.Unmarshal([]byte(ours), &local); err != nil {
+				return fmt.Errorf("parsing %s: %w", file, err)
+			}
+			if err := json.Unmarshal([]byte(theirs), &remote); err != nil {
+				return fmt.Errorf("parsing %s: %w", file, err)
+			}
+			merged, forked = mergeChatVersions(chatID, local, remote)
+		}
+		if err := writeChatFile(chatID, merged); err != nil {
+			return err
+		}
+		if forked != nil {
+			if err := saveForkedChat(chatID, *forked); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := gitHistory("add", "-A"); err != nil {
+		return err
+	}
+	_, err := gitHistory("commit", "-q", "--no-verify", "--no-edit")
+	return err
+}
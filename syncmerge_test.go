@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMergeChatVersions(t *testing.T) {
+	// Forks are kept without asking
+	yes := true
+	saved := assumeYes
+	assumeYes = &yes
+	defer func() { assumeYes = saved }()
+
+	msgs := func(contents ...string) []Message {
+		var messages []Message
+		for i, content := range contents {
+			role := "user"
+			if i%2 == 0 {
+				role = "assistant"
+			}
+			if i == 0 {
+				role = "system"
+			}
+			messages = append(messages, Message{Role: role, Content: content})
+		}
+		return messages
+	}
+	early := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	late := early.Add(time.Hour)
+
+	tests := []struct {
+		name         string
+		local        Chat
+		remote       Chat
+		wantMessages []Message
+		wantFork     []Message
+	}{
+		{
+			name:         "same conversation",
+			local:        Chat{Messages: msgs("s", "q")},
+			remote:       Chat{Messages: msgs("s", "q")},
+			wantMessages: msgs("s", "q"),
+		},
+		{
+			name:         "continued remotely",
+			local:        Chat{Messages: msgs("s", "q")},
+			remote:       Chat{Messages: msgs("s", "q", "a", "q2")},
+			wantMessages: msgs("s", "q", "a", "q2"),
+		},
+		{
+			name:         "continued locally",
+			local:        Chat{Messages: msgs("s", "q", "a")},
+			remote:       Chat{Messages: msgs("s", "q")},
+			wantMessages: msgs("s", "q", "a"),
+		},
+		{
+			name:         "continued on both",
+			local:        Chat{Messages: msgs("s", "q", "local")},
+			remote:       Chat{Messages: msgs("s", "q", "remote")},
+			wantMessages: msgs("s", "q", "local"),
+			wantFork:     msgs("s", "q", "remote"),
+		},
+	}
+	for _, tt := range tests {
+		merged, fork := mergeChatVersions("abc", tt.local, tt.remote)
+		if !reflect.DeepEqual(merged.Messages, tt.wantMessages) {
+			t.Errorf("%s: messages = %v, want %v", tt.name, merged.Messages, tt.wantMessages)
+		}
+		switch {
+		case tt.wantFork == nil && fork != nil:
+			t.Errorf("%s: unexpected fork %v", tt.name, fork.Messages)
+		case tt.wantFork != nil && (fork == nil || !reflect.DeepEqual(fork.Messages, tt.wantFork)):
+			t.Errorf("%s: fork = %v, want %v", tt.name, fork, tt.wantFork)
+		}
+	}
+
+	// Metadata of both sides is combined
+	local := Chat{CreatedAt: late, Tags: []string{"a"}, Messages: msgs("s")}
+	remote := Chat{CreatedAt: early, Name: "named", Title: "Title", Pinned: true, Tags: []string{"a", "b"}, Messages: msgs("s")}
+	merged, _ := mergeChatVersions("abc", local, remote)
+	if merged.Name != "named" || merged.Title != "Title" || !merged.Pinned || !merged.CreatedAt.Equal(early) || !reflect.DeepEqual(merged.Tags, []string{"a", "b"}) {
+		t.Errorf("merged metadata = %+v", merged)
+	}
+
+	// The fork of a named, archived chat is neither
+	_, fork := mergeChatVersions("abc",
+		Chat{Messages: msgs("s", "q", "local")},
+		Chat{Name: "n", Title: "T", Archived: true, Messages: msgs("s", "q", "remote")})
+	if fork == nil || fork.Name != "" || fork.Archived || fork.Title != "T (other machine)" {
+		t.Errorf("fork = %+v", fork)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+func init() {
+	registerCommand(command{
+		name:  "tag",
+		usage: "<chat-id> [tag,...] [-d]  add, remove (-d) or show the tags of a chat",
+		run:   runTag,
+	})
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Split a comma-separated list of tags, dropping blanks
+func parseTags(list string) []string {
+	var tags []string
+	for _, tag := range strings.Split(list, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func runTag(args []string) error {
+	fs := flag.NewFlagSet("tag", flag.ContinueOnError)
+	remove := fs.Bool("d", false, "Remove the given tags instead of adding them")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New("usage: deepseek tag <chat-id> [tag,...] [-d]")
+	}
+	chatID := resolveChatID(args[0])
+	meta, ok := chatIndex[chatID]
+	if !ok {
+		return fmt.Errorf("chat %s not found", args[0])
+	}
+	if len(args) == 1 {
+		if len(meta.Tags) > 0 {
+			fmt.Println(strings.Join(meta.Tags, ","))
+		}
+		return nil
+	}
+
+	changes := parseTags(args[1])
+	var tags []string
+	err = updateChat(chatID, func(chat *Chat, _ bool) {
+		if *remove {
+			kept := chat.Tags[:0]
+			for _, tag := range chat.Tags {
+				if !hasTag(changes, tag) {
+					kept = append(kept, tag)
+				}
+			}
+			chat.Tags = kept
+		} else {
+			for _, tag := range changes {
+				if !hasTag(chat.Tags, tag) {
+					chat.Tags = append(chat.Tags, tag)
+				}
+			}
+		}
+		sort.Strings(chat.Tags)
+		if len(chat.Tags) == 0 {
+			chat.Tags = nil
+		}
+		tags = chat.Tags
+	})
+	if err != nil {
+		return err
+	}
+	infof("Chat %s tags: %s\n", chatID, strings.Join(tags, ","))
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Report whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Terminal size from $COLUMNS and $LINES, for platforms without an ioctl
+func envTerminalSize() (int, int, bool) {
+	cols, err1 := strconv.Atoi(os.Getenv("COLUMNS"))
+	rows, err2 := strconv.Atoi(os.Getenv("LINES"))
+	if err1 != nil || err2 != nil || cols <= 0 || rows <= 0 {
+		return 80, 24, false
+	}
+	return cols, rows, true
+}
+
+// Number of terminal rows text occupies at the given width
+func displayRows(text string, width int) int {
+	rows := 0
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		n := displayWidth(line)
+		rows += 1 + max(n-1, 0)/max(width, 1)
+	}
+	return rows
+}
+
+// Show text through $PAGER (less -R by default)
+func page(text string) error {
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = "less -R"
+	}
+	fields := strings.Fields(pager)
+	cmd := exec.Command(fields[0], fields[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// Let the user edit text in $VISUAL or $EDITOR and return the result
+func editText(text, suffix string) (string, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+	f, err := os.CreateTemp("", "deepseek-*"+suffix)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(text); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	fields := strings.Fields(editor)
+	cmd := exec.Command(fields[0], append(fields[1:], f.Name())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("running %s: %w", editor, err)
+	}
+	data, err := os.ReadFile(f.Name())
+	return string(data), err
+}
@@ -0,0 +1,15 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package main
+
+import "os"
+
+// Return the width and height of the terminal attached to f
+func terminalSize(f *os.File) (int, int, bool) {
+	return envTerminalSize()
+}
+
+// Resize notifications are not available on this platform
+func watchResize(f *os.File, fn func(width int)) func() {
+	return func() {}
+}
@@ -0,0 +1,37 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+type winsize struct {
+	rows, cols, xpixel, ypixel uint16
+}
+
+// Return the width and height of the terminal attached to f
+func terminalSize(f *os.File) (int, int, bool) {
+	var ws winsize
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 || ws.cols == 0 {
+		return envTerminalSize()
+	}
+	return int(ws.cols), int(ws.rows), true
+}
+
+// Call fn with the new width whenever the terminal attached to f is resized
+func watchResize(f *os.File, fn func(width int)) func() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGWINCH)
+	go func() {
+		for range ch {
+			width, _, _ := terminalSize(f)
+			fn(width)
+		}
+	}()
+	return func() { signal.Stop(ch) }
+}
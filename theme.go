@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The theme used without -theme or a [theme] table
+const DEFAULT_THEME = "dark"
+
+// Colors of the output, as SGR parameters such as "1;36"
+type theme struct {
+	// The user's messages and the REPL prompt
+	prompt    string
+	assistant string
+	// The chain of thought of reasoning models
+	reasoning string
+	// Fenced code blocks
+	code string
+}
+
+var themes = map[string]theme{
+	"dark":      {prompt: "1;36", assistant: "1", reasoning: "2", code: "33"},
+	"light":     {prompt: "1;34", assistant: "1", reasoning: "2;3", code: "35"},
+	"solarized": {prompt: "1;38;5;37", assistant: "1;38;5;33", reasoning: "38;5;245", code: "38;5;136"},
+}
+
+var (
+	// -theme: the built-in theme to start from
+	themeName string
+	// The theme in use, set by loadTheme
+	colors = themes[DEFAULT_THEME]
+)
+
+// SGR parameters of the style words parseStyle accepts
+var styleWords = map[string]string{
+	"bold": "1", "dim": "2", "italic": "3", "underline": "4", "reverse": "7",
+	"black": "30", "red": "31", "green": "32", "yellow": "33",
+	"blue": "34", "magenta": "35", "cyan": "36", "white": "37",
+}
+
+// Set colors from -theme or theme.name, with the colors of the [theme]
+// table of the config file on top:
+//
+//	[theme]
+//	name = "solarized"
+//	prompt = "bold #2aa198"
+//	reasoning = "dim italic"
+//	code = "yellow"
+func loadTheme() error {
+	name := themeName
+	if value, ok := configValues["theme.name"]; ok && name == "" {
+		name = configString(value)
+	}
+	if name == "" {
+		name = DEFAULT_THEME
+	}
+	t, ok := themes[name]
+	if !ok {
+		names := make([]string, 0, len(themes))
+		for name := range themes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown theme %q, use one of %s", name, strings.Join(names, ", "))
+	}
+	fields := map[string]*string{"prompt": &t.prompt, "assistant": &t.assistant, "reasoning": &t.reasoning, "code": &t.code}
+	for key, value := range configValues {
+		field, ok := strings.CutPrefix(key, "theme.")
+		if !ok || field == "name" {
+			continue
+		}
+		target, ok := fields[field]
+		if !ok {
+			errorf("Warning: unknown theme setting %q, use prompt, assistant, reasoning or code\n", field)
+			continue
+		}
+		style, err := parseStyle(configString(value))
+		if err != nil {
+			return fmt.Errorf("theme.%s: %w", field, err)
+		}
+		*target = style
+	}
+	colors = t
+	return nil
+}
+
+// Turn a style such as "bold cyan", "dim", "#268bd2", "bright-blue" or
+// "38;5;33" into SGR parameters
+func parseStyle(style string) (string, error) {
+	var codes []string
+	for _, word := range strings.Fields(strings.ToLower(style)) {
+		switch {
+		case styleWords[word] != "":
+			codes = append(codes, styleWords[word])
+		case strings.HasPrefix(word, "bright-") && styleWords[word[len("bright-"):]] != "":
+			code, _ := strconv.Atoi(styleWords[word[len("bright-"):]])
+			codes = append(codes, strconv.Itoa(code+60))
+		case strings.HasPrefix(word, "#") && len(word) == 7:
+			rgb, err := strconv.ParseUint(word[1:], 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("bad color %q", word)
+			}
+			codes = append(codes, fmt.Sprintf("38;2;%d;%d;%d", rgb>>16, rgb>>8&0xff, rgb&0xff))
+		case strings.Trim(word, "0123456789;") == "":
+			codes = append(codes, word)
+		default:
+			return "", fmt.Errorf("unknown style %q, use words such as bold, dim, italic, cyan or bright-blue, #rrggbb or SGR codes", word)
+		}
+	}
+	return strings.Join(codes, ";"), nil
+}
+
+// The color of the heading of a message
+func (t theme) role(role string) string {
+	if role == "user" {
+		return t.prompt
+	}
+	return t.assistant
+}
+
+// Color the lines of the code blocks of a markdown text with style
+func colorizeCode(text, style string) string {
+	lines := strings.Split(text, "\n")
+	for i, block := range fenceLines(lines) {
+		if block >= 0 && lines[i] != "" {
+			lines[i] = colorize(lines[i], style)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	NO_TITLES    = "DEEPSEEK_NO_TITLES"
+	TITLE_MODEL  = "deepseek-chat"
+	TITLE_PROMPT = "Write a title of at most 5 words for the conversation below. Reply with the title only, without quotes or a final period."
+	// Characters of each message sent for titling
+	TITLE_CONTEXT = 1000
+)
+
+func init() {
+	registerCommand(command{
+		name:  "title",
+		usage: "<chat-id> [title]  set the title of a chat, or generate one",
+		run:   runTitle,
+	})
+}
+
+// Generate the title of a new chat in a detached process, so the answer
+// isn't held up by a second request
+func titleInBackground(chatID string) {
+	// A cassette would miss the request, or replay it out of order
+	if os.Getenv(NO_TITLES) != "" || recordPath != "" || replayPath != "" {
+		return
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return
+	}
+	// The same history, provider and connection settings
+	args := append(invocationFlags[:len(invocationFlags):len(invocationFlags)], "-q", "title", chatID)
+	cmd := exec.Command(exe, args...)
+	if err := cmd.Start(); err != nil {
+		if *debug {
+			errorf("Error starting title generation: %v\n", err)
+		}
+		return
+	}
+	cmd.Process.Release()
+}
+
+// Ask the model for a short title of the chat's first exchange
+func generateTitle(apiKey string, chat Chat) (string, error) {
+	var transcript strings.Builder
+	for _, msg := range chat.Messages {
+		if msg.Role != "user" && msg.Role != "assistant" {
+			continue
+		}
+		content := msg.Content
+		if len(content) > TITLE_CONTEXT {
+			content = content[:TITLE_CONTEXT]
+		}
+		transcript.WriteString(msg.Role + ": " + content + "\n\n")
+		if msg.Role == "assistant" {
+			break
+		}
+	}
+	// Other providers don't serve DeepSeek's cheap model
+	titleModel := TITLE_MODEL
+	if currentProvider.name != DEFAULT_PROVIDER {
+		titleModel = currentProvider.model
+	}
+	response, err := streamChat(chatRequest{
+		apiKey: apiKey,
+		model:  titleModel,
+		messages: []Message{
+			{Role: "system", Content: TITLE_PROMPT},
+			{Role: "user", Content: transcript.String()},
+		},
+		debug: *debug,
+	})
+	if err != nil {
+		return "", err
+	}
+	return cleanTitle(response.content), nil
+}
+
+func cleanTitle(title string) string {
+	title = strings.Join(strings.Fields(title), " ")
+	title = strings.Trim(title, "\"'`*#.")
+	if runes := []rune(title); len(runes) > 60 {
+		title = string(runes[:60])
+	}
+	return strings.TrimSpace(title)
+}
+
+func runTitle(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: deepseek title <chat-id> [title]")
+	}
+	chatID, chat, err := chatFromArgs(args[:1], "usage: deepseek title <chat-id> [title]")
+	if err != nil {
+		return err
+	}
+	title := cleanTitle(strings.Join(args[1:], " "))
+	if title == "" {
+		apiKey, err := loadAPIKey()
+		if err != nil {
+			return err
+		}
+		if title, err = generateTitle(apiKey, chat); err != nil {
+			return err
+		}
+		if title == "" {
+			return errors.New("the model returned an empty title")
+		}
+	}
+	err = updateChat(chatID, func(stored *Chat, _ bool) {
+		stored.Title = title
+	})
+	if err != nil {
+		return err
+	}
+	infof("Chat %s: %s\n", chatID, title)
+	return nil
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func init() {
+	registerCommand(command{
+		name:  "tui",
+		usage: "[chat-id]  browse a conversation full-screen: j/k, gg/G, / to search, y to yank",
+		run:   runTUI,
+	})
+}
+
+// A screen line of the transcript
+type tuiLine struct {
+	text string
+	// The message it belongs to, and its code block, -1 outside of one
+	message, block int
+	// Its colors, from the theme
+	style string
+}
+
+// The state of the transcript browser
+type tuiView struct {
+	chatID        string
+	chat          Chat
+	lines         []tuiLine
+	width, height int
+	// The line under the cursor, and the first one shown
+	cursor, top int
+	search      string
+	status      string
+	// A "g" waiting for a second one
+	pendingG bool
+}
+
+func runTUI(args []string) error {
+	chatID, chat, err := chatFromArgs(args, "usage: deepseek tui [chat-id]")
+	if err != nil {
+		return err
+	}
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return errors.New("deepseek tui needs a terminal, see `deepseek show` otherwise")
+	}
+	restore, err := makeRaw(os.Stdin)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	// The alternate screen leaves the scrollback as it was
+	fmt.Print("\033[?1049h\033[?25l")
+	defer fmt.Print("\033[?25h\033[?1049l")
+
+	v := &tuiView{chatID: chatID, chat: chat}
+	v.layout()
+	resized := make(chan bool, 1)
+	stopResize := watchResize(os.Stdout, func(int) {
+		select {
+		case resized <- true:
+		default:
+		}
+	})
+	defer stopResize()
+	keys := make(chan string)
+	go readKeys(keys)
+
+	for {
+		v.draw()
+		select {
+		case <-resized:
+			v.layout()
+		case key, ok := <-keys:
+			if !ok || !v.handle(key, keys) {
+				return nil
+			}
+		}
+	}
+}
+
+// Send each key read from stdin, escape sequences whole
+func readKeys(keys chan<- string) {
+	buf := make([]byte, 64)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			close(keys)
+			return
+		}
+		data := string(buf[:n])
+		for data != "" {
+			key := data[:1]
+			if data[0] == '\033' && len(data) > 2 && data[1] == '[' {
+				// Up to the final byte of the sequence
+				end := 2
+				for end < len(data) && (data[end] < 0x40 || data[end] > 0x7e) {
+					end++
+				}
+				key = data[:min(end+1, len(data))]
+			}
+			keys <- key
+			data = data[len(key):]
+		}
+	}
+}
+
+// Wrap the transcript at the terminal width
+func (v *tuiView) layout() {
+	v.width, v.height, _ = terminalSize(os.Stdout)
+	current := -1
+	if v.cursor < len(v.lines) {
+		current = v.lines[v.cursor].message
+	}
+	v.lines = nil
+	for i, msg := range v.chat.Messages {
+		if msg.Role == "system" && msg.Content == "" {
+			continue
+		}
+		if len(v.lines) > 0 {
+			v.lines = append(v.lines, tuiLine{message: i, block: -1})
+		}
+		if current == i {
+			v.cursor = len(v.lines)
+		}
+		v.lines = append(v.lines, tuiLine{text: messageTitle(msg), message: i, block: -1, style: colors.role(msg.Role)})
+		if msg.Reasoning != "" {
+			v.addLines(strings.Split(strings.TrimRight(msg.Reasoning, "\n"), "\n"), tuiLine{message: i, block: -1, style: colors.reasoning})
+		}
+		lines := strings.Split(strings.TrimRight(msg.Content, "\n"), "\n")
+		// Code blocks numbered as parseCodeBlocks does, for y to find them
+		for j, block := range fenceLines(lines) {
+			l := tuiLine{message: i, block: block}
+			if block >= 0 {
+				l.style = colors.code
+			}
+			v.addLines(lines[j:j+1], l)
+		}
+	}
+	v.cursor = min(v.cursor, max(len(v.lines)-1, 0))
+	v.scroll()
+}
+
+// Add the lines wrapped, each piece like l
+func (v *tuiView) addLines(lines []string, l tuiLine) {
+	for _, line := range lines {
+		// A column is left for the cursor mark
+		for _, part := range hardWrap(line, v.width-1) {
+			l.text = part
+			v.lines = append(v.lines, l)
+		}
+	}
+}
+
+// Split line into pieces of at most width columns
+func hardWrap(line string, width int) []string {
+	var parts []string
+	var part strings.Builder
+	cols := 0
+	for _, r := range line {
+		w := runeWidth(r)
+		if cols+w > width && cols > 0 {
+			parts = append(parts, part.String())
+			part.Reset()
+			cols = 0
+		}
+		part.WriteRune(r)
+		cols += w
+	}
+	return append(parts, part.String())
+}
+
+// The rows of the screen left for the transcript
+func (v *tuiView) rows() int {
+	return max(v.height-1, 1)
+}
+
+// Keep the cursor on screen
+func (v *tuiView) scroll() {
+	if v.cursor < v.top {
+		v.top = v.cursor
+	}
+	if v.cursor >= v.top+v.rows() {
+		v.top = v.cursor - v.rows() + 1
+	}
+	v.top = max(min(v.top, len(v.lines)-v.rows()), 0)
+}
+
+func (v *tuiView) move(delta int) {
+	v.cursor = max(min(v.cursor+delta, len(v.lines)-1), 0)
+	v.scroll()
+}
+
+func (v *tuiView) draw() {
+	var screen strings.Builder
+	screen.WriteString("\033[H")
+	for row := 0; row < v.rows(); row++ {
+		i := v.top + row
+		screen.WriteString("\033[2K")
+		if i < len(v.lines) {
+			screen.WriteString(v.render(i))
+		} else {
+			screen.WriteString(colorize("~", "2"))
+		}
+		screen.WriteString("\r\n")
+	}
+	message := 0
+	if v.cursor < len(v.lines) {
+		message = v.lines[v.cursor].message + 1
+	}
+	status := fmt.Sprintf(" %s  message %d/%d  line %d/%d", v.chatID, message, len(v.chat.Messages), v.cursor+1, len(v.lines))
+	if v.status != "" {
+		status += "  " + v.status
+	} else {
+		status += "  j/k gg/G / n/N y q"
+	}
+	screen.WriteString("\033[2K" + colorize(padWidth(truncateWidth(status, v.width), v.width, false), "7"))
+	fmt.Print(screen.String())
+}
+
+// A line styled by its kind, the matches of the search highlighted and the
+// cursor line marked
+func (v *tuiView) render(i int) string {
+	line := v.lines[i]
+	style := line.style
+	text := line.text
+	if v.search != "" {
+		text = highlightMatches(text, v.search, style)
+	} else if style != "" {
+		text = colorize(text, style)
+	}
+	if i == v.cursor {
+		return colorize(">", "1") + text
+	}
+	return " " + text
+}
+
+// Show the case-insensitive matches of term in reverse video
+func highlightMatches(text, term, style string) string {
+	var out strings.Builder
+	lower, lowerTerm := strings.ToLower(text), strings.ToLower(term)
+	styled := func(s string) {
+		if style != "" && s != "" {
+			s = colorize(s, style)
+		}
+		out.WriteString(s)
+	}
+	for {
+		i := strings.Index(lower, lowerTerm)
+		// Lowercasing may change lengths, falling back to no highlight
+		if i < 0 || len(lower) != len(text) {
+			styled(text)
+			return out.String()
+		}
+		styled(text[:i])
+		out.WriteString(colorize(text[i:i+len(term)], "7"))
+		text, lower = text[i+len(term):], lower[i+len(term):]
+	}
+}
+
+// Act on a key; false to leave
+func (v *tuiView) handle(key string, keys <-chan string) bool {
+	v.status = ""
+	g := v.pendingG
+	v.pendingG = false
+	switch key {
+	case "q", "\x03":
+		return false
+	case "j", "\033[B", "\r":
+		v.move(1)
+	case "k", "\033[A":
+		v.move(-1)
+	case "\x04", " ", "\033[6~":
+		v.move(v.rows() / 2)
+	case "\x15", "b", "\033[5~":
+		v.move(-v.rows() / 2)
+	case "g":
+		if g {
+			v.move(-len(v.lines))
+		} else {
+			v.pendingG = true
+		}
+	case "G", "\033[F":
+		v.move(len(v.lines))
+	case "\033[H":
+		v.move(-len(v.lines))
+	case "/":
+		if term, ok := v.prompt("/", keys); ok {
+			v.search = term
+			if term != "" {
+				v.next(1, false)
+			}
+		}
+	case "n":
+		v.next(1, true)
+	case "N":
+		v.next(-1, true)
+	case "y":
+		v.yank()
+	}
+	return true
+}
+
+// Read a line on the status row, until Enter; false when Esc cancels it
+func (v *tuiView) prompt(label string, keys <-chan string) (string, bool) {
+	var input []rune
+	for {
+		fmt.Printf("\033[%d;1H\033[2K%s%s", v.height, label, string(input))
+		key, ok := <-keys
+		if !ok {
+			return "", false
+		}
+		switch key {
+		case "\r", "\n":
+			return string(input), true
+		case "\033", "\x03":
+			return "", false
+		case "\x7f", "\b":
+			if len(input) > 0 {
+				input = input[:len(input)-1]
+			}
+		default:
+			if key[0] >= ' ' {
+				input = append(input, []rune(key)...)
+			}
+		}
+	}
+}
+
+// Move the cursor to the next match of the search in the direction dir,
+// past the cursor line when skip is set
+func (v *tuiView) next(dir int, skip bool) {
+	if v.search == "" {
+		v.status = "no search, / starts one"
+		return
+	}
+	term := strings.ToLower(v.search)
+	start := v.cursor
+	if skip {
+		start += dir
+	}
+	for n := 0; n < len(v.lines); n++ {
+		i := ((start+n*dir)%len(v.lines) + len(v.lines)) % len(v.lines)
+		if strings.Contains(strings.ToLower(v.lines[i].text), term) {
+			if (dir > 0 && i < v.cursor) || (dir < 0 && i > v.cursor) {
+				v.status = "search wrapped"
+			}
+			v.cursor = i
+			v.scroll()
+			return
+		}
+	}
+	v.status = fmt.Sprintf("%q not found", v.search)
+}
+
+// Copy the code block under the cursor, or else its message
+func (v *tuiView) yank() {
+	if len(v.lines) == 0 {
+		return
+	}
+	line := v.lines[v.cursor]
+	msg := v.chat.Messages[line.message]
+	text, what := msg.Content, "message"
+	if line.block >= 0 {
+		if blocks := parseCodeBlocks(msg.Content); line.block < len(blocks) {
+			text, what = blocks[line.block].content, "code block"
+		}
+	}
+	if err := copyToClipboard(text); err != nil {
+		v.status = "copying: " + err.Error()
+		return
+	}
+	v.status = "copied the " + what
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// Default time between refreshes of -ls -watch
+	WATCH_INTERVAL = 2 * time.Second
+	// How long a chat stays highlighted after it got new messages
+	WATCH_HIGHLIGHT = 15 * time.Second
+)
+
+// Redraw the -ls table every opts.watch until interrupted, re-reading the
+// index written by other invocations. The current chat is shown in bold
+// and chats that just got messages in yellow. The caller holds mutex.
+func watchChats(opts listOptions) error {
+	tty := isTerminal(os.Stdout)
+	seen := make(map[string]ChatMeta)
+	changed := make(map[string]time.Time)
+	for refresh := 0; ; refresh++ {
+		if err := readIndex(); err != nil {
+			errorf("Error: %v\n", err)
+		}
+		now := time.Now()
+		for id, meta := range chatIndex {
+			if prev, ok := seen[id]; refresh > 0 && (!ok || meta.Messages != prev.Messages) {
+				changed[id] = now
+			}
+			seen[id] = meta
+		}
+
+		listed := opts
+		var style func(id string) string
+		if tty {
+			_, height, _ := terminalSize(os.Stdout)
+			// Leave room for the status line and the header
+			if rows := height - 2; listed.limit <= 0 || listed.limit > rows {
+				listed.limit = max(rows, 1)
+			}
+			style = func(id string) string {
+				fresh := now.Sub(changed[id]) < WATCH_HIGHLIGHT
+				switch {
+				case id == lastChatID && fresh:
+					return "1;33"
+				case id == lastChatID:
+					return "1"
+				case fresh:
+					return "33"
+				}
+				return ""
+			}
+		}
+		table, err := chatTable(listed, style)
+		if err != nil {
+			return err
+		}
+		if tty {
+			// Without the final newline a full screen doesn't scroll
+			fmt.Print("\033[H\033[2J")
+			table = strings.TrimSuffix(table, "\n")
+		} else if refresh > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("Every %s: deepseek -ls    %s\n", opts.watch, now.Format(time.DateTime))
+		fmt.Print(table)
+		time.Sleep(opts.watch)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	WEBHOOK_GENERIC = "generic"
+	WEBHOOK_SLACK   = "slack"
+)
+
+var (
+	// -webhook: URL receiving a summary of every answer, -webhook-format its
+	// shape and -webhook-chars how much of the answer it has
+	webhookURL    string
+	webhookFormat string
+	webhookChars  = 200
+)
+
+// What the generic webhook receives once an answer is done or failed
+type webhookSummary struct {
+	Status string `json:"status"`
+	ChatID string `json:"chat_id,omitempty"`
+	JobID  string `json:"job_id,omitempty"`
+	Prompt string `json:"prompt"`
+	// The first -webhook-chars characters
+	Answer string `json:"answer"`
+	Model  string `json:"model"`
+	// Estimated, in USD
+	Cost  float64 `json:"cost"`
+	Usage *Usage  `json:"usage,omitempty"`
+	Error string  `json:"error,omitempty"`
+}
+
+// Check -webhook is a URL, and pick its format: Slack's for Slack's
+// incoming webhooks unless told otherwise
+func checkWebhook() error {
+	if webhookURL == "" {
+		return nil
+	}
+	u, err := url.Parse(webhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("-webhook %q is not an http or https URL", webhookURL)
+	}
+	if webhookChars < 0 {
+		return errors.New("-webhook-chars must not be negative")
+	}
+	switch webhookFormat {
+	case "":
+		webhookFormat = WEBHOOK_GENERIC
+		if u.Host == "hooks.slack.com" {
+			webhookFormat = WEBHOOK_SLACK
+		}
+	case WEBHOOK_GENERIC, WEBHOOK_SLACK:
+	default:
+		return fmt.Errorf("unknown -webhook-format %q, use %s or %s", webhookFormat, WEBHOOK_GENERIC, WEBHOOK_SLACK)
+	}
+	return nil
+}
+
+// POST the summary of an answer to -webhook, if set. A failure is only
+// warned about: the answer is there anyway.
+func postWebhook(s webhookSummary) {
+	if webhookURL == "" {
+		return
+	}
+	s.Status = "done"
+	if s.Error != "" {
+		s.Status = "failed"
+	}
+	if runningJob != nil {
+		s.JobID = runningJob.ID
+	}
+	s.Cost = estimateCost(s.Model, s.Usage)
+	if runes := []rune(s.Answer); len(runes) > webhookChars {
+		s.Answer = string(runes[:webhookChars]) + "…"
+	}
+	var payload any = s
+	if webhookFormat == WEBHOOK_SLACK {
+		payload = map[string]string{"text": slackText(s)}
+	}
+	body, _ := json.Marshal(payload)
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			err = errors.New(resp.Status)
+		}
+	}
+	if err != nil {
+		errorf("Warning: posting to -webhook: %v\n", err)
+	}
+}
+
+// The summary as a Slack message
+func slackText(s webhookSummary) string {
+	var b strings.Builder
+	if s.Status == "done" {
+		b.WriteString("*deepseek*: answer ready")
+	} else {
+		b.WriteString("*deepseek*: request failed")
+	}
+	if s.JobID != "" {
+		fmt.Fprintf(&b, ", job `%s`", s.JobID)
+	}
+	if s.ChatID != "" {
+		fmt.Fprintf(&b, " in chat `%s`", s.ChatID)
+	}
+	if s.Cost > 0 {
+		fmt.Fprintf(&b, " ($%.4f)", s.Cost)
+	}
+	fmt.Fprintf(&b, "\n> %s\n", summarize(s.Prompt, 200))
+	if s.Error != "" {
+		b.WriteString(s.Error)
+	} else {
+		b.WriteString(s.Answer)
+	}
+	return b.String()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// wrapWriter soft-wraps streamed prose at a word boundary before the
+// terminal width, leaving fenced code blocks untouched
+type wrapWriter struct {
+	out     io.Writer
+	width   atomic.Int64
+	col     int
+	spaces  int
+	word    []rune
+	line    []rune
+	inCode  bool
+	partial []byte
+}
+
+func newWrapWriter(out io.Writer, width int) *wrapWriter {
+	w := &wrapWriter{out: out}
+	w.width.Store(int64(width))
+	return w
+}
+
+// Change the wrap width, e.g. after the terminal was resized
+func (w *wrapWriter) setWidth(width int) {
+	w.width.Store(int64(width))
+}
+
+func (w *wrapWriter) Write(p []byte) (int, error) {
+	data := append(w.partial, p...)
+	w.partial = nil
+	var buf strings.Builder
+	for len(data) > 0 {
+		if !utf8.FullRune(data) {
+			w.partial = append([]byte(nil), data...)
+			break
+		}
+		r, size := utf8.DecodeRune(data)
+		data = data[size:]
+		w.writeRune(&buf, r)
+	}
+	if _, err := io.WriteString(w.out, buf.String()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *wrapWriter) writeRune(buf *strings.Builder, r rune) {
+	if r == '\n' {
+		w.flushWord(buf)
+		buf.WriteRune('\n')
+		if fence := strings.TrimSpace(string(w.line)); strings.HasPrefix(fence, "```") || strings.HasPrefix(fence, "~~~") {
+			w.inCode = !w.inCode
+		}
+		w.col, w.spaces, w.line = 0, 0, w.line[:0]
+		return
+	}
+	w.line = append(w.line, r)
+	if w.inCode || strings.HasPrefix(strings.TrimSpace(string(w.line)), "```") {
+		w.flushWord(buf)
+		buf.WriteRune(r)
+		w.col++
+		return
+	}
+	if r == ' ' || r == '\t' {
+		w.flushWord(buf)
+		w.spaces++
+		return
+	}
+	w.word = append(w.word, r)
+}
+
+// Write the buffered word, breaking the line first when it would overflow
+func (w *wrapWriter) flushWord(buf *strings.Builder) {
+	if len(w.word) == 0 {
+		return
+	}
+	width := int(w.width.Load())
+	if w.col > 0 && width > 0 && w.col+w.spaces+len(w.word) > width {
+		buf.WriteRune('\n')
+		w.col, w.spaces = 0, 0
+	}
+	buf.WriteString(strings.Repeat(" ", w.spaces))
+	buf.WriteString(string(w.word))
+	w.col += w.spaces + len(w.word)
+	w.spaces, w.word = 0, w.word[:0]
+}
+
+// Write out any buffered word at the end of the stream
+func (w *wrapWriter) Flush() error {
+	var buf strings.Builder
+	w.flushWord(&buf)
+	_, err := io.WriteString(w.out, buf.String())
+	return err
+}